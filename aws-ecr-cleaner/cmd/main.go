@@ -1,12 +1,15 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
 
-	"github.com/joho/godotenv"
 	"aws-ecr-cleaner/internal/cleaner"
 	"aws-ecr-cleaner/internal/config"
 	"aws-ecr-cleaner/internal/logger"
+	"github.com/joho/godotenv"
 )
 
 func main() {
@@ -20,5 +23,42 @@ func main() {
 	// 传入 cfg.InteractiveMode 控制是否保留终端输出
 	logger.InitLogger(cfg.LogFilePath, cfg.InteractiveMode)
 
-	cleaner.Run(cfg)
+	// 子命令：默认执行清理；lifecycle 将清理规则编译为 ECR 生命周期策略；restore 从隔离仓库或归档恢复镜像；purge 删除超过保留期的隔离镜像
+	command := "clean"
+	var args []string
+	if len(os.Args) > 1 {
+		command, args = os.Args[1], os.Args[2:]
+	}
+	switch command {
+	case "clean":
+		cleaner.Run(cfg)
+	case "lifecycle":
+		fs := flag.NewFlagSet("lifecycle", flag.ExitOnError)
+		var opts cleaner.LifecycleOptions
+		fs.BoolVar(&opts.Apply, "apply", false, "put the compiled lifecycle policy on each matched repository after preview")
+		fs.BoolVar(&opts.Overwrite, "overwrite", false, "replace existing lifecycle policies that differ from the compiled policy without asking")
+		fs.Parse(args)
+		cleaner.RunLifecycle(cfg, opts)
+	case "restore":
+		fs := flag.NewFlagSet("restore", flag.ExitOnError)
+		var opts cleaner.RestoreOptions
+		fs.StringVar(&opts.Tag, "tag", "", "tag for the restored image (default: the original tag when restoring by tag)")
+		fs.StringVar(&opts.AccountID, "account", "", "target account ID (required when several accounts are configured)")
+		fs.StringVar(&opts.Region, "region", "", "target region (default: the first configured region)")
+		fs.Usage = func() {
+			fmt.Fprintln(fs.Output(), "Usage: restore [-tag TAG] [-account ID] [-region REGION] <repository> <tag|digest>")
+			fs.PrintDefaults()
+		}
+		fs.Parse(args)
+		if fs.NArg() != 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		opts.Repository, opts.Ref = fs.Arg(0), fs.Arg(1)
+		cleaner.RunRestore(cfg, opts)
+	case "purge":
+		cleaner.RunPurge(cfg)
+	default:
+		log.Fatalf("Unknown command '%s'. Must be one of: clean, lifecycle, restore, purge", command)
+	}
 }
@@ -0,0 +1,114 @@
+// aws-ecr-cleaner/internal/cleaner/archive.go
+package cleaner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+)
+
+// archiveLayoutDir 返回账户与区域的归档目录：<ARCHIVE_DIR>/<账户>/<区域>
+// dir 格式下该目录本身就是 OCI image layout，tar 格式下保存每次运行的 tar 文件
+func archiveLayoutDir(cfg *config.Config) string {
+	return filepath.Join(cfg.ArchiveDir, cfg.AccountID, cfg.AWSRegion)
+}
+
+// archiveTarPath 返回 tar 格式下本次运行的归档文件路径
+func archiveTarPath(cfg *config.Config, now time.Time) string {
+	return filepath.Join(archiveLayoutDir(cfg), fmt.Sprintf("archive_%s.tar", now.Format("20060102_150405")))
+}
+
+// archiveCandidates 在删除前归档按 digest 删除的候选镜像，返回可以继续删除的候选与归档失败（因此保留）的候选
+// 只移除 tag 的候选不删除镜像内容，无需归档；未设置 ARCHIVE_DIR 时原样返回
+func archiveCandidates(out io.Writer, cfg *config.Config, svc ecr.Registry, summary *Summary, candidates []ecr.Candidate, now time.Time) []ecr.Candidate {
+	if cfg.ArchiveDir == "" {
+		return candidates
+	}
+	var toArchive []int
+	for i, c := range candidates {
+		if c.RemovesManifest(cfg.DeleteMode) {
+			toArchive = append(toArchive, i)
+		}
+	}
+	if len(toArchive) == 0 {
+		return candidates
+	}
+
+	dest := archiveLayoutDir(cfg)
+	if cfg.ArchiveFormat == config.ArchiveFormatTar {
+		dest = archiveTarPath(cfg, now)
+	}
+	fmt.Fprintln(out, "\n-------------------------------")
+	if cfg.DryRun {
+		fmt.Fprintf(out, "[Dry-run] Would archive %d images to %s before deletion\n", len(toArchive), dest)
+		return candidates
+	}
+	fmt.Fprintf(out, "Archiving %d images to %s before deletion...\n", len(toArchive), dest)
+
+	// tar 格式先写入临时 layout 目录，全部完成后打包并校验 tar，再删除临时目录
+	layoutDir := archiveLayoutDir(cfg)
+	if cfg.ArchiveFormat == config.ArchiveFormatTar {
+		layoutDir = filepath.Join(archiveLayoutDir(cfg), fmt.Sprintf(".staging_%s", now.Format("20060102_150405")))
+		defer os.RemoveAll(layoutDir)
+	}
+	layout, err := ecr.OpenOCILayout(layoutDir)
+	if err != nil {
+		fmt.Fprintf(out, "Error opening archive: %v, not deleting %d images\n", err, len(toArchive))
+		for _, i := range toArchive {
+			summary.AddArchiveFailure(candidates[i], err)
+		}
+		return removeCandidates(candidates, toArchive)
+	}
+
+	var archived, failed []int
+	for _, i := range toArchive {
+		c := candidates[i]
+		if _, err := ecr.ArchiveImage(svc, layout, c, now); err != nil {
+			fmt.Fprintf(out, "Error archiving image (Digest %s, Tags %v) in repository %s, not deleting: %v\n", c.ImageDigest, c.ImageTags, c.RepositoryName, err)
+			summary.AddArchiveFailure(c, err)
+			failed = append(failed, i)
+			continue
+		}
+		fmt.Fprintf(out, "Archived image (Digest %s, Tags %v) in repository %s\n", c.ImageDigest, c.ImageTags, c.RepositoryName)
+		archived = append(archived, i)
+	}
+
+	if cfg.ArchiveFormat == config.ArchiveFormatTar && len(archived) > 0 {
+		err := ecr.PackOCILayout(layoutDir, dest)
+		if err == nil {
+			_, err = ecr.VerifyOCITarball(dest)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Error writing archive %s, not deleting %d images: %v\n", dest, len(archived), err)
+			for _, i := range archived {
+				summary.AddArchiveFailure(candidates[i], err)
+			}
+			return removeCandidates(candidates, toArchive)
+		}
+	}
+	if len(archived) > 0 {
+		fmt.Fprintf(out, "Archived and verified %d images in %s\n", len(archived), dest)
+		summary.AddArchived(len(archived), dest)
+	}
+	return removeCandidates(candidates, failed)
+}
+
+// removeCandidates 返回去掉 indexes 指向的候选后的列表，保持原有顺序
+func removeCandidates(candidates []ecr.Candidate, indexes []int) []ecr.Candidate {
+	drop := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		drop[i] = true
+	}
+	var kept []ecr.Candidate
+	for i, c := range candidates {
+		if !drop[i] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
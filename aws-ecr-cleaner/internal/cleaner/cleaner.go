@@ -3,40 +3,113 @@ package cleaner
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"aws-ecr-cleaner/internal/config"
 	"aws-ecr-cleaner/internal/ecr"
 	"aws-ecr-cleaner/internal/k8s"
+	"aws-ecr-cleaner/internal/state"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	awsecr "github.com/aws/aws-sdk-go/service/ecr"
 )
 
 func Run(cfg *config.Config) {
 	log.Println("Starting AWS ECR Cleaner...")
 
-	// 建立 AWS session
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(cfg.AWSRegion),
-	})
+	targets, failures, err := resolveTargets(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create AWS session: %v", err)
+		log.Fatalf("Failed to initialize registry: %v", err)
 	}
+	validateAccountOverrides(cfg, targets)
 
-	// 获取账户 ID并构造目标 ECR 地址
-	accountID, err := ecr.GetAccountID(sess)
+	// in-use 镜像地址包含账户 ID 与区域，所有账户和区域共用一次加载结果
+	inUse := loadInUseImages(cfg)
+
+	// 跨运行状态（空仓库首次为空的时间等），运行结束时写回
+	store, err := state.Load(cfg.StateFile)
 	if err != nil {
-		log.Fatalf("Failed to get AWS account ID: %v", err)
+		log.Fatalf("Failed to load state: %v", err)
 	}
-	targetECR := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", accountID, cfg.AWSRegion)
-	fmt.Printf("Target ECR: %s\n", targetECR)
 
-	// 获取 in-use 镜像映射（如果 imageListFile 不存在或为空，则从 k8s 集群拉取）
+	// 按区域分组，区域顺序与配置一致
+	byRegion := make(map[string][]target)
+	for _, t := range targets {
+		byRegion[t.region] = append(byRegion[t.region], t)
+	}
+
+	multi := cfg.MultiAccount() || len(targets) > 1
+	reports := make([][]accountReport, len(cfg.Regions))
+	if cfg.ParallelRegions && len(cfg.Regions) > 1 {
+		// 各区域并行处理，输出先写入缓冲区，完成后按区域顺序打印
+		outputs := make([]strings.Builder, len(cfg.Regions))
+		var wg sync.WaitGroup
+		for i, region := range cfg.Regions {
+			wg.Add(1)
+			go func(i int, region string) {
+				defer wg.Done()
+				reports[i] = cleanRegion(&outputs[i], cfg, byRegion[region], inUse, store, multi)
+			}(i, region)
+		}
+		wg.Wait()
+		for i := range outputs {
+			fmt.Print(outputs[i].String())
+		}
+	} else {
+		for i, region := range cfg.Regions {
+			reports[i] = cleanRegion(os.Stdout, cfg, byRegion[region], inUse, store, multi)
+		}
+	}
+
+	if multi {
+		printCombinedReport(cfg.Regions, reports, failures)
+	}
+
+	// 先写回状态再因错误退出：log.Fatalf 不会执行 defer
+	if err := store.Save(); err != nil {
+		log.Printf("Failed to save state: %v", err)
+	}
+	// 单账户单区域时保持原有行为以非零状态退出；否则错误已记入各账户的汇总
+	if !multi {
+		for _, regionReports := range reports {
+			for _, r := range regionReports {
+				if r.summary.Err != nil {
+					log.Fatalf("Cleanup failed: %v", r.summary.Err)
+				}
+			}
+		}
+	}
+}
+
+// cleanRegion 依次清理同一区域内的各个账户
+func cleanRegion(out io.Writer, cfg *config.Config, targets []target, inUse map[string]bool, store *state.Store, multi bool) []accountReport {
+	var reports []accountReport
+	for _, t := range targets {
+		acfg := cfg.ForAccount(t.accountID)
+		acfg.AWSRegion = t.region
+		overrides := config.AccountOverrides(t.accountID)
+		if multi {
+			fmt.Fprintln(out, "\n===============================")
+			fmt.Fprintf(out, "Region: %s, Account: %s (source: %s)\n", t.region, t.accountID, t.source)
+			if len(overrides) > 0 {
+				fmt.Fprintf(out, "Policy overrides: %v\n", overrides)
+			}
+		}
+		summary := Clean(out, acfg, t.svc, t.accountID, inUse, store)
+		reports = append(reports, accountReport{accountID: t.accountID, source: t.source, region: t.region, overrides: overrides, summary: summary})
+	}
+	return reports
+}
+
+// loadInUseImages 获取 in-use 镜像映射（如果 imageListFile 不存在或为空，则从 k8s 集群拉取）
+func loadInUseImages(cfg *config.Config) map[string]bool {
 	var inUse map[string]bool
 	fileInfo, err := os.Stat(cfg.ImageListFile)
 	if err != nil || fileInfo.Size() == 0 {
@@ -47,179 +120,255 @@ func Run(cfg *config.Config) {
 	if cfg.Debug {
 		log.Printf("[DEBUG] Loaded in-use images: %v", inUse)
 	}
+	return inUse
+}
+
+// Clean 针对给定的 Registry 执行扫描、过滤与删除流程，输出写入 out，返回该账户的运行汇总
+func Clean(out io.Writer, cfg *config.Config, svc ecr.Registry, accountID string, inUse map[string]bool, store *state.Store) *Summary {
+	// 构造目标 ECR 地址
+	targetECR := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", accountID, cfg.AWSRegion)
+	fmt.Fprintf(out, "Target ECR: %s\n", targetECR)
+	summary := NewSummary(cfg.DryRun)
+	summary.StoragePrice = cfg.StoragePrice
+	summary.GraceDays = cfg.DeleteGraceDays
 
-	// 创建 ECR 客户端
-	svc := awsecr.New(sess)
 	repos, err := ecr.GetRepositories(svc, cfg.TargetRepoRegex, cfg.Debug)
 	if err != nil {
-		log.Fatalf("Error fetching repositories: %v", err)
+		// 记录错误并返回，由 Run 写回状态后决定是否退出；其它账户与区域继续处理
+		fmt.Fprintf(out, "Error fetching repositories: %v\n", err)
+		summary.Err = fmt.Errorf("error fetching repositories: %v", err)
+		summary.Outcome = summary.Err.Error()
+		return summary
 	}
 	if len(repos) == 0 {
-		fmt.Println("No repositories found matching the provided pattern.")
-		os.Exit(0)
-	}
-
-	// 如果设置 EXCLUDE_REPO_REGEX，则过滤掉匹配的仓库
-	var filteredRepos []*awsecr.Repository
-	if cfg.ExcludeRepoRegex != "" {
-		for _, repo := range repos {
-			repoName := aws.StringValue(repo.RepositoryName)
-			if ecr.MultiRegexMatch(repoName, cfg.ExcludeRepoRegex) {
-				if cfg.Debug {
-					log.Printf("[DEBUG] Excluding repository: %s", repoName)
-				}
-				continue
-			}
-			filteredRepos = append(filteredRepos, repo)
-		}
-		repos = filteredRepos
+		fmt.Fprintln(out, "No repositories found matching the provided pattern.")
+		summary.Outcome = OutcomeNoRepositories
+		return summary
 	}
 
 	var scannedImages []ecr.ScannedImage
 	var candidateImages []ecr.Candidate
+	var emptyRepos []*awsecr.Repository      // 可以删除的空仓库，确认后删除
+	protects := make(map[string]protectFunc) // 各仓库的 index 子 manifest 与制品保护，隔离失败后重新应用
+	targetRepos := selectRepositories(cfg, repos, targetECR)
 
-	// 遍历每个仓库
-	for _, repo := range repos {
-		repoName := aws.StringValue(repo.RepositoryName)
-		repoUri := aws.StringValue(repo.RepositoryUri)
-		if !strings.HasPrefix(repoUri, targetECR) {
+	// 并发扫描各仓库，结果按仓库顺序输出；通过 tag 选择不参与清理的仓库同样不做空仓库检查
+	handledEmpty := make(map[string]bool)
+	selected := 0
+	for i, scan := range scanRepositories(cfg, svc, targetRepos, inUse, store) {
+		if scan.notSelected {
+			handledEmpty[scan.repoName] = true
 			continue
 		}
-		fmt.Printf("\nRepository: %s (URI: %s)\n", repoName, repoUri)
-
-		images, err := ecr.GetImages(svc, repoName, cfg.Debug)
-		if err != nil {
-			fmt.Printf("Error fetching images for repository %s: %v\n", repoName, err)
-			continue
+		selected++
+		fmt.Fprint(out, scan.output.String())
+		if scan.scanErr != nil {
+			summary.AddSkippedRepo(scan.repoName, scan.scanErr)
 		}
-		fmt.Printf("Total images found: %d\n", len(images))
-
-		// 如果仓库为空，则直接删除该仓库
-		if len(images) == 0 {
-			fmt.Printf("Repository %s is empty. Deleting repository.\n", repoName)
-			if cfg.DryRun {
-				fmt.Printf("[Dry-run] Would delete repository: %s\n", repoName)
+		if scan.emptyRepo {
+			if scan.emptyKept != "" {
+				summary.AddEmptyRepoKept(scan.repoName, scan.emptyKept)
 			} else {
-				delRepoInput := &awsecr.DeleteRepositoryInput{
-					RepositoryName: aws.String(repoName),
-					Force:          aws.Bool(true),
-				}
-				_, err := svc.DeleteRepository(delRepoInput)
-				if err != nil {
-					fmt.Printf("Error deleting repository %s: %v\n", repoName, err)
-				} else {
-					fmt.Printf("Deleted repository: %s\n", repoName)
-				}
+				emptyRepos = append(emptyRepos, targetRepos[i])
 			}
-			continue
+			handledEmpty[scan.repoName] = true
 		}
-
-		// 记录扫描结果
-		for _, image := range images {
-			var tags []string
-			if image.ImageTags != nil {
-				for _, t := range image.ImageTags {
-					tags = append(tags, aws.StringValue(t))
-				}
-			}
-			var pushTime string
-			if image.ImagePushedAt != nil {
-				pushTime = image.ImagePushedAt.Format("2006-01-02T15:04:05Z")
-			}
-			scannedImages = append(scannedImages, ecr.ScannedImage{
-				RepositoryName: repoName,
-				RepositoryUri:  repoUri,
-				ImageDigest:    aws.StringValue(image.ImageDigest),
-				ImageTags:      tags,
-				PushTime:       *image.ImagePushedAt,
-			})
-			fmt.Printf("  [Scanned] Digest: %s, Tags: %v, PushedAt: %s\n", aws.StringValue(image.ImageDigest), tags, pushTime)
-		}
-
-		// 根据规则过滤候选镜像
-		candidates := ecr.FilterImagesForDeletion(images, cfg.HoldTagRegex, cfg.ProtectLatest, inUse, repoUri, cfg.ProtectInUseByK8s, cfg.Debug)
-		if len(candidates) > 0 {
-			fmt.Printf("\nCandidate images for deletion in repository '%s':\n", repoName)
-			for _, cand := range candidates {
-				cand.RepositoryName = repoName
-				fmt.Printf("  [Candidate] Tag: %s, Digest: %s, PushedAt: %s\n", cand.ImageTag, cand.ImageDigest, cand.PushTime.Format("2006-01-02T15:04:05Z"))
-				candidateImages = append(candidateImages, cand)
-			}
-		} else {
-			fmt.Printf("No candidate images for deletion in repository '%s'.\n", repoName)
+		summary.AddOrphanIndexes(scan.repoName, scan.orphanIndexes)
+		summary.AddOrphanReferrers(scan.repoName, scan.orphanReferrers)
+		if scan.scanErr == nil && !scan.overrides.Skip {
+			summary.AddRepoSize(scan.repoName, scan.scanned)
 		}
+		if scan.layerStats != nil {
+			summary.AddLayerStats(scan.repoName, *scan.layerStats)
+		}
+		summary.AddRepoOverrides(scan.repoName, scan.overrides)
+		if scan.overrides.Skip {
+			handledEmpty[scan.repoName] = true
+		}
+		if scan.lifecycleChecked {
+			summary.AddLifecycleFindings(scan.repoName, scan.lifecycle)
+		}
+		scannedImages = append(scannedImages, scan.scanned...)
+		candidateImages = append(candidateImages, scan.candidates...)
+		if scan.protect != nil {
+			protects[scan.repoName] = scan.protect
+		}
+		summary.AddScheduled(scan.scheduled)
+		summary.AddUnmarked(scan.unmarked)
+		summary.AddKept(scan.kept)
+	}
+	if cfg.RepoTagSelector != nil {
+		fmt.Fprintf(out, "\nTARGET_REPO_TAGS '%s' selected %d of %d repositories\n", cfg.TargetRepoTags, selected, len(targetRepos))
 	}
 
 	// 打印扫描与候选列表
-	fmt.Println("\n-------------------------------")
-	fmt.Println("Original ECR Scanning Image List:")
+	fmt.Fprintln(out, "\n-------------------------------")
+	fmt.Fprintln(out, "Original ECR Scanning Image List:")
 	for _, s := range scannedImages {
-		fmt.Printf("Repository: %s, Tags: %v, Digest: %s, PushedAt: %s\n", s.RepositoryName, s.ImageTags, s.ImageDigest, s.PushTime.Format("2006-01-02T15:04:05Z"))
+		fmt.Fprintf(out, "Repository: %s, Tags: %v, Digest: %s, PushedAt: %s, LastPulledAt: %s\n", s.RepositoryName, s.ImageTags, s.ImageDigest, s.PushTime.Format("2006-01-02T15:04:05Z"), ecr.FormatPullTime(s.PullTime))
 	}
 
-	fmt.Println("\nAfter Filter Image List (Candidates for deletion):")
+	fmt.Fprintln(out, "\nAfter Filter Image List (Candidates for deletion):")
+	for _, c := range candidateImages {
+		fmt.Fprintf(out, "Repository: %s, Tags: %v, Digest: %s, PushedAt: %s, LastPulledAt: %s, Remove: %s\n", c.RepositoryName, c.ImageTags, c.ImageDigest, c.PushTime.Format("2006-01-02T15:04:05Z"), ecr.FormatPullTime(c.PullTime), removalDesc(c, cfg.DeleteMode))
+	}
+	var reclaimable int64
 	for _, c := range candidateImages {
-		fmt.Printf("Repository: %s, Tag: %s, Digest: %s, PushedAt: %s\n", c.RepositoryName, c.ImageTag, c.ImageDigest, c.PushTime.Format("2006-01-02T15:04:05Z"))
+		if c.RemovesManifest(cfg.DeleteMode) {
+			reclaimable += c.Size
+		}
+	}
+	fmt.Fprintf(out, "Reclaimable by candidates: %s, estimated monthly saving: $%.2f\n", formatBytes(reclaimable), monthlyCost(reclaimable, cfg.StoragePrice))
+	if len(emptyRepos) > 0 {
+		fmt.Fprintln(out, "\nEmpty repositories to delete:")
+		for _, repo := range emptyRepos {
+			fmt.Fprintf(out, "Repository: %s\n", aws.StringValue(repo.RepositoryName))
+		}
 	}
-	fmt.Println("-------------------------------")
+	fmt.Fprintln(out, "-------------------------------")
 
 	if cfg.ListOnly {
-		fmt.Println("\nList-only mode enabled. Exiting without deletion.")
-		os.Exit(0)
+		summary.PrintKept(out)
+		summary.PrintMarks(out)
+		summary.PrintRepoOverrides(out)
+		summary.PrintLifecycle(out)
+		summary.PrintLayerAnalysis(out)
+		fmt.Fprintln(out, "\nList-only mode enabled. Exiting without deletion.")
+		summary.Outcome = OutcomeListOnly
+		return summary
 	}
 
 	// 如果不是自动确认模式，则进行交互确认
 	if !cfg.AutoConfirm {
-		fmt.Print("\nProceed with deletion of the above images? (y/n): ")
+		prompt := "\nProceed with deletion of the above images? (y/n): "
+		if len(emptyRepos) > 0 {
+			prompt = "\nProceed with deletion of the above images and repositories? (y/n): "
+		}
+		fmt.Fprint(out, prompt)
 		reader := bufio.NewReader(os.Stdin)
 		input, err := reader.ReadString('\n')
 		if err != nil {
-			log.Fatalf("Failed to read input: %v", err)
+			summary.Err = fmt.Errorf("failed to read input: %v", err)
+			summary.Outcome = summary.Err.Error()
+			return summary
 		}
 		input = strings.TrimSpace(input)
 		if strings.ToLower(input) != "y" {
-			fmt.Println("Aborting deletion.")
-			os.Exit(0)
+			fmt.Fprintln(out, "Aborting deletion.")
+			summary.Outcome = OutcomeAborted
+			return summary
 		}
 	}
 
-	// 遍历候选镜像执行删除
-	for _, cand := range candidateImages {
-		err := ecr.DeleteImage(svc, cand, cfg.DryRun, cfg.Debug)
-		if err != nil {
-			fmt.Printf("Error deleting image (Tag %s) in repository %s: %v\n", cand.ImageTag, cand.RepositoryName, err)
+	// 设置 ARCHIVE_DIR 时先归档，归档失败的镜像不删除
+	candidateImages = archiveCandidates(out, cfg, svc, summary, candidateImages, time.Now())
+
+	// 设置 QUARANTINE_REPO 时先复制到隔离仓库，复制失败的镜像不删除
+	candidateImages = quarantineCandidates(out, cfg, svc, summary, candidateImages, protects, time.Now())
+
+	// 按仓库分批删除候选镜像
+	results := ecr.DeleteImages(svc, candidateImages, cfg.DeleteMode, cfg.DryRun, cfg.Debug)
+	for _, r := range results {
+		if errors.Is(r.Err, ecr.ErrNothingToUntag) {
+			fmt.Fprintf(out, "Skipping image (Digest %s, Tags %v) in repository %s: %v\n", r.Candidate.ImageDigest, r.Candidate.ImageTags, r.Candidate.RepositoryName, r.Err)
+		} else if r.Err != nil {
+			fmt.Fprintf(out, "Error deleting image (Digest %s, Tags %v) in repository %s: %v\n", r.Candidate.ImageDigest, r.Candidate.ImageTags, r.Candidate.RepositoryName, r.Err)
 		}
 	}
+	summary.AddDeleteResults(results)
 
-	// 删除候选镜像后，再次检查每个仓库是否为空，若空则删除仓库（使用 Force 删除）
-	fmt.Println("\n-------------------------------")
-	fmt.Println("Checking for empty repositories to delete...")
-	for _, repo := range repos {
-		repoName := aws.StringValue(repo.RepositoryName)
-		remainingImages, err := ecr.GetImages(svc, repoName, cfg.Debug)
-		if err != nil {
-			fmt.Printf("Error re-fetching images for repository %s: %v\n", repoName, err)
-			continue
+	// 已移除的镜像清除删除标记；仅移除 tag 的镜像若再次成为候选，重新开始计算宽限期
+	if !cfg.DryRun {
+		for _, r := range results {
+			if r.Err == nil {
+				store.Unmark(state.RepoKey(cfg.AccountID, cfg.AWSRegion, r.Candidate.RepositoryName), r.Candidate.ImageDigest)
+			}
 		}
-		if len(remainingImages) == 0 {
-			fmt.Printf("Repository %s is now empty. Deleting repository.\n", repoName)
-			if cfg.DryRun {
-				fmt.Printf("[Dry-run] Would delete repository: %s\n", repoName)
-			} else {
-				delRepoInput := &awsecr.DeleteRepositoryInput{
-					RepositoryName: aws.String(repoName),
-					Force:          aws.Bool(true),
+	}
+
+	// 删除扫描时已满足条件的空仓库；删除候选镜像后再次检查每个仓库是否为空，新变为空的仓库从本次运行开始计算空置时间
+	if cfg.DeleteEmptyRepos {
+		fmt.Fprintln(out, "\n-------------------------------")
+		fmt.Fprintln(out, "Checking for empty repositories to delete...")
+		for _, repo := range emptyRepos {
+			kept, err := deleteEmptyRepository(out, cfg, svc, repo, store, time.Now())
+			addEmptyRepoResult(summary, aws.StringValue(repo.RepositoryName), kept, err)
+		}
+		for _, repo := range targetRepos {
+			repoName := aws.StringValue(repo.RepositoryName)
+			if handledEmpty[repoName] {
+				continue
+			}
+			remainingImages, err := ecr.GetImages(svc, repoName, cfg.Debug)
+			if err != nil {
+				fmt.Fprintf(out, "Error re-fetching images for repository %s: %v\n", repoName, err)
+				summary.AddSkippedRepo(repoName, err)
+				continue
+			}
+			if len(remainingImages) == 0 {
+				fmt.Fprintf(out, "Repository %s is now empty.\n", repoName)
+				if kept := checkEmptyRepository(out, cfg, repo, store, time.Now()); kept != "" {
+					summary.AddEmptyRepoKept(repoName, kept)
+					continue
 				}
-				_, err := svc.DeleteRepository(delRepoInput)
-				if err != nil {
-					fmt.Printf("Error deleting repository %s: %v\n", repoName, err)
-				} else {
-					fmt.Printf("Deleted repository: %s\n", repoName)
+				kept, err := deleteEmptyRepository(out, cfg, svc, repo, store, time.Now())
+				addEmptyRepoResult(summary, repoName, kept, err)
+			}
+		}
+	}
+
+	summary.Outcome = OutcomeCompleted
+	summary.Print(out)
+
+	fmt.Fprintln(out, "\n-------------------------------")
+	fmt.Fprintln(out, "Deletion process completed.")
+	return summary
+}
+
+// selectRepositories 过滤掉匹配 EXCLUDE_REPO_REGEX 的仓库，并只保留属于目标 ECR 的仓库
+func selectRepositories(cfg *config.Config, repos []*awsecr.Repository, targetECR string) []*awsecr.Repository {
+	// 如果设置 EXCLUDE_REPO_REGEX，则过滤掉匹配的仓库
+	var filteredRepos []*awsecr.Repository
+	if cfg.ExcludeRepoRegex != "" {
+		for _, repo := range repos {
+			repoName := aws.StringValue(repo.RepositoryName)
+			if ecr.MultiRegexMatch(repoName, cfg.ExcludeRepoRegex) {
+				if cfg.Debug {
+					log.Printf("[DEBUG] Excluding repository: %s", repoName)
 				}
+				continue
 			}
+			filteredRepos = append(filteredRepos, repo)
 		}
+		repos = filteredRepos
 	}
 
-	fmt.Println("\n-------------------------------")
-	fmt.Println("Deletion process completed.")
+	// 隔离仓库中的镜像只由 purge 子命令删除
+	repos = excludeQuarantineRepository(cfg, repos)
+
+	// 只处理属于目标 ECR 的仓库
+	var targetRepos []*awsecr.Repository
+	for _, repo := range repos {
+		if strings.HasPrefix(aws.StringValue(repo.RepositoryUri), targetECR) {
+			targetRepos = append(targetRepos, repo)
+		}
+	}
+	return targetRepos
+}
+
+// addEmptyRepoResult 将空仓库的处理结果记入汇总
+func addEmptyRepoResult(summary *Summary, repoName, kept string, err error) {
+	if kept != "" {
+		summary.AddEmptyRepoKept(repoName, kept)
+		return
+	}
+	summary.AddRepoDeletion(repoName, err)
+}
+
+// removalDesc 描述候选镜像在当前删除模式下将被移除的内容
+func removalDesc(c ecr.Candidate, mode string) string {
+	if c.RemovesManifest(mode) {
+		return "manifest (by digest)"
+	}
+	return fmt.Sprintf("tags %v", c.StaleTags)
 }
@@ -0,0 +1,214 @@
+package cleaner
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+	"aws-ecr-cleaner/internal/state"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+)
+
+const testAccountID = "123456789012"
+
+// dg 返回由 c 重复构成的 sha256 digest，与 testdata 中的 fixture 一致
+func dg(c string) string {
+	return "sha256:" + strings.Repeat(c, 64)
+}
+
+// testConfig 返回端到端测试使用的配置：保留 release 镜像、正在使用的镜像、最新 2 个带 tag 镜像与最新 1 个未打标签镜像
+func testConfig(t *testing.T) *config.Config {
+	return &config.Config{
+		TargetRepoRegex:    "^saas/",
+		HoldTagRegex:       "release",
+		ProtectLatest:      3,
+		ProtectInUseByK8s:  true,
+		KeepLatestTagged:   2,
+		KeepLatestUntagged: 1,
+		AutoConfirm:        true,
+		DeleteMode:         ecr.DeleteModeDigest,
+		ScanConcurrency:    2,
+		AWSRegion:          "us-east-1",
+		Regions:            []string{"us-east-1"},
+		AccountID:          testAccountID,
+		StateFile:          filepath.Join(t.TempDir(), "state.json"),
+	}
+}
+
+// remainingDigests 返回仓库中剩余镜像的 digest，按字典序排序
+func remainingDigests(t *testing.T, svc ecr.Registry, repoName string) []string {
+	t.Helper()
+	images, err := ecr.GetImages(svc, repoName, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digests := []string{}
+	for _, img := range images {
+		digests = append(digests, *img.ImageDigest)
+	}
+	sort.Strings(digests)
+	return digests
+}
+
+func TestClean(t *testing.T) {
+	svc, err := ecr.LoadMemoryRegistry("testdata/registry.json", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t)
+	store, err := state.Load(cfg.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inUse := map[string]bool{"saas/api:v1": true}
+
+	summary := Clean(io.Discard, cfg, svc, testAccountID, inUse, store)
+	if summary.Outcome != OutcomeCompleted {
+		t.Fatalf("outcome = %q, want %q", summary.Outcome, OutcomeCompleted)
+	}
+	if len(summary.Failed) > 0 || len(summary.SkippedRepos) > 0 {
+		t.Fatalf("failed = %+v, skipped = %v", summary.Failed, summary.SkippedRepos)
+	}
+
+	var deleted []string
+	for _, r := range summary.Deleted {
+		deleted = append(deleted, r.Candidate.RepositoryName+"@"+r.Candidate.ImageDigest)
+	}
+	sort.Strings(deleted)
+	if want := []string{"saas/api@" + dg("3"), "saas/api@" + dg("7")}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("deleted = %v, want %v", deleted, want)
+	}
+
+	// 保留规则记入汇总：最新的带 tag 镜像与最新的未打标签镜像（index 的子 manifest 不占名额）
+	var kept []string
+	for _, k := range summary.kept {
+		_, rest, _ := strings.Cut(k, "Digest: ")
+		digest, _, _ := strings.Cut(rest, ",")
+		kept = append(kept, digest)
+	}
+	sort.Strings(kept)
+	if want := []string{dg("1"), dg("2"), dg("6"), dg("8")}; !reflect.DeepEqual(kept, want) {
+		t.Errorf("kept = %v, want %v", kept, want)
+	}
+
+	// index 的子 manifest、release 镜像与正在使用的镜像仍在仓库中；不匹配 TARGET_REPO_REGEX 的仓库不受影响
+	tests := []struct {
+		repo string
+		want []string
+	}{
+		{repo: "saas/api", want: []string{dg("1"), dg("2"), dg("4"), dg("5"), dg("6"), dg("a")}},
+		{repo: "saas/web", want: []string{dg("8")}},
+		{repo: "tools/ci", want: []string{dg("9")}},
+	}
+	for _, tt := range tests {
+		if got := remainingDigests(t, svc, tt.repo); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s contains %v, want %v", tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestCleanDryRunKeepsRegistry(t *testing.T) {
+	svc, err := ecr.LoadMemoryRegistry("testdata/registry.json", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t)
+	cfg.DryRun = true
+	store, err := state.Load(cfg.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := remainingDigests(t, svc, "saas/api")
+
+	summary := Clean(io.Discard, cfg, svc, testAccountID, map[string]bool{"saas/api:v1": true}, store)
+	if len(summary.Deleted) != 2 {
+		t.Errorf("dry run reports %d deletions, want 2", len(summary.Deleted))
+	}
+	if after := remainingDigests(t, svc, "saas/api"); !reflect.DeepEqual(after, before) {
+		t.Errorf("dry run changed the registry: %v, want %v", after, before)
+	}
+}
+
+// failingManifestRegistry 对 failures 中的 digest，BatchGetImage 返回给定的失败代码而不是 manifest
+type failingManifestRegistry struct {
+	ecr.Registry
+	failures map[string]string
+}
+
+func (f *failingManifestRegistry) BatchGetImage(input *awsecr.BatchGetImageInput) (*awsecr.BatchGetImageOutput, error) {
+	out, err := f.Registry.BatchGetImage(input)
+	if err != nil {
+		return nil, err
+	}
+	var images []*awsecr.Image
+	for _, img := range out.Images {
+		if code, ok := f.failures[aws.StringValue(img.ImageId.ImageDigest)]; ok {
+			out.Failures = append(out.Failures, &awsecr.ImageFailure{ImageId: img.ImageId, FailureCode: aws.String(code), FailureReason: aws.String("injected failure")})
+			continue
+		}
+		images = append(images, img)
+	}
+	out.Images = images
+	return out, nil
+}
+
+func TestCleanSkipsRepositoryWhenIndexManifestFails(t *testing.T) {
+	mem, err := ecr.LoadMemoryRegistry("testdata/registry.json", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := &failingManifestRegistry{Registry: mem, failures: map[string]string{dg("2"): awsecr.ImageFailureCodeKmsError}}
+	cfg := testConfig(t)
+	store, err := state.Load(cfg.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := remainingDigests(t, svc, "saas/api")
+
+	summary := Clean(io.Discard, cfg, svc, testAccountID, map[string]bool{"saas/api:v1": true}, store)
+	if want := []string{"saas/api"}; !reflect.DeepEqual(summary.SkippedRepos, want) {
+		t.Errorf("skipped repositories = %v, want %v", summary.SkippedRepos, want)
+	}
+	// 无法读取 index 时无法确认其子 manifest 是否仍被引用，整个仓库不做删除
+	if after := remainingDigests(t, svc, "saas/api"); !reflect.DeepEqual(after, before) {
+		t.Errorf("saas/api contains %v after a failed manifest fetch, want %v", after, before)
+	}
+}
+
+// failingListRegistry 的 DescribeRepositoriesPages 总是失败
+type failingListRegistry struct {
+	ecr.Registry
+}
+
+func (failingListRegistry) DescribeRepositoriesPages(*awsecr.DescribeRepositoriesInput, func(*awsecr.DescribeRepositoriesOutput, bool) bool) error {
+	return errors.New("AccessDeniedException: not authorized")
+}
+
+func TestCleanReturnsErrorWhenListingRepositoriesFails(t *testing.T) {
+	mem, err := ecr.LoadMemoryRegistry("testdata/registry.json", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := testConfig(t)
+	store, err := state.Load(cfg.StateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 获取仓库列表失败时返回带错误的汇总而不是直接退出，Run 据此在写回状态后再退出
+	summary := Clean(io.Discard, cfg, failingListRegistry{mem}, testAccountID, nil, store)
+	if summary.Err == nil || !strings.Contains(summary.Err.Error(), "not authorized") {
+		t.Fatalf("summary error = %v, want the listing failure", summary.Err)
+	}
+	if summary.Outcome != summary.Err.Error() {
+		t.Errorf("outcome = %q, want %q", summary.Outcome, summary.Err.Error())
+	}
+}
@@ -0,0 +1,105 @@
+// aws-ecr-cleaner/internal/cleaner/empty.go
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+	"aws-ecr-cleaner/internal/state"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// checkEmptyRepository 按 DELETE_EMPTY_REPOS 规则判断空仓库是否可以删除，过程信息写入 out
+// 仓库需创建满 EMPTY_REPO_MIN_AGE_HOURS、且（跨运行）持续为空满 EMPTY_REPO_MIN_EMPTY_HOURS 才会删除。
+// 返回值为保留该仓库的原因，为空表示可以删除；删除在确认后由 deleteEmptyRepository 执行
+func checkEmptyRepository(out io.Writer, cfg *config.Config, repo *awsecr.Repository, store *state.Store, now time.Time) string {
+	repoName := aws.StringValue(repo.RepositoryName)
+	if !cfg.DeleteEmptyRepos {
+		fmt.Fprintf(out, "  [Kept] Empty repository %s: empty repository deletion is disabled (DELETE_EMPTY_REPOS)\n", repoName)
+		return "deletion disabled"
+	}
+
+	key := state.RepoKey(cfg.AccountID, cfg.AWSRegion, repoName)
+	emptySince := store.MarkEmpty(key, now)
+	createdAt := aws.TimeValue(repo.CreatedAt)
+	minAge := time.Duration(cfg.EmptyRepoMinAgeHours) * time.Hour
+	minEmpty := time.Duration(cfg.EmptyRepoMinEmptyHours) * time.Hour
+
+	var kept string
+	switch {
+	case now.Sub(createdAt) < minAge:
+		kept = fmt.Sprintf("created %s, younger than %d hours", createdAt.Format("2006-01-02T15:04:05Z"), cfg.EmptyRepoMinAgeHours)
+	case now.Sub(emptySince) < minEmpty:
+		kept = fmt.Sprintf("empty since %s, less than %d hours", emptySince.Format("2006-01-02T15:04:05Z"), cfg.EmptyRepoMinEmptyHours)
+	case cfg.ListOnly:
+		kept = "list-only mode"
+	}
+	if kept != "" {
+		fmt.Fprintf(out, "  [Kept] Empty repository %s: %s\n", repoName, kept)
+		return kept
+	}
+	fmt.Fprintf(out, "  [Candidate] Empty repository %s (empty since %s)\n", repoName, emptySince.Format("2006-01-02T15:04:05Z"))
+	return ""
+}
+
+// deleteEmptyRepository 导出仓库设置后删除空仓库，导出失败时不删除
+// 删除不使用 Force：检查之后又推送了镜像的仓库由 ECR 拒绝删除，返回值 kept 为其原因；kept 为空表示已删除（dry-run 下为将删除）
+func deleteEmptyRepository(out io.Writer, cfg *config.Config, svc ecr.Registry, repo *awsecr.Repository, store *state.Store, now time.Time) (string, error) {
+	repoName := aws.StringValue(repo.RepositoryName)
+	backupPath := repoBackupPath(cfg, repoName, now)
+	if cfg.DryRun {
+		fmt.Fprintf(out, "[Dry-run] Would export settings of repository %s to %s\n", repoName, backupPath)
+		fmt.Fprintf(out, "[Dry-run] Would delete repository: %s\n", repoName)
+		return "", nil
+	}
+	if err := backupRepository(svc, repo, backupPath, now); err != nil {
+		fmt.Fprintf(out, "Error exporting settings of repository %s, not deleting: %v\n", repoName, err)
+		return "", fmt.Errorf("settings export failed: %w", err)
+	}
+	fmt.Fprintf(out, "Exported settings of repository %s to %s\n", repoName, backupPath)
+	key := state.RepoKey(cfg.AccountID, cfg.AWSRegion, repoName)
+	err := ecr.DeleteEmptyRepository(svc, repoName)
+	if errors.Is(err, ecr.ErrRepositoryNotEmpty) {
+		fmt.Fprintf(out, "  [Kept] Repository %s is no longer empty, not deleting\n", repoName)
+		store.ClearEmpty(key)
+		return "no longer empty (images pushed after the scan)", nil
+	}
+	if err != nil {
+		fmt.Fprintf(out, "Error deleting repository %s: %v\n", repoName, err)
+		return "", err
+	}
+	fmt.Fprintf(out, "Deleted repository: %s\n", repoName)
+	store.ClearEmpty(key)
+	return "", nil
+}
+
+// repoBackupPath 返回仓库设置的导出路径：<REPO_BACKUP_DIR>/<账户>/<区域>/<仓库名>_YYYYMMDD_HHMMSS.json
+func repoBackupPath(cfg *config.Config, repoName string, now time.Time) string {
+	fileName := fmt.Sprintf("%s_%s.json", strings.ReplaceAll(repoName, "/", "_"), now.Format("20060102_150405"))
+	return filepath.Join(cfg.RepoBackupDir, cfg.AccountID, cfg.AWSRegion, fileName)
+}
+
+// backupRepository 导出仓库设置并写入 path
+func backupRepository(svc ecr.Registry, repo *awsecr.Repository, path string, now time.Time) error {
+	backup, err := ecr.ExportRepository(svc, repo, now)
+	if err != nil {
+		return err
+	}
+	data, err := backup.JSON()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
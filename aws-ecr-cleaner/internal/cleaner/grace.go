@@ -0,0 +1,136 @@
+// aws-ecr-cleaner/internal/cleaner/grace.go
+package cleaner
+
+import (
+	"fmt"
+	"time"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+	"aws-ecr-cleaner/internal/state"
+	"aws-ecr-cleaner/internal/util"
+)
+
+// scheduledImage 是已标记、仍在删除宽限期内的候选镜像
+type scheduledImage struct {
+	ecr.Candidate
+	MarkedAt time.Time // 首次被标记为候选的时间
+	DeleteOn time.Time // 持续为候选时最早可删除的时间
+	Deferred string    // 已到期但所属 index 或 subject 仍在宽限期内时推迟的原因
+}
+
+// schedule 返回计划删除时间的说明
+func (s scheduledImage) schedule() string {
+	if s.Deferred != "" {
+		return "deletion deferred: " + s.Deferred + " is scheduled"
+	}
+	return "scheduled for deletion on " + s.DeleteOn.Format("2006-01-02")
+}
+
+// protectFunc 对一个仓库的候选重新应用 index 子 manifest 与制品的保护，返回仍可删除的候选与因此保留的镜像
+type protectFunc func([]ecr.Candidate) ([]ecr.Candidate, []ecr.Retained)
+
+// markCandidates 标记阶段：以本次扫描的候选同步仓库的删除标记，返回已满 DELETE_GRACE_DAYS 可以删除的候选与仍在宽限期内的候选
+// 此前已标记、本次不再是候选的镜像（已在使用、命中保留 tag 或已不存在）自动取消标记，记录在 scan.unmarked 中
+// protect 对到期候选重新应用 index 子 manifest 与制品的保护，使其跟随仍在宽限期内的 index 与 subject
+// 未启用宽限期时清除仓库遗留的标记，候选原样返回
+func markCandidates(scan *repoScan, cfg *config.Config, store *state.Store, candidates []ecr.Candidate, protect protectFunc, now time.Time) ([]ecr.Candidate, []scheduledImage) {
+	key := state.RepoKey(cfg.AccountID, cfg.AWSRegion, scan.repoName)
+	if cfg.DeleteGraceDays <= 0 {
+		store.ClearMarks(key)
+		return candidates, nil
+	}
+
+	digests := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		digests = append(digests, c.ImageDigest)
+	}
+	marks, unmarked := store.SyncMarks(key, digests, now)
+	addUnmarked(scan, cfg, unmarked)
+
+	grace := days(cfg.DeleteGraceDays)
+	var due []ecr.Candidate
+	var pending []scheduledImage
+	for _, c := range candidates {
+		markedAt := marks[c.ImageDigest]
+		deleteOn := markedAt.Add(grace)
+		if !now.Before(deleteOn) {
+			due = append(due, c)
+			continue
+		}
+		pending = append(pending, scheduledImage{Candidate: c, MarkedAt: markedAt, DeleteOn: deleteOn})
+	}
+	if len(pending) == 0 || protect == nil {
+		return due, pending
+	}
+
+	// 到期的镜像可能是宽限期内 index 的子 manifest 或 subject 的制品；subject 到期时其制品也会被重新加入
+	due, deferred := protect(due)
+	deleting := make(map[string]bool, len(due))
+	for _, c := range due {
+		deleting[c.ImageDigest] = true
+	}
+	var scheduled []scheduledImage
+	for _, s := range pending {
+		if !deleting[s.ImageDigest] {
+			scheduled = append(scheduled, s)
+		}
+	}
+	byDigest := make(map[string]ecr.Candidate, len(candidates))
+	for _, c := range candidates {
+		byDigest[c.ImageDigest] = c
+	}
+	for _, r := range deferred {
+		c, ok := byDigest[r.ImageDigest]
+		if !ok {
+			continue
+		}
+		markedAt := marks[c.ImageDigest]
+		scheduled = append(scheduled, scheduledImage{Candidate: c, MarkedAt: markedAt, DeleteOn: markedAt.Add(grace), Deferred: r.Reason})
+	}
+	return due, scheduled
+}
+
+// clearMarks 清除不再参与清理的仓库（为空、通过 tag 退出或未被选中）的全部删除标记
+func clearMarks(scan *repoScan, cfg *config.Config, store *state.Store) {
+	addUnmarked(scan, cfg, store.ClearMarks(state.RepoKey(cfg.AccountID, cfg.AWSRegion, scan.repoName)))
+}
+
+// addUnmarked 记录取消标记的镜像，原因取自本次扫描的保留记录
+func addUnmarked(scan *repoScan, cfg *config.Config, digests []string) {
+	if len(digests) == 0 {
+		return
+	}
+	reasons := make(map[string]ecr.Retained, len(scan.retained))
+	for _, r := range scan.retained {
+		reasons[r.ImageDigest] = r
+	}
+	scannedTags := make(map[string][]string, len(scan.scanned))
+	for _, s := range scan.scanned {
+		scannedTags[s.ImageDigest] = s.ImageTags
+	}
+	for _, d := range digests {
+		r, ok := reasons[d]
+		tags, exists := scannedTags[d]
+		if !ok {
+			r.ImageTags = tags
+		}
+		switch {
+		case ok:
+		case scan.overrides.Skip:
+			r.Reason = "repository opted out via tag " + config.RepoTagSkip
+		case scan.notSelected:
+			r.Reason = "repository no longer selected by TARGET_REPO_TAGS"
+		case !exists:
+			r.Reason = "image no longer exists"
+		case len(tags) > 0 && util.HoldTagMatch(fmt.Sprintf("%s", tags), cfg.HoldTagRegex):
+			r.Reason = "held by HOLD_TAG_REGEX"
+		default:
+			r.Reason = "no longer a candidate (in use, held or kept by rules)"
+		}
+		r.RepositoryName = scan.repoName
+		r.ImageDigest = d
+		scan.printf("  [Unmarked] Digest: %s, Tags: %v, Reason: %s\n", d, r.ImageTags, r.Reason)
+		scan.unmarked = append(scan.unmarked, r)
+	}
+}
@@ -0,0 +1,275 @@
+// aws-ecr-cleaner/internal/cleaner/lifecycle.go
+package cleaner
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+	"aws-ecr-cleaner/internal/util"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// 生命周期策略预览的轮询间隔与超时
+const (
+	lifecyclePreviewPoll    = 5 * time.Second
+	lifecyclePreviewTimeout = 5 * time.Minute
+)
+
+// LifecycleOptions 是 lifecycle 子命令的参数
+type LifecycleOptions struct {
+	Apply     bool // 预览后写入策略
+	Overwrite bool // 不经逐仓库确认覆盖内容不同的已有策略
+}
+
+// lifecycleResult 记录单个仓库的预览与应用结果
+type lifecycleResult struct {
+	region     string
+	accountID  string
+	repoName   string
+	expiring   int
+	previewErr error
+	applied    bool
+	applyErr   error
+
+	policyText string // 写入该仓库的策略；仓库 tag 覆盖了清理策略时与账户策略不同
+	skipped    string // 仓库不写入策略的原因（通过 tag 退出、tag 覆盖非法或未确认覆盖已有策略）
+	unchanged  bool   // 已有策略与编译出的策略相同，无需写入
+}
+
+// RunLifecycle 将各账户、各区域的清理规则编译为 ECR 生命周期策略，对匹配的仓库预览效果，opts.Apply 为 true 时写入策略
+func RunLifecycle(cfg *config.Config, opts LifecycleOptions) {
+	log.Println("Starting AWS ECR Cleaner (lifecycle)...")
+
+	targets, failures, err := resolveTargets(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize registry: %v", err)
+	}
+	validateAccountOverrides(cfg, targets)
+
+	var results []lifecycleResult
+	for _, t := range targets {
+		acfg := cfg.ForAccount(t.accountID)
+		acfg.AWSRegion = t.region
+		results = append(results, lifecycleTarget(acfg, t, opts)...)
+	}
+
+	fmt.Println("\n-------------------------------")
+	fmt.Println("Lifecycle Summary:")
+	for _, r := range results {
+		status := "preview only"
+		switch {
+		case r.skipped != "":
+			status = "skipped: " + r.skipped
+		case r.previewErr != nil:
+			status = fmt.Sprintf("preview failed: %v", r.previewErr)
+		case r.applyErr != nil:
+			status = fmt.Sprintf("apply failed: %v", r.applyErr)
+		case r.unchanged:
+			status = "existing policy unchanged"
+		case r.applied && cfg.DryRun:
+			status = "would apply (dry-run)"
+		case r.applied:
+			status = "applied"
+		}
+		fmt.Printf("  [Repository] %s / %s / %s: %d images would expire, %s\n", r.region, r.accountID, r.repoName, r.expiring, status)
+	}
+	for _, f := range failures {
+		fmt.Printf("  [Failed] Source: %s, Reason: %v\n", f.source, f.err)
+	}
+}
+
+// lifecycleTarget 处理单个账户与区域：编译策略、逐仓库预览并按需应用
+// 仓库资源 tag 的覆盖与清理时一致：通过 tag 退出的仓库不写入策略，覆盖了清理策略的仓库使用单独编译的策略
+func lifecycleTarget(cfg *config.Config, t target, opts LifecycleOptions) []lifecycleResult {
+	targetECR := fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com", t.accountID, t.region)
+	fmt.Println("\n===============================")
+	fmt.Printf("Region: %s, Account: %s (source: %s)\n", t.region, t.accountID, t.source)
+
+	policyText, unexpressible := compileLifecycle(cfg)
+	fmt.Printf("Compiled lifecycle policy:\n%s\n", policyText)
+	printUnexpressible(unexpressible)
+
+	repos, err := ecr.GetRepositories(t.svc, cfg.TargetRepoRegex, cfg.Debug)
+	if err != nil {
+		fmt.Printf("Error fetching repositories: %v\n", err)
+		return nil
+	}
+	targetRepos := selectRepositories(cfg, repos, targetECR)
+	if len(targetRepos) == 0 {
+		fmt.Println("No repositories found matching the provided pattern.")
+		return nil
+	}
+
+	var results []lifecycleResult
+	for _, repo := range targetRepos {
+		repoName := aws.StringValue(repo.RepositoryName)
+		r := lifecycleResult{region: t.region, accountID: t.accountID, repoName: repoName, policyText: policyText}
+		repoTags, err := ecr.GetRepositoryTags(t.svc, aws.StringValue(repo.RepositoryArn))
+		if err != nil {
+			fmt.Printf("\nError fetching tags for repository %s: %v\n", repoName, err)
+			r.previewErr = err
+			results = append(results, r)
+			continue
+		}
+		if !cfg.RepoTagSelector.Matches(repoTags) {
+			continue
+		}
+		fmt.Printf("\nRepository: %s (URI: %s)\n", repoName, aws.StringValue(repo.RepositoryUri))
+
+		rcfg, overrides, err := cfg.ForRepository(repoTags)
+		if err != nil {
+			fmt.Printf("Invalid repository tag override for %s, not updating its lifecycle policy: %v\n", repoName, err)
+			r.skipped = fmt.Sprintf("invalid repository tag override: %v", err)
+			results = append(results, r)
+			continue
+		}
+		if len(overrides.Applied) > 0 {
+			fmt.Printf("  [Overrides] %v\n", overrides.Applied)
+		}
+		if overrides.Skip {
+			fmt.Printf("Repository %s opted out via tag %s. Skipping.\n", repoName, config.RepoTagSkip)
+			r.skipped = "opted out via tag " + config.RepoTagSkip
+			results = append(results, r)
+			continue
+		}
+		if len(overrides.Applied) > 0 {
+			var repoUnexpressible []string
+			r.policyText, repoUnexpressible = compileLifecycle(rcfg)
+			if r.policyText != policyText {
+				fmt.Printf("Compiled lifecycle policy for repository %s:\n%s\n", repoName, r.policyText)
+				printUnexpressible(repoUnexpressible)
+			}
+		}
+
+		preview, err := ecr.PreviewLifecyclePolicy(t.svc, repoName, r.policyText, lifecyclePreviewPoll, lifecyclePreviewTimeout)
+		if err != nil {
+			fmt.Printf("Error previewing lifecycle policy for repository %s: %v\n", repoName, err)
+			r.previewErr = err
+			results = append(results, r)
+			continue
+		}
+		r.expiring = len(preview)
+		for _, p := range preview {
+			fmt.Printf("  [Expire] Tags: %v, Digest: %s, PushedAt: %s, Rule: %d\n", aws.StringValueSlice(p.ImageTags), aws.StringValue(p.ImageDigest), aws.TimeValue(p.ImagePushedAt).Format("2006-01-02T15:04:05Z"), aws.Int64Value(p.AppliedRulePriority))
+		}
+		if len(preview) == 0 {
+			fmt.Println("  No images would expire.")
+		}
+		results = append(results, r)
+	}
+
+	if !opts.Apply {
+		return results
+	}
+
+	// 写入生命周期策略后 ECR 会自动过期镜像，非自动确认模式下需要交互确认
+	reader := bufio.NewReader(os.Stdin)
+	if !cfg.AutoConfirm && !confirm(reader, "\nApply the above lifecycle policy to these repositories? (y/n): ") {
+		fmt.Println("Aborting lifecycle policy update.")
+		return results
+	}
+	for i := range results {
+		r := &results[i]
+		if r.previewErr != nil || r.skipped != "" {
+			continue
+		}
+
+		// 已有策略（可能是手写的）与编译出的策略不同时输出 diff，需逐仓库确认或使用 -overwrite 才覆盖
+		existing, err := ecr.GetLifecyclePolicyText(t.svc, r.repoName)
+		if err != nil {
+			fmt.Printf("Error fetching existing lifecycle policy of repository %s, not updating: %v\n", r.repoName, err)
+			r.applyErr = err
+			continue
+		}
+		if existing != "" {
+			existing = ecr.FormatPolicyText(existing)
+			if existing == r.policyText {
+				fmt.Printf("Lifecycle policy of repository %s is already up to date\n", r.repoName)
+				r.unchanged = true
+				continue
+			}
+			fmt.Printf("\nRepository %s has a different lifecycle policy (- existing, + compiled):\n", r.repoName)
+			for _, line := range util.LineDiff(existing, r.policyText) {
+				fmt.Println(line)
+			}
+			if !opts.Overwrite {
+				if cfg.AutoConfirm || !confirm(reader, fmt.Sprintf("Overwrite the existing lifecycle policy of repository %s? (y/n): ", r.repoName)) {
+					fmt.Printf("Keeping the existing lifecycle policy of repository %s (use -overwrite to replace it)\n", r.repoName)
+					r.skipped = "existing lifecycle policy differs and overwrite was not confirmed"
+					continue
+				}
+			}
+		}
+
+		r.applied = true
+		if cfg.DryRun {
+			fmt.Printf("[Dry-run] Would put lifecycle policy on repository: %s\n", r.repoName)
+			continue
+		}
+		if err := ecr.PutLifecyclePolicy(t.svc, r.repoName, r.policyText); err != nil {
+			fmt.Printf("Error putting lifecycle policy on repository %s: %v\n", r.repoName, err)
+			r.applyErr = err
+			continue
+		}
+		fmt.Printf("Put lifecycle policy on repository: %s\n", r.repoName)
+	}
+	return results
+}
+
+// confirm 输出提示并读取一行输入，输入 y 时返回 true
+func confirm(reader *bufio.Reader, prompt string) bool {
+	fmt.Print(prompt)
+	input, err := reader.ReadString('\n')
+	if err != nil {
+		log.Fatalf("Failed to read input: %v", err)
+	}
+	return strings.ToLower(strings.TrimSpace(input)) == "y"
+}
+
+// compileLifecycle 将配置中的清理规则编译为生命周期策略文本，并返回无法表达的规则说明
+func compileLifecycle(cfg *config.Config) (string, []string) {
+	policy, unexpressible := ecr.CompileLifecyclePolicy(ecr.LifecycleRules{
+		HoldTagRegex:      cfg.HoldTagRegex,
+		ProtectLatest:     cfg.ProtectLatest,
+		ProtectInUse:      cfg.ProtectInUseByK8s,
+		DeleteMode:        cfg.DeleteMode,
+		ProtectPulledDays: cfg.ProtectPulledDays,
+		IdlePullDays:      cfg.IdlePullDays,
+
+		DeleteGraceDays: cfg.DeleteGraceDays,
+
+		MinImageAgeHours: cfg.MinImageAgeHours,
+		MaxImageAgeDays:  cfg.MaxImageAgeDays,
+
+		KeepLatestTagged:   cfg.KeepLatestTagged,
+		KeepLatestUntagged: cfg.KeepLatestUntagged,
+
+		TagGroupRules:    cfg.TagGroupRules,
+		SemverKeepMinors: cfg.SemverKeepMinors,
+
+		RepoHoldTagRegex: cfg.RepoHoldTagRegex,
+	})
+	policyText, err := policy.JSON()
+	if err != nil {
+		log.Fatalf("Failed to encode lifecycle policy: %v", err)
+	}
+	return policyText, unexpressible
+}
+
+// printUnexpressible 输出无法由生命周期策略表达的规则
+func printUnexpressible(unexpressible []string) {
+	if len(unexpressible) == 0 {
+		return
+	}
+	fmt.Println("Rules not expressible as lifecycle policy (still require running the cleaner):")
+	for _, u := range unexpressible {
+		fmt.Printf("  [Not expressible] %s\n", u)
+	}
+}
@@ -0,0 +1,324 @@
+// aws-ecr-cleaner/internal/cleaner/quarantine.go
+package cleaner
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// quarantineCandidates 在删除前将按 digest 删除的候选镜像复制到隔离仓库，返回可以继续删除的候选（复制失败的候选保留）
+// 最多 SCAN_CONCURRENCY 个镜像同时复制；复制失败的 index 与 subject 保留时，其子 manifest 与制品经 protects 中对应仓库的保护一并保留
+// 只移除 tag 的候选不删除镜像内容，无需隔离；未设置 QUARANTINE_REPO 时原样返回
+func quarantineCandidates(out io.Writer, cfg *config.Config, svc ecr.Registry, summary *Summary, candidates []ecr.Candidate, protects map[string]protectFunc, now time.Time) []ecr.Candidate {
+	if cfg.QuarantineRepo == "" {
+		return candidates
+	}
+	var toCopy []int
+	for i, c := range candidates {
+		if c.RemovesManifest(cfg.DeleteMode) {
+			toCopy = append(toCopy, i)
+		}
+	}
+	if len(toCopy) == 0 {
+		return candidates
+	}
+
+	fmt.Fprintln(out, "\n-------------------------------")
+	if cfg.DryRun {
+		fmt.Fprintf(out, "[Dry-run] Would copy %d images to quarantine repository %s before deletion\n", len(toCopy), cfg.QuarantineRepo)
+		return candidates
+	}
+	fmt.Fprintf(out, "Copying %d images to quarantine repository %s before deletion...\n", len(toCopy), cfg.QuarantineRepo)
+
+	if err := ensureQuarantineRepository(out, svc, cfg.QuarantineRepo); err != nil {
+		fmt.Fprintf(out, "Error preparing quarantine repository %s: %v, not deleting %d images\n", cfg.QuarantineRepo, err, len(toCopy))
+		for _, i := range toCopy {
+			summary.AddQuarantineFailure(candidates[i], err)
+		}
+		return reprotectCandidates(out, summary, removeCandidates(candidates, toCopy), toCopy, candidates, protects)
+	}
+
+	results := copyToQuarantine(cfg, svc, candidates, toCopy, now)
+	var failed []int
+	copied := 0
+	for j, i := range toCopy {
+		c := candidates[i]
+		if err := results[j].err; err != nil {
+			fmt.Fprintf(out, "Error copying image (Digest %s, Tags %v) in repository %s to quarantine, not deleting: %v\n", c.ImageDigest, c.ImageTags, c.RepositoryName, err)
+			summary.AddQuarantineFailure(c, err)
+			failed = append(failed, i)
+			continue
+		}
+		fmt.Fprintf(out, "Quarantined image (Digest %s, Tags %v) in repository %s as %v\n", c.ImageDigest, c.ImageTags, c.RepositoryName, results[j].tags)
+		copied++
+	}
+	if copied > 0 {
+		summary.AddQuarantined(copied, cfg.QuarantineRepo)
+	}
+	return reprotectCandidates(out, summary, removeCandidates(candidates, failed), failed, candidates, protects)
+}
+
+// quarantineResult 是单个候选复制到隔离仓库的结果
+type quarantineResult struct {
+	tags []string
+	err  error
+}
+
+// copyToQuarantine 使用最多 SCAN_CONCURRENCY 个 worker 并发复制 toCopy 指向的候选，结果与 toCopy 顺序一致
+func copyToQuarantine(cfg *config.Config, svc ecr.Registry, candidates []ecr.Candidate, toCopy []int, now time.Time) []quarantineResult {
+	results := make([]quarantineResult, len(toCopy))
+	concurrency := cfg.ScanConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(toCopy) {
+		concurrency = len(toCopy)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				tags, err := ecr.QuarantineImage(svc, candidates[toCopy[j]], cfg.QuarantineRepo, now)
+				results[j] = quarantineResult{tags: tags, err: err}
+			}
+		}()
+	}
+	for j := range toCopy {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// reprotectCandidates 移除 dropped 指向的候选后，对涉及的仓库重新应用 index 子 manifest 与制品的保护
+// 保护只会从 remaining 中移除候选：制品传播重新加入的镜像未经隔离，不会删除
+func reprotectCandidates(out io.Writer, summary *Summary, remaining []ecr.Candidate, dropped []int, candidates []ecr.Candidate, protects map[string]protectFunc) []ecr.Candidate {
+	repos := make(map[string]bool)
+	for _, i := range dropped {
+		repos[candidates[i].RepositoryName] = true
+	}
+	if len(repos) == 0 {
+		return remaining
+	}
+
+	byRepo := make(map[string][]ecr.Candidate)
+	for _, c := range remaining {
+		if repos[c.RepositoryName] {
+			byRepo[c.RepositoryName] = append(byRepo[c.RepositoryName], c)
+		}
+	}
+	reasons := make(map[string]string)
+	keep := make(map[string]bool, len(remaining))
+	for _, c := range remaining {
+		if !repos[c.RepositoryName] {
+			keep[c.RepositoryName+"@"+c.ImageDigest] = true
+		}
+	}
+	for repoName, repoCandidates := range byRepo {
+		protect := protects[repoName]
+		if protect == nil {
+			for _, c := range repoCandidates {
+				keep[repoName+"@"+c.ImageDigest] = true
+			}
+			continue
+		}
+		protected, retained := protect(append([]ecr.Candidate(nil), repoCandidates...))
+		for _, c := range protected {
+			keep[repoName+"@"+c.ImageDigest] = true
+		}
+		for _, r := range retained {
+			reasons[repoName+"@"+r.ImageDigest] = r.Reason
+		}
+	}
+
+	var kept []ecr.Candidate
+	for _, c := range remaining {
+		if keep[c.RepositoryName+"@"+c.ImageDigest] {
+			kept = append(kept, c)
+			continue
+		}
+		reason := reasons[c.RepositoryName+"@"+c.ImageDigest]
+		if reason == "" {
+			reason = "protected after a quarantine failure"
+		}
+		err := fmt.Errorf("%s (not quarantined)", reason)
+		fmt.Fprintf(out, "Keeping image (Digest %s, Tags %v) in repository %s: %v\n", c.ImageDigest, c.ImageTags, c.RepositoryName, err)
+		summary.AddQuarantineFailure(c, err)
+	}
+	return kept
+}
+
+// ensureQuarantineRepository 隔离仓库不存在时以默认设置创建；tag 中含删除日期，同一源 tag 可能再次隔离，因此使用可变 tag
+func ensureQuarantineRepository(out io.Writer, svc ecr.Registry, name string) error {
+	repo, err := ecr.GetRepository(svc, name)
+	if err != nil || repo != nil {
+		return err
+	}
+	repo, err = ecr.RecreateRepository(svc, name, &ecr.RepositoryBackup{ImageTagMutability: awsecr.ImageTagMutabilityMutable})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Created quarantine repository %s (URI: %s)\n", name, aws.StringValue(repo.RepositoryUri))
+	return nil
+}
+
+// excludeQuarantineRepository 从目标仓库中去掉隔离仓库，隔离的镜像只由 purge 子命令按保留期删除
+func excludeQuarantineRepository(cfg *config.Config, repos []*awsecr.Repository) []*awsecr.Repository {
+	if cfg.QuarantineRepo == "" {
+		return repos
+	}
+	var kept []*awsecr.Repository
+	for _, repo := range repos {
+		if aws.StringValue(repo.RepositoryName) != cfg.QuarantineRepo {
+			kept = append(kept, repo)
+		}
+	}
+	return kept
+}
+
+// RunPurge 删除各账户、各区域隔离仓库中超过 QUARANTINE_RETENTION_DAYS 的镜像
+func RunPurge(cfg *config.Config) {
+	log.Println("Starting AWS ECR Cleaner (purge)...")
+	if cfg.QuarantineRepo == "" {
+		log.Fatalf("QUARANTINE_REPO is not set")
+	}
+
+	targets, failures, err := resolveTargets(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize registry: %v", err)
+	}
+	validateAccountOverrides(cfg, targets)
+
+	var summaries []string
+	for _, t := range targets {
+		acfg := cfg.ForAccount(t.accountID)
+		acfg.AWSRegion = t.region
+		summaries = append(summaries, purgeTarget(acfg, t, time.Now()))
+	}
+
+	fmt.Println("\n-------------------------------")
+	fmt.Println("Purge Summary:")
+	for _, s := range summaries {
+		fmt.Printf("  %s\n", s)
+	}
+	for _, f := range failures {
+		fmt.Printf("  [Failed] Source: %s, Reason: %v\n", f.source, f.err)
+	}
+}
+
+// purgeTarget 处理单个账户与区域的隔离仓库，返回汇总行
+// 仍保留的 index 引用的子 manifest 不会删除
+func purgeTarget(cfg *config.Config, t target, now time.Time) string {
+	fmt.Println("\n===============================")
+	fmt.Printf("Region: %s, Account: %s (source: %s)\n", t.region, t.accountID, t.source)
+	label := fmt.Sprintf("[Repository] %s / %s / %s", t.region, t.accountID, cfg.QuarantineRepo)
+
+	repo, err := ecr.GetRepository(t.svc, cfg.QuarantineRepo)
+	if err != nil {
+		fmt.Printf("Error describing quarantine repository %s: %v\n", cfg.QuarantineRepo, err)
+		return fmt.Sprintf("%s: failed: %v", label, err)
+	}
+	if repo == nil {
+		fmt.Printf("Quarantine repository %s does not exist.\n", cfg.QuarantineRepo)
+		return label + ": not found"
+	}
+	images, err := ecr.GetImages(t.svc, cfg.QuarantineRepo, cfg.Debug)
+	if err != nil {
+		fmt.Printf("Error fetching images for repository %s: %v\n", cfg.QuarantineRepo, err)
+		return fmt.Sprintf("%s: failed: %v", label, err)
+	}
+
+	expired, kept := ecr.ExpiredQuarantineImages(images, aws.StringValue(repo.RepositoryUri), days(cfg.QuarantineRetentionDays), now)
+	if indexDigests := ecr.IndexDigests(images); len(indexDigests) > 0 {
+		manifests, err := ecr.GetManifests(t.svc, cfg.QuarantineRepo, indexDigests, cfg.Debug)
+		if err != nil {
+			fmt.Printf("Error fetching manifests for repository %s: %v\n", cfg.QuarantineRepo, err)
+			return fmt.Sprintf("%s: failed: %v", label, err)
+		}
+		var protected []ecr.Retained
+		expired, protected = ecr.ProtectIndexChildren(expired, ecr.BuildManifestGraph(manifests), ecr.DeleteModeDigest)
+		kept = append(kept, protected...)
+	}
+	for _, r := range kept {
+		fmt.Printf("  [Kept] Tags: %v, Digest: %s, Reason: %s\n", r.ImageTags, r.ImageDigest, r.Reason)
+	}
+	for _, c := range expired {
+		fmt.Printf("  [Expired] Tags: %v, Digest: %s, PushedAt: %s\n", c.ImageTags, c.ImageDigest, c.PushTime.Format("2006-01-02T15:04:05Z"))
+	}
+	if len(expired) == 0 {
+		fmt.Printf("No images older than %d days in quarantine.\n", cfg.QuarantineRetentionDays)
+		return fmt.Sprintf("%s: %d kept, 0 expired", label, len(kept))
+	}
+
+	if !cfg.AutoConfirm {
+		fmt.Print("\nPermanently delete the above quarantined images? (y/n): ")
+		reader := bufio.NewReader(os.Stdin)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			log.Fatalf("Failed to read input: %v", err)
+		}
+		if strings.ToLower(strings.TrimSpace(input)) != "y" {
+			fmt.Println("Aborting purge.")
+			return fmt.Sprintf("%s: %d kept, %d expired, aborted", label, len(kept), len(expired))
+		}
+	}
+	results := ecr.DeleteImages(t.svc, expired, ecr.DeleteModeDigest, cfg.DryRun, cfg.Debug)
+	deleted := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("Error deleting image (Digest %s, Tags %v) in repository %s: %v\n", r.Candidate.ImageDigest, r.Candidate.ImageTags, cfg.QuarantineRepo, r.Err)
+			continue
+		}
+		deleted++
+	}
+	verb := "purged"
+	if cfg.DryRun {
+		verb = "would purge"
+	}
+	return fmt.Sprintf("%s: %d kept, %s %d, failed %d", label, len(kept), verb, deleted, len(results)-deleted)
+}
+
+// findQuarantinedImage 在隔离仓库中查找源仓库的镜像（按 tag 或 digest），同一镜像多次隔离时取删除日期最近的一次
+// 返回镜像 digest 与匹配的隔离 tag，未找到时 digest 为空
+func findQuarantinedImage(cfg *config.Config, svc ecr.Registry, repoName, ref string) (string, string, error) {
+	repo, err := ecr.GetRepository(svc, cfg.QuarantineRepo)
+	if err != nil || repo == nil {
+		return "", "", err
+	}
+	images, err := ecr.GetImages(svc, cfg.QuarantineRepo, cfg.Debug)
+	if err != nil {
+		return "", "", err
+	}
+	var digest, match string
+	var latest time.Time
+	for _, image := range images {
+		d := aws.StringValue(image.ImageDigest)
+		if strings.HasPrefix(ref, "sha256:") && d != ref {
+			continue
+		}
+		for _, tag := range aws.StringValueSlice(image.ImageTags) {
+			date, _ := ecr.ParseQuarantineDate(tag)
+			if ecr.MatchQuarantineTag(tag, repoName, ref) && (digest == "" || date.After(latest)) {
+				digest, match, latest = d, tag, date
+			}
+		}
+	}
+	return digest, match, nil
+}
@@ -0,0 +1,526 @@
+// aws-ecr-cleaner/internal/cleaner/report.go
+package cleaner
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+)
+
+// 单个账户清理流程的结束状态
+const (
+	OutcomeCompleted      = "completed"
+	OutcomeListOnly       = "list only"
+	OutcomeAborted        = "aborted"
+	OutcomeNoRepositories = "no matching repositories"
+)
+
+// Summary 汇总一次运行的删除结果，在流程结束时输出
+type Summary struct {
+	DryRun          bool
+	Outcome         string
+	Err             error // 使该账户提前结束的错误（获取仓库列表或读取确认输入失败），由 Run 在写回状态后处理
+	Deleted         []ecr.DeleteResult
+	Failed          []ecr.DeleteResult
+	DeletedRepos    []string
+	FailedRepos     []string
+	SkippedRepos    []string
+	OrphanIndexes   []string // 格式为 repository@digest
+	OrphanReferrers []string // 格式为 repository@digest，subject 已不存在的制品
+	StoragePrice    float64  // 美元 / GB-月
+	repoOrder       []string
+	repoImages      map[string]int
+	repoBytes       map[string]int64
+	layerStats      map[string]ecr.LayerStats
+	repoFailReasons map[string]error
+	skipReasons     map[string]error
+
+	// LIFECYCLE_CHECK 启用时，已有生命周期策略会过期、但清理程序保留的镜像（格式为 repository@digest）
+	LifecycleConflicts []string
+	LifecycleWarnings  []string // 已有生命周期策略会过期的 in-use 镜像
+	lifecycleExpiring  map[string]int
+
+	repoOverrides map[string][]string // 仓库资源 tag 中生效的覆盖
+	optedOut      []string            // 通过 tag 选择不参与清理的仓库
+	overrideOrder []string
+
+	keptEmptyRepos []string // 格式为 repository: 原因
+
+	archivedImages int      // 删除前已归档并校验的镜像数量
+	archivePaths   []string // 归档写入的 layout 目录或 tar 文件
+	archiveFailed  []string // 归档失败而保留的镜像及原因
+
+	quarantinedImages int      // 删除前已复制到隔离仓库的镜像数量
+	quarantineRepo    string   // 隔离仓库名
+	quarantineFailed  []string // 复制到隔离仓库失败而保留的镜像及原因
+
+	nothingToUntag []ecr.Candidate // untag 模式下没有可移除 tag 而跳过的候选
+
+	GraceDays int      // DELETE_GRACE_DAYS，大于 0 时启用标记-清除
+	scheduled []string // 已标记、仍在宽限期内的镜像及计划删除日期
+	unmarked  []string // 不再是候选而取消标记的镜像及原因
+
+	kept []string // 按保留规则（TAG_GROUP_RULES / SEMVER_KEEP_* / KEEP_LATEST_TAGGED / KEEP_LATEST_UNTAGGED）保留的镜像及原因
+}
+
+// NewSummary 创建空的运行汇总
+func NewSummary(dryRun bool) *Summary {
+	return &Summary{
+		DryRun:          dryRun,
+		repoFailReasons: make(map[string]error),
+		skipReasons:     make(map[string]error),
+		repoImages:      make(map[string]int),
+		repoBytes:       make(map[string]int64),
+		layerStats:      make(map[string]ecr.LayerStats),
+
+		lifecycleExpiring: make(map[string]int),
+		repoOverrides:     make(map[string][]string),
+	}
+}
+
+// AddLayerStats 记录仓库的 layer 去重分析结果
+func (s *Summary) AddLayerStats(repoName string, stats ecr.LayerStats) {
+	s.layerStats[repoName] = stats
+}
+
+// AddRepoSize 记录仓库扫描到的镜像数量与总大小
+func (s *Summary) AddRepoSize(repoName string, images []ecr.ScannedImage) {
+	if _, ok := s.repoImages[repoName]; !ok {
+		s.repoOrder = append(s.repoOrder, repoName)
+	}
+	s.repoImages[repoName] = len(images)
+	var total int64
+	for _, img := range images {
+		total += img.Size
+	}
+	s.repoBytes[repoName] = total
+}
+
+// ScannedBytes 返回所有已扫描仓库的镜像总大小
+func (s *Summary) ScannedBytes() int64 {
+	var total int64
+	for _, b := range s.repoBytes {
+		total += b
+	}
+	return total
+}
+
+// ReclaimedBytes 返回本次运行按 digest 删除的镜像总大小；仅移除 tag 不回收存储
+func (s *Summary) ReclaimedBytes() int64 {
+	var total int64
+	for _, r := range s.Deleted {
+		if r.DigestDeleted {
+			total += r.Candidate.Size
+		}
+	}
+	return total
+}
+
+// AddDeleteResults 记录镜像删除结果
+func (s *Summary) AddDeleteResults(results []ecr.DeleteResult) {
+	for _, r := range results {
+		if errors.Is(r.Err, ecr.ErrNothingToUntag) {
+			s.nothingToUntag = append(s.nothingToUntag, r.Candidate)
+		} else if r.Err != nil {
+			s.Failed = append(s.Failed, r)
+		} else {
+			s.Deleted = append(s.Deleted, r)
+		}
+	}
+}
+
+// AddRepoDeletion 记录空仓库删除结果
+func (s *Summary) AddRepoDeletion(repoName string, err error) {
+	if err != nil {
+		s.FailedRepos = append(s.FailedRepos, repoName)
+		s.repoFailReasons[repoName] = err
+		return
+	}
+	s.DeletedRepos = append(s.DeletedRepos, repoName)
+}
+
+// AddEmptyRepoKept 记录未删除的空仓库及原因（未开启、未满最小年龄或空置时间等）
+func (s *Summary) AddEmptyRepoKept(repoName, reason string) {
+	s.keptEmptyRepos = append(s.keptEmptyRepos, repoName+": "+reason)
+}
+
+// AddArchived 记录删除前已归档并校验的镜像
+func (s *Summary) AddArchived(count int, path string) {
+	s.archivedImages += count
+	s.archivePaths = append(s.archivePaths, path)
+}
+
+// AddArchiveFailure 记录归档失败的候选镜像，这些镜像本次不会删除
+func (s *Summary) AddArchiveFailure(c ecr.Candidate, err error) {
+	s.archiveFailed = append(s.archiveFailed, fmt.Sprintf("Repository: %s, Tags: %v, Digest: %s, Reason: %v", c.RepositoryName, c.ImageTags, c.ImageDigest, err))
+}
+
+// AddQuarantined 记录删除前已复制到隔离仓库并校验的镜像
+func (s *Summary) AddQuarantined(count int, repoName string) {
+	s.quarantinedImages += count
+	s.quarantineRepo = repoName
+}
+
+// AddQuarantineFailure 记录复制到隔离仓库失败的候选镜像，这些镜像本次不会删除
+func (s *Summary) AddQuarantineFailure(c ecr.Candidate, err error) {
+	s.quarantineFailed = append(s.quarantineFailed, fmt.Sprintf("Repository: %s, Tags: %v, Digest: %s, Reason: %v", c.RepositoryName, c.ImageTags, c.ImageDigest, err))
+}
+
+// AddScheduled 记录已标记、仍在宽限期内的候选镜像
+func (s *Summary) AddScheduled(images []scheduledImage) {
+	for _, img := range images {
+		s.scheduled = append(s.scheduled, fmt.Sprintf("Repository: %s, Tags: %v, Digest: %s, marked %s, %s",
+			img.RepositoryName, img.ImageTags, img.ImageDigest, img.MarkedAt.Format("2006-01-02T15:04:05Z"), img.schedule()))
+	}
+}
+
+// AddUnmarked 记录不再是候选而取消标记的镜像
+func (s *Summary) AddUnmarked(images []ecr.Retained) {
+	for _, r := range images {
+		s.unmarked = append(s.unmarked, fmt.Sprintf("Repository: %s, Tags: %v, Digest: %s, Reason: %s", r.RepositoryName, r.ImageTags, r.ImageDigest, r.Reason))
+	}
+}
+
+// AddKept 记录按保留规则保留的镜像
+func (s *Summary) AddKept(images []ecr.Retained) {
+	for _, r := range images {
+		s.kept = append(s.kept, fmt.Sprintf("Repository: %s, Tags: %v, Digest: %s, Reason: %s", r.RepositoryName, r.ImageTags, r.ImageDigest, r.Reason))
+	}
+}
+
+// AddSkippedRepo 记录因 API 错误（重试耗尽）而未能处理的仓库
+func (s *Summary) AddSkippedRepo(repoName string, err error) {
+	if _, ok := s.skipReasons[repoName]; !ok {
+		s.SkippedRepos = append(s.SkippedRepos, repoName)
+	}
+	s.skipReasons[repoName] = err
+}
+
+// AddOrphanIndexes 记录子 manifest 已全部缺失的 index
+func (s *Summary) AddOrphanIndexes(repoName string, digests []string) {
+	for _, d := range digests {
+		s.OrphanIndexes = append(s.OrphanIndexes, repoName+"@"+d)
+	}
+}
+
+// AddOrphanReferrers 记录 subject 已不存在的签名 / 证明 / SBOM，它们会随本次清理一并删除
+func (s *Summary) AddOrphanReferrers(repoName string, referrers []ecr.Referrer) {
+	for _, ref := range referrers {
+		s.OrphanReferrers = append(s.OrphanReferrers, fmt.Sprintf("%s@%s (%s, subject %s)", repoName, ref.Digest, ref.Kind, ref.Subject))
+	}
+}
+
+// AddRepoOverrides 记录仓库资源 tag 中生效的策略覆盖
+func (s *Summary) AddRepoOverrides(repoName string, overrides config.RepoOverrides) {
+	if len(overrides.Applied) == 0 {
+		return
+	}
+	s.overrideOrder = append(s.overrideOrder, repoName)
+	s.repoOverrides[repoName] = overrides.Applied
+	if overrides.Skip {
+		s.optedOut = append(s.optedOut, repoName)
+	}
+}
+
+// AddLifecycleFindings 记录仓库已有生命周期策略的评估结果
+func (s *Summary) AddLifecycleFindings(repoName string, findings []ecr.LifecycleFinding) {
+	s.lifecycleExpiring[repoName] = len(findings)
+	for _, f := range findings {
+		ref := fmt.Sprintf("%s@%s %v (rule %d)", repoName, f.ImageDigest, f.ImageTags, f.RulePriority)
+		if f.InUse {
+			s.LifecycleWarnings = append(s.LifecycleWarnings, ref)
+		}
+		if !f.Agrees {
+			s.LifecycleConflicts = append(s.LifecycleConflicts, fmt.Sprintf("%s: %s", ref, f.Conflict))
+		}
+	}
+}
+
+// Print 将运行汇总写入 w
+func (s *Summary) Print(w io.Writer) {
+	verb := "Deleted"
+	if s.DryRun {
+		verb = "Would delete"
+	}
+
+	fmt.Fprintln(w, "\n-------------------------------")
+	fmt.Fprintln(w, "Run Summary:")
+	untagged := 0
+	for _, r := range s.Deleted {
+		if !r.DigestDeleted {
+			untagged++
+		}
+	}
+	fmt.Fprintf(w, "%s images: %d (manifests: %d, untag only: %d)\n", verb, len(s.Deleted), len(s.Deleted)-untagged, untagged)
+	for _, r := range s.Deleted {
+		printRemoval(w, r)
+	}
+	fmt.Fprintf(w, "Failed images: %d\n", len(s.Failed))
+	for _, r := range s.Failed {
+		c := r.Candidate
+		fmt.Fprintf(w, "  [Failed] Repository: %s, Tags: %v, Digest: %s, Reason: %v\n", c.RepositoryName, c.ImageTags, c.ImageDigest, r.Err)
+		if len(r.RemovedTags) > 0 || r.DigestDeleted {
+			printRemoval(w, r)
+		}
+	}
+	if len(s.nothingToUntag) > 0 {
+		fmt.Fprintf(w, "Skipped images (nothing to untag): %d\n", len(s.nothingToUntag))
+		for _, c := range s.nothingToUntag {
+			fmt.Fprintf(w, "  [Skipped] Repository: %s, Tags: %v, Digest: %s\n", c.RepositoryName, c.ImageTags, c.ImageDigest)
+		}
+	}
+	if s.archivedImages > 0 {
+		fmt.Fprintf(w, "Archived images before deletion: %d\n", s.archivedImages)
+		for _, path := range s.archivePaths {
+			fmt.Fprintf(w, "  [Archive] %s\n", path)
+		}
+	}
+	if len(s.archiveFailed) > 0 {
+		fmt.Fprintf(w, "Kept images (archive failed): %d\n", len(s.archiveFailed))
+		for _, f := range s.archiveFailed {
+			fmt.Fprintf(w, "  [Kept] %s\n", f)
+		}
+	}
+	if s.quarantinedImages > 0 {
+		fmt.Fprintf(w, "Quarantined images before deletion: %d (repository %s)\n", s.quarantinedImages, s.quarantineRepo)
+	}
+	if len(s.quarantineFailed) > 0 {
+		fmt.Fprintf(w, "Kept images (quarantine failed): %d\n", len(s.quarantineFailed))
+		for _, f := range s.quarantineFailed {
+			fmt.Fprintf(w, "  [Kept] %s\n", f)
+		}
+	}
+	s.PrintKept(w)
+	s.PrintMarks(w)
+	fmt.Fprintf(w, "%s empty repositories: %d\n", verb, len(s.DeletedRepos))
+	for _, name := range s.DeletedRepos {
+		fmt.Fprintf(w, "  [Repository] %s\n", name)
+	}
+	if len(s.keptEmptyRepos) > 0 {
+		fmt.Fprintf(w, "Kept empty repositories: %d\n", len(s.keptEmptyRepos))
+		for _, r := range s.keptEmptyRepos {
+			fmt.Fprintf(w, "  [Kept] %s\n", r)
+		}
+	}
+	if len(s.OrphanIndexes) > 0 {
+		fmt.Fprintf(w, "Orphan indexes (all child manifests missing): %d\n", len(s.OrphanIndexes))
+		for _, ref := range s.OrphanIndexes {
+			fmt.Fprintf(w, "  [Orphan] %s\n", ref)
+		}
+	}
+	if len(s.OrphanReferrers) > 0 {
+		fmt.Fprintf(w, "Orphan referrers (subject missing, removed with this run): %d\n", len(s.OrphanReferrers))
+		for _, ref := range s.OrphanReferrers {
+			fmt.Fprintf(w, "  [Orphan] %s\n", ref)
+		}
+	}
+	s.PrintRepoOverrides(w)
+	s.PrintLifecycle(w)
+	s.printStorage(w)
+	if len(s.SkippedRepos) > 0 {
+		fmt.Fprintf(w, "Skipped repositories (API errors after retries): %d\n", len(s.SkippedRepos))
+		for _, name := range s.SkippedRepos {
+			fmt.Fprintf(w, "  [Skipped] Repository: %s, Reason: %v\n", name, s.skipReasons[name])
+		}
+	}
+	if len(s.FailedRepos) > 0 {
+		fmt.Fprintf(w, "Failed repository deletions: %d\n", len(s.FailedRepos))
+		for _, name := range s.FailedRepos {
+			fmt.Fprintf(w, "  [Failed] Repository: %s, Reason: %v\n", name, s.repoFailReasons[name])
+		}
+	}
+}
+
+// printStorage 输出各仓库的存储占用、本次回收的存储与估算的每月节省费用
+// 镜像大小按 ImageSizeInBytes 计算，与保留镜像共享的 layer 不会真正释放，因此回收量为上限
+func (s *Summary) printStorage(w io.Writer) {
+	label := "Reclaimed"
+	if s.DryRun {
+		label = "Would reclaim"
+	}
+	fmt.Fprintln(w, "Storage:")
+	for _, name := range s.repoOrder {
+		fmt.Fprintf(w, "  [Repository] %s: %d images, %s\n", name, s.repoImages[name], formatBytes(s.repoBytes[name]))
+	}
+	scanned := s.ScannedBytes()
+	reclaimed := s.ReclaimedBytes()
+	fmt.Fprintf(w, "Total scanned: %s\n", formatBytes(scanned))
+	var pct float64
+	if scanned > 0 {
+		pct = float64(reclaimed) / float64(scanned) * 100
+	}
+	fmt.Fprintf(w, "%s: %s (%.1f%% of scanned, upper bound; layers shared with retained images are not freed)\n", label, formatBytes(reclaimed), pct)
+	fmt.Fprintf(w, "Estimated monthly saving: $%.2f (at $%.3f/GB-month)\n", monthlyCost(reclaimed, s.StoragePrice), s.StoragePrice)
+	s.PrintLayerAnalysis(w)
+}
+
+// PrintLayerAnalysis 输出 layer 去重分析结果；分析基于扫描时的候选集合，描述删除全部候选后不再被引用的 blob
+func (s *Summary) PrintLayerAnalysis(w io.Writer) {
+	if len(s.layerStats) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Layer analysis (deduplicated, candidates as scanned):")
+	var total ecr.LayerStats
+	for _, name := range s.repoOrder {
+		st, ok := s.layerStats[name]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "  [Repository] %s: unique stored %s, freed %s in %d blobs (naive %s)\n", name, formatBytes(st.UniqueBytes), formatBytes(st.ReclaimableBytes), st.FreedBlobs, formatBytes(st.NaiveBytes))
+		total.UniqueBytes += st.UniqueBytes
+		total.ReclaimableBytes += st.ReclaimableBytes
+		total.NaiveBytes += st.NaiveBytes
+		total.FreedBlobs += st.FreedBlobs
+		total.Missing += st.Missing
+	}
+	fmt.Fprintf(w, "Overall: unique stored %s, freed %s in %d blobs (naive %s), estimated monthly saving: $%.2f\n", formatBytes(total.UniqueBytes), formatBytes(total.ReclaimableBytes), total.FreedBlobs, formatBytes(total.NaiveBytes), monthlyCost(total.ReclaimableBytes, s.StoragePrice))
+	if total.Missing > 0 {
+		fmt.Fprintf(w, "  %d images without manifest were counted at full size\n", total.Missing)
+	}
+}
+
+// bytesPerGB 是 ECR 计费使用的 GB（2^30 字节）
+const bytesPerGB = 1 << 30
+
+// monthlyCost 按 GB-月单价估算存储费用
+func monthlyCost(bytes int64, pricePerGBMonth float64) float64 {
+	return float64(bytes) / bytesPerGB * pricePerGBMonth
+}
+
+// formatBytes 以 B / KiB / MiB / GiB / TiB 格式化字节数
+func formatBytes(b int64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := int64(unit), 0
+	for n := b / unit; n >= unit && exp < 3; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGT"[exp])
+}
+
+// printRemoval 输出单个镜像实际被移除的 digest 与 tag
+func printRemoval(w io.Writer, r ecr.DeleteResult) {
+	c := r.Candidate
+	if r.DigestDeleted {
+		fmt.Fprintf(w, "  [Removed] Repository: %s, Digest: %s (manifest deleted), Tags: %v\n", c.RepositoryName, c.ImageDigest, r.RemovedTags)
+		return
+	}
+	fmt.Fprintf(w, "  [Untagged] Repository: %s, Digest: %s (manifest kept), Tags removed: %v\n", c.RepositoryName, c.ImageDigest, r.RemovedTags)
+}
+
+// accountReport 是多账户或多区域运行时单个账户在单个区域的汇总
+type accountReport struct {
+	accountID string
+	source    string
+	region    string
+	overrides []string
+	summary   *Summary
+}
+
+// printCombinedReport 按区域分组输出合并报告，包括无法连接的账户
+func printCombinedReport(regions []string, reports [][]accountReport, failures []targetFailure) {
+	fmt.Println("\n===============================")
+	fmt.Println("Combined Report:")
+	var reclaimed int64
+	var price float64
+	for i, region := range regions {
+		fmt.Printf("Region: %s\n", region)
+		for _, r := range reports[i] {
+			s := r.summary
+			outcome := s.Outcome
+			if s.DryRun && outcome == OutcomeCompleted {
+				outcome += " (dry-run)"
+			}
+			fmt.Printf("  [Account] %s (source: %s): %s, images removed: %d, images failed: %d, repositories deleted: %d, repositories failed: %d, repositories skipped: %d, reclaimed: %s\n",
+				r.accountID, r.source, outcome, len(s.Deleted), len(s.Failed), len(s.DeletedRepos), len(s.FailedRepos), len(s.SkippedRepos), formatBytes(s.ReclaimedBytes()))
+			reclaimed += s.ReclaimedBytes()
+			price = s.StoragePrice
+			if len(r.overrides) > 0 {
+				fmt.Printf("      Policy overrides: %v\n", r.overrides)
+			}
+		}
+	}
+	fmt.Printf("Total reclaimed: %s, estimated monthly saving: $%.2f\n", formatBytes(reclaimed), monthlyCost(reclaimed, price))
+	if len(failures) > 0 {
+		fmt.Printf("Unreachable accounts: %d\n", len(failures))
+		for _, f := range failures {
+			fmt.Printf("  [Failed] Source: %s, Reason: %v\n", f.source, f.err)
+		}
+	}
+}
+
+// PrintRepoOverrides 输出各仓库通过资源 tag 生效的策略覆盖与选择不参与清理的仓库
+func (s *Summary) PrintRepoOverrides(w io.Writer) {
+	if len(s.overrideOrder) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Repository overrides (resource tags): %d\n", len(s.overrideOrder))
+	for _, name := range s.overrideOrder {
+		fmt.Fprintf(w, "  [Overrides] %s: %v\n", name, s.repoOverrides[name])
+	}
+	if len(s.optedOut) > 0 {
+		fmt.Fprintf(w, "Opted-out repositories (%s=true): %d\n", config.RepoTagSkip, len(s.optedOut))
+		for _, name := range s.optedOut {
+			fmt.Fprintf(w, "  [Opted out] %s\n", name)
+		}
+	}
+}
+
+// PrintLifecycle 输出已有生命周期策略的评估结果：ECR 将过期的镜像数量、与清理规则的冲突及 in-use 警告
+func (s *Summary) PrintLifecycle(w io.Writer) {
+	if len(s.lifecycleExpiring) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "Existing lifecycle policies (evaluated offline):")
+	for _, name := range s.repoOrder {
+		if n, ok := s.lifecycleExpiring[name]; ok {
+			fmt.Fprintf(w, "  [Repository] %s: %d images expired by lifecycle policy\n", name, n)
+		}
+	}
+	if len(s.LifecycleConflicts) > 0 {
+		fmt.Fprintf(w, "Lifecycle conflicts (expired by ECR, kept by cleaner): %d\n", len(s.LifecycleConflicts))
+		for _, c := range s.LifecycleConflicts {
+			fmt.Fprintf(w, "  [Conflict] %s\n", c)
+		}
+	}
+	if len(s.LifecycleWarnings) > 0 {
+		fmt.Fprintf(w, "Lifecycle warnings (in-use images expired by ECR): %d\n", len(s.LifecycleWarnings))
+		for _, ref := range s.LifecycleWarnings {
+			fmt.Fprintf(w, "  [Warning] %s\n", ref)
+		}
+	}
+}
+
+// PrintKept 输出按保留规则保留的镜像及原因
+func (s *Summary) PrintKept(w io.Writer) {
+	if len(s.kept) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Kept images (retention rules): %d\n", len(s.kept))
+	for _, k := range s.kept {
+		fmt.Fprintf(w, "  [Kept] %s\n", k)
+	}
+}
+
+// PrintMarks 输出标记-清除的状态：宽限期内等待删除的镜像与本次取消标记的镜像
+func (s *Summary) PrintMarks(w io.Writer) {
+	if s.GraceDays <= 0 && len(s.unmarked) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Marked images in grace period (DELETE_GRACE_DAYS=%d): %d\n", s.GraceDays, len(s.scheduled))
+	for _, m := range s.scheduled {
+		fmt.Fprintf(w, "  [Scheduled] %s\n", m)
+	}
+	if len(s.unmarked) > 0 {
+		fmt.Fprintf(w, "Unmarked images (no longer candidates): %d\n", len(s.unmarked))
+		for _, m := range s.unmarked {
+			fmt.Fprintf(w, "  [Unmarked] %s\n", m)
+		}
+	}
+}
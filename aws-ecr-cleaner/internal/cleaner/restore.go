@@ -0,0 +1,266 @@
+// aws-ecr-cleaner/internal/cleaner/restore.go
+package cleaner
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// RestoreOptions 是 restore 子命令的参数
+type RestoreOptions struct {
+	Repository string
+	Ref        string // 原镜像的 tag 或 digest（sha256:...）
+	Tag        string // 恢复后的 tag；为空时按 tag 查找沿用原 tag，按 digest 查找只按 digest 推送
+	AccountID  string // 多账户时指定目标账户
+	Region     string // 为空时使用第一个配置的区域
+}
+
+// restoreSource 是找到的待恢复镜像及其所在的归档
+type restoreSource struct {
+	layout   *ecr.OCILayout
+	desc     ecr.Descriptor
+	location string // 归档目录或 tar 文件
+	cleanup  func()
+}
+
+// RunRestore 从隔离仓库或归档中找到镜像并重新推送到 ECR：仓库已被删除时按导出的仓库设置重建，推送后校验 digest 与原镜像一致
+// 同时配置时优先使用隔离仓库（同一 registry 内复制，仓库中已有的 layer 无需上传），找不到时再查找归档
+func RunRestore(cfg *config.Config, opts RestoreOptions) {
+	log.Println("Starting AWS ECR Cleaner (restore)...")
+
+	t, err := restoreTarget(cfg, opts)
+	if err != nil {
+		log.Fatalf("Failed to resolve restore target: %v", err)
+	}
+	acfg := cfg.ForAccount(t.accountID)
+	acfg.AWSRegion = t.region
+	fmt.Printf("Region: %s, Account: %s (source: %s)\n", t.region, t.accountID, t.source)
+	if acfg.QuarantineRepo == "" && acfg.ArchiveDir == "" {
+		log.Fatalf("Neither QUARANTINE_REPO nor ARCHIVE_DIR is set")
+	}
+
+	tag := opts.Tag
+	if tag == "" && !strings.HasPrefix(opts.Ref, "sha256:") {
+		tag = opts.Ref
+	}
+
+	if acfg.QuarantineRepo != "" {
+		digest, qtag, err := findQuarantinedImage(acfg, t.svc, opts.Repository, opts.Ref)
+		if err != nil {
+			log.Fatalf("Failed to search quarantine repository %s: %v", acfg.QuarantineRepo, err)
+		}
+		if digest != "" {
+			fmt.Printf("Found %s@%s in quarantine repository %s (tag: %s)\n", opts.Repository, digest, acfg.QuarantineRepo, qtag)
+			if !prepareRestore(acfg, t.svc, opts.Repository, digest, tag) {
+				return
+			}
+			var tags []string
+			if tag != "" {
+				tags = []string{tag}
+			}
+			result, err := ecr.CopyImage(t.svc, acfg.QuarantineRepo, opts.Repository, digest, tags)
+			if err != nil {
+				log.Fatalf("Failed to restore %s@%s: %v", opts.Repository, digest, err)
+			}
+			printRestoreResult(opts.Repository, tag, result)
+			return
+		}
+		if acfg.ArchiveDir == "" {
+			log.Fatalf("Failed to find %s:%s in quarantine repository %s", opts.Repository, opts.Ref, acfg.QuarantineRepo)
+		}
+		fmt.Printf("%s:%s not found in quarantine repository %s, searching archives\n", opts.Repository, opts.Ref, acfg.QuarantineRepo)
+	}
+
+	src, err := findArchivedImage(acfg, opts.Repository, opts.Ref)
+	if err != nil {
+		log.Fatalf("Failed to find %s:%s in archives: %v", opts.Repository, opts.Ref, err)
+	}
+	defer src.cleanup()
+	fmt.Printf("Found %s@%s (tag: %s, archived at %s) in %s\n", opts.Repository, src.desc.Digest,
+		refName(src.desc), src.desc.Annotations[ecr.AnnotationArchivedAt], src.location)
+
+	if !prepareRestore(acfg, t.svc, opts.Repository, src.desc.Digest, tag) {
+		return
+	}
+	result, err := ecr.RestoreImage(t.svc, src.layout, opts.Repository, src.desc, tag)
+	if err != nil {
+		log.Fatalf("Failed to restore %s@%s: %v", opts.Repository, src.desc.Digest, err)
+	}
+	printRestoreResult(opts.Repository, tag, result)
+}
+
+// prepareRestore 确保目标仓库存在（已删除时重建），dry-run 下输出将执行的恢复并返回 false
+func prepareRestore(cfg *config.Config, svc ecr.Registry, repoName, digest, tag string) bool {
+	repo, err := ecr.GetRepository(svc, repoName)
+	if err != nil {
+		log.Fatalf("Failed to describe repository %s: %v", repoName, err)
+	}
+	if repo == nil {
+		if err := recreateRepository(cfg, svc, repoName); err != nil {
+			log.Fatalf("Failed to recreate repository %s: %v", repoName, err)
+		}
+	}
+	if cfg.DryRun {
+		fmt.Printf("[Dry-run] Would restore %s@%s with tag '%s'\n", repoName, digest, tag)
+		return false
+	}
+	return true
+}
+
+// printRestoreResult 输出恢复结果
+func printRestoreResult(repoName, tag string, result *ecr.RestoreResult) {
+	if result.ManifestExisted {
+		fmt.Printf("Image %s@%s with tag '%s' already present in repository, nothing uploaded; digest verified\n", repoName, result.Digest, tag)
+		return
+	}
+	fmt.Printf("Restored %s@%s with tag '%s': uploaded %d blobs (%s), %d already present; digest verified\n",
+		repoName, result.Digest, tag, result.UploadedBlobs, formatBytes(result.UploadedBytes), result.ExistingBlobs)
+}
+
+// restoreTarget 在已配置的账户与区域中选择恢复目标；多账户时必须指定账户
+func restoreTarget(cfg *config.Config, opts RestoreOptions) (target, error) {
+	region := opts.Region
+	if region == "" {
+		region = cfg.Regions[0]
+	}
+	targets, failures, err := resolveTargets(cfg)
+	if err != nil {
+		return target{}, err
+	}
+	for _, f := range failures {
+		fmt.Printf("  [Failed] Source: %s, Reason: %v\n", f.source, f.err)
+	}
+	var matched []target
+	for _, t := range targets {
+		if t.region == region && (opts.AccountID == "" || t.accountID == opts.AccountID) {
+			matched = append(matched, t)
+		}
+	}
+	switch {
+	case len(matched) == 0:
+		return target{}, fmt.Errorf("no configured account matches account '%s' in region %s", opts.AccountID, region)
+	case len(matched) > 1:
+		return target{}, fmt.Errorf("%d accounts configured in region %s, specify one with -account", len(matched), region)
+	}
+	return matched[0], nil
+}
+
+// findArchivedImage 在账户与区域的归档目录（OCI layout 目录与各次运行的 tar 文件）中查找镜像，
+// 同一镜像多次归档时取最近一次；tar 文件先整体校验，再解包到临时目录
+func findArchivedImage(cfg *config.Config, repoName, ref string) (*restoreSource, error) {
+	if cfg.ArchiveDir == "" {
+		return nil, fmt.Errorf("ARCHIVE_DIR is not set")
+	}
+	dir := archiveLayoutDir(cfg)
+	var best *restoreSource
+	var bestTar string
+	consider := func(idx *ecr.OCIIndex, location string) bool {
+		d, ok := idx.Find(repoName, ref)
+		if ok && (best == nil || d.Annotations[ecr.AnnotationArchivedAt] > best.desc.Annotations[ecr.AnnotationArchivedAt]) {
+			best = &restoreSource{desc: d, location: location, cleanup: func() {}}
+			return true
+		}
+		return false
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		layout, err := ecr.OpenOCILayout(dir)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := layout.ReadIndex()
+		if err != nil {
+			return nil, err
+		}
+		if consider(idx, dir) {
+			best.layout = layout
+		}
+	}
+	tars, err := filepath.Glob(filepath.Join(dir, "archive_*.tar"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tars)
+	for _, path := range tars {
+		idx, err := ecr.VerifyOCITarball(path)
+		if err != nil {
+			fmt.Printf("  [Skipped] Archive %s: %v\n", path, err)
+			continue
+		}
+		if consider(idx, path) {
+			bestTar = path
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("not found under %s", dir)
+	}
+	if best.location == bestTar {
+		tmp, err := os.MkdirTemp("", "ecr-restore-")
+		if err != nil {
+			return nil, err
+		}
+		layout, err := ecr.ExtractOCITarball(bestTar, tmp)
+		if err != nil {
+			os.RemoveAll(tmp)
+			return nil, err
+		}
+		best.layout = layout
+		best.cleanup = func() { os.RemoveAll(tmp) }
+	}
+	return best, nil
+}
+
+// recreateRepository 重建已删除的仓库：优先使用 REPO_BACKUP_DIR 中最近一次导出的设置，没有导出时使用默认设置
+func recreateRepository(cfg *config.Config, svc ecr.Registry, repoName string) error {
+	backup, path := latestRepoBackup(cfg, repoName)
+	source := "default settings"
+	if backup != nil {
+		source = "settings exported to " + path
+	}
+	if cfg.DryRun {
+		fmt.Printf("[Dry-run] Would recreate repository %s from %s\n", repoName, source)
+		return nil
+	}
+	repo, err := ecr.RecreateRepository(svc, repoName, backup)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Recreated repository %s (URI: %s) from %s\n", repoName, aws.StringValue(repo.RepositoryUri), source)
+	return nil
+}
+
+// latestRepoBackup 返回仓库最近一次导出的设置及其路径（文件名以导出时间结尾，按名称排序即按时间排序）
+func latestRepoBackup(cfg *config.Config, repoName string) (*ecr.RepositoryBackup, string) {
+	pattern := filepath.Join(cfg.RepoBackupDir, cfg.AccountID, cfg.AWSRegion, strings.ReplaceAll(repoName, "/", "_")+"_*.json")
+	paths, _ := filepath.Glob(pattern)
+	sort.Sort(sort.Reverse(sort.StringSlice(paths)))
+	for _, path := range paths {
+		backup, err := ecr.LoadRepositoryBackup(path)
+		if err != nil {
+			fmt.Printf("  [Skipped] Repository backup %s: %v\n", path, err)
+			continue
+		}
+		// 仓库名中的 / 在文件名中替换为 _，需核对原始仓库名
+		if backup.RepositoryName == repoName {
+			return backup, path
+		}
+	}
+	return nil, ""
+}
+
+// refName 返回归档记录中的 tag，未打标签时为 <untagged>
+func refName(d ecr.Descriptor) string {
+	if tag := d.Annotations[ecr.AnnotationRefName]; tag != "" {
+		return tag
+	}
+	return "<untagged>"
+}
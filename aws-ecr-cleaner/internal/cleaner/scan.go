@@ -0,0 +1,412 @@
+// aws-ecr-cleaner/internal/cleaner/scan.go
+package cleaner
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+	"aws-ecr-cleaner/internal/state"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// repoScan 保存单个仓库的扫描结果
+// 并发扫描时每个仓库的输出先写入 output，最后按仓库顺序统一打印，保证输出确定
+type repoScan struct {
+	repoName   string
+	output     strings.Builder
+	scanned    []ecr.ScannedImage
+	candidates []ecr.Candidate
+	emptyRepo  bool   // 扫描时仓库为空
+	emptyKept  string // 空仓库不删除的原因，为空表示是删除候选，确认后删除
+	scanErr    error  // 重试耗尽后仍无法获取镜像列表，仓库被跳过
+
+	retained        []ecr.Retained  // 被规则保护、从候选中移除的镜像
+	orphanIndexes   []string        // 子 manifest 已全部缺失的 index
+	orphanReferrers []ecr.Referrer  // subject 已不存在的签名 / 证明 / SBOM
+	layerStats      *ecr.LayerStats // LAYER_ANALYSIS 启用时的 layer 去重分析结果
+
+	overrides   config.RepoOverrides // 仓库资源 tag 中生效的策略覆盖
+	notSelected bool                 // 仓库资源 tag 不满足 TARGET_REPO_TAGS，未处理
+
+	lifecycleChecked bool                   // 仓库设置了生命周期策略并已完成离线评估
+	lifecycle        []ecr.LifecycleFinding // 已有生命周期策略将过期的镜像及与清理规则的对比
+
+	scheduled []scheduledImage // DELETE_GRACE_DAYS 宽限期内已标记、本次不删除的候选
+	unmarked  []ecr.Retained   // 此前已标记、本次不再是候选而取消标记的镜像
+
+	protect protectFunc // 候选被移除后（如隔离失败）重新应用 index 子 manifest 与制品的保护
+
+	kept []ecr.Retained // 按保留规则（TAG_GROUP_RULES / SEMVER_KEEP_* / KEEP_LATEST_TAGGED / KEEP_LATEST_UNTAGGED）保留的镜像及原因
+}
+
+func (r *repoScan) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&r.output, format, args...)
+}
+
+// scanRepositories 使用最多 concurrency 个 worker 并发扫描仓库，返回结果与 repos 顺序一致
+func scanRepositories(cfg *config.Config, svc ecr.Registry, repos []*awsecr.Repository, inUse map[string]bool, store *state.Store) []*repoScan {
+	results := make([]*repoScan, len(repos))
+	concurrency := cfg.ScanConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(repos) {
+		concurrency = len(repos)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = scanRepository(cfg, svc, repos[i], inUse, store)
+			}
+		}()
+	}
+	for i := range repos {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// scanRepository 扫描单个仓库并根据规则过滤候选镜像
+func scanRepository(cfg *config.Config, svc ecr.Registry, repo *awsecr.Repository, inUse map[string]bool, store *state.Store) *repoScan {
+	repoName := aws.StringValue(repo.RepositoryName)
+	repoUri := aws.StringValue(repo.RepositoryUri)
+	scan := &repoScan{repoName: repoName}
+	scan.printf("\nRepository: %s (URI: %s)\n", repoName, repoUri)
+
+	// 按 TARGET_REPO_TAGS 选择仓库，仓库资源 tag 中的保留键覆盖该仓库的清理策略；无法获取 tag 时跳过该仓库
+	repoTags, err := ecr.GetRepositoryTags(svc, aws.StringValue(repo.RepositoryArn))
+	if err != nil {
+		scan.printf("Error fetching tags for repository %s: %v\n", repoName, err)
+		scan.scanErr = err
+		return scan
+	}
+	if !cfg.RepoTagSelector.Matches(repoTags) {
+		if cfg.Debug {
+			log.Printf("[DEBUG] Repository %s does not match TARGET_REPO_TAGS '%s'", repoName, cfg.TargetRepoTags)
+		}
+		scan.output.Reset()
+		scan.notSelected = true
+		clearMarks(scan, cfg, store)
+		return scan
+	}
+	cfg, scan.overrides, err = cfg.ForRepository(repoTags)
+	if err != nil {
+		scan.printf("Invalid repository tag override for %s: %v\n", repoName, err)
+		scan.scanErr = err
+		return scan
+	}
+	if len(scan.overrides.Applied) > 0 {
+		scan.printf("  [Overrides] %v\n", scan.overrides.Applied)
+	}
+	if scan.overrides.Skip {
+		scan.printf("Repository %s opted out via tag %s. Skipping.\n", repoName, config.RepoTagSkip)
+		clearMarks(scan, cfg, store)
+		return scan
+	}
+
+	images, err := ecr.GetImages(svc, repoName, cfg.Debug)
+	if err != nil {
+		scan.printf("Error fetching images for repository %s: %v\n", repoName, err)
+		scan.scanErr = err
+		return scan
+	}
+	scan.printf("Total images found: %d\n", len(images))
+
+	// 空仓库按 DELETE_EMPTY_REPOS 规则判断，可删除的仓库与候选镜像一起在确认后删除；仓库不为空时清除此前的空置记录
+	if len(images) == 0 {
+		scan.printf("Repository %s is empty.\n", repoName)
+		scan.emptyRepo = true
+		clearMarks(scan, cfg, store)
+		scan.emptyKept = checkEmptyRepository(&scan.output, cfg, repo, store, time.Now())
+		return scan
+	}
+	store.ClearEmpty(state.RepoKey(cfg.AccountID, cfg.AWSRegion, repoName))
+
+	// 记录扫描结果
+	for _, image := range images {
+		var tags []string
+		for _, t := range image.ImageTags {
+			tags = append(tags, aws.StringValue(t))
+		}
+		var pushTime time.Time
+		if image.ImagePushedAt != nil {
+			pushTime = *image.ImagePushedAt
+		}
+		pullTime := aws.TimeValue(image.LastRecordedPullTime)
+		scan.scanned = append(scan.scanned, ecr.ScannedImage{
+			RepositoryName: repoName,
+			RepositoryUri:  repoUri,
+			ImageDigest:    aws.StringValue(image.ImageDigest),
+			ImageTags:      tags,
+			PushTime:       pushTime,
+			PullTime:       pullTime,
+			Size:           aws.Int64Value(image.ImageSizeInBytes),
+		})
+		scan.printf("  [Scanned] Digest: %s, Tags: %v, PushedAt: %s, LastPulledAt: %s\n", aws.StringValue(image.ImageDigest), tags, pushTime.Format("2006-01-02T15:04:05Z"), ecr.FormatPullTime(pullTime))
+	}
+
+	// 根据规则过滤候选镜像
+	candidates, newest := ecr.FilterImagesForDeletion(images, ecr.FilterRules{
+		HoldTagRegex:     cfg.HoldTagRegex,
+		ProtectLatest:    cfg.ProtectLatest,
+		ProtectInUse:     cfg.ProtectInUseByK8s,
+		KeepLatestTagged: cfg.KeepLatestTagged,
+		TagGroups:        cfg.TagGroups,
+		Semver: ecr.SemverRules{
+			KeepMinors:      cfg.SemverKeepMinors,
+			KeepPatches:     cfg.SemverKeepPatches,
+			KeepPrereleases: cfg.SemverKeepPrereleases,
+		},
+	}, inUse, repoUri, cfg.Debug)
+	for i := range candidates {
+		candidates[i].RepositoryName = repoName
+	}
+
+	// 仓库 tag 追加的保留正则
+	var held []ecr.Retained
+	candidates, held = ecr.ApplyHoldTagRegex(candidates, cfg.RepoHoldTagRegex, "repository tag "+config.RepoTagHoldTagRegex)
+
+	// 基于 LastRecordedPullTime 保留仍在被拉取的镜像（包括 Kubernetes 之外的使用方）
+	var pulled []ecr.Retained
+	candidates, pulled = ecr.ApplyPullTimeRules(candidates, days(cfg.ProtectPulledDays), days(cfg.IdlePullDays), time.Now())
+
+	// 最大镜像年龄：超过 N 天的带 tag 镜像即使被上述规则保留也成为候选（正在使用的镜像除外）
+	var expired []ecr.Candidate
+	candidates, expired = ecr.ApplyMaxAge(images, candidates, days(cfg.MaxImageAgeDays), inUse, repoUri, cfg.ProtectInUseByK8s, time.Now())
+	for i := range candidates {
+		candidates[i].RepositoryName = repoName
+	}
+	if len(expired) > 0 {
+		newest, held, pulled = dropRetained(newest, expired), dropRetained(held, expired), dropRetained(pulled, expired)
+	}
+
+	// 最小镜像年龄：推送不足 N 小时的镜像无论其他规则如何都不是候选
+	// 在 index 与制品传播之前应用，使其子 manifest 与制品随之保留；制品传播之后再次应用，作为硬性下限
+	minAge := time.Duration(cfg.MinImageAgeHours) * time.Hour
+	var young []ecr.Retained
+	candidates, young = ecr.ApplyMinAge(candidates, minAge, time.Now())
+	youngDigests := make(map[string]bool, len(young))
+	for _, r := range young {
+		youngDigests[r.ImageDigest] = true
+	}
+	for _, c := range expired {
+		if !youngDigests[c.ImageDigest] {
+			scan.printf("  [Expired] Digest: %s, Tags: %v, Reason: %s\n", c.ImageDigest, c.ImageTags, ecr.MaxAgeReason(c, days(cfg.MaxImageAgeDays)))
+		}
+	}
+	for _, r := range append(append(append(newest, held...), young...), pulled...) {
+		scan.printf("  [Protected] Digest: %s, Tags: %v, Reason: %s\n", r.ImageDigest, r.ImageTags, r.Reason)
+	}
+	scan.kept = append(scan.kept, newest...)
+	scan.retained = append(scan.retained, newest...)
+	scan.retained = append(scan.retained, held...)
+	scan.retained = append(scan.retained, young...)
+	scan.retained = append(scan.retained, pulled...)
+
+	// 多架构 index 与 OCI 制品需要读取 manifest 才能确定引用关系；layer 分析需要全部镜像的 manifest
+	var manifests map[string]*ecr.Manifest
+	indexDigests := ecr.IndexDigests(images)
+	digests := append(indexDigests, ecr.ArtifactDigests(images)...)
+	if cfg.LayerAnalysis {
+		digests = nil
+		for _, image := range images {
+			digests = append(digests, aws.StringValue(image.ImageDigest))
+		}
+	}
+	if len(digests) > 0 {
+		manifests, err = ecr.GetManifests(svc, repoName, digests, cfg.Debug)
+		if err != nil {
+			// 无法确认引用关系时删除子 manifest 或制品不安全，跳过该仓库
+			scan.printf("Error fetching manifests for repository %s: %v\n", repoName, err)
+			scan.scanErr = err
+			return scan
+		}
+	}
+
+	var graph *ecr.ManifestGraph
+	if len(indexDigests) > 0 {
+		graph = ecr.BuildManifestGraph(manifests)
+	}
+	referrers := ecr.FindReferrers(images, manifests)
+
+	// 最新的 N 个未打标签镜像；index 的子 manifest 与制品跟随其 index 或 subject，不占名额
+	if cfg.KeepLatestUntagged > 0 {
+		var newestUntagged []ecr.Retained
+		candidates, newestUntagged = ecr.ApplyKeepLatestUntagged(images, candidates, cfg.KeepLatestUntagged, graph, referrers)
+		for _, r := range newestUntagged {
+			scan.printf("  [Protected] Digest: %s, Tags: %v, Reason: %s\n", r.ImageDigest, r.ImageTags, r.Reason)
+		}
+		scan.kept = append(scan.kept, newestUntagged...)
+		scan.retained = append(scan.retained, newestUntagged...)
+	}
+
+	// 多架构 index：保护仍被保留的 index 引用的子 manifest，并报告子 manifest 已全部缺失的孤儿 index
+	if graph != nil {
+		var protected []ecr.Retained
+		candidates, protected = ecr.ProtectIndexChildren(candidates, graph, cfg.DeleteMode)
+		for _, r := range protected {
+			scan.printf("  [Protected] Digest: %s, Reason: %s\n", r.ImageDigest, r.Reason)
+		}
+		scan.retained = append(scan.retained, protected...)
+		for _, digest := range ecr.OrphanIndexes(graph, images) {
+			scan.printf("  [Orphan] Index %s: all child manifests are missing\n", digest)
+			scan.orphanIndexes = append(scan.orphanIndexes, digest)
+		}
+	}
+
+	// 签名、证明与 SBOM 跟随其 subject：subject 保留则保留，subject 删除或已不存在则一并删除
+	if len(referrers) > 0 {
+		var protected []ecr.Retained
+		candidates, protected, scan.orphanReferrers = ecr.ApplyReferrers(images, candidates, referrers, repoUri, cfg.DeleteMode)
+		for i := range candidates {
+			candidates[i].RepositoryName = repoName
+		}
+		for _, r := range protected {
+			scan.printf("  [Protected] Digest: %s, Reason: %s\n", r.ImageDigest, r.Reason)
+		}
+		scan.retained = append(scan.retained, protected...)
+		for _, ref := range scan.orphanReferrers {
+			scan.printf("  [Orphan] Referrer %s (%s): subject %s is missing\n", ref.Digest, ref.Kind, ref.Subject)
+		}
+
+		// 孤儿制品与 subject 被删除的制品由传播加入候选，同样不删除推送不足 MIN_IMAGE_AGE_HOURS 的制品
+		var youngReferrers []ecr.Retained
+		candidates, youngReferrers = ecr.ApplyMinAge(candidates, minAge, time.Now())
+		for _, r := range youngReferrers {
+			scan.printf("  [Protected] Digest: %s, Tags: %v, Reason: %s\n", r.ImageDigest, r.ImageTags, r.Reason)
+		}
+		scan.retained = append(scan.retained, youngReferrers...)
+	}
+
+	if len(candidates) > 0 {
+		scan.printf("\nCandidate images for deletion in repository '%s':\n", repoName)
+		var eligible []ecr.Candidate
+		for _, cand := range candidates {
+			// untag 模式下所有 tag 都单独命中 holdTagRegex 时没有可移除的 tag，保留该镜像
+			if cfg.DeleteMode == ecr.DeleteModeUntag && len(cand.ImageTags) > 0 && len(cand.StaleTags) == 0 {
+				scan.printf("  [Kept] Tags: %v, Digest: %s (no stale tags to remove)\n", cand.ImageTags, cand.ImageDigest)
+				continue
+			}
+			eligible = append(eligible, cand)
+		}
+
+		// 标记-清除：宽限期内的候选只记录标记，持续为候选满 DELETE_GRACE_DAYS 才删除
+		// 宽限期内的 index 与 subject 本次保留，已到期的子 manifest 与签名等制品随之推迟
+		protect := func(due []ecr.Candidate) ([]ecr.Candidate, []ecr.Retained) {
+			var deferred, protected []ecr.Retained
+			if graph != nil {
+				due, protected = ecr.ProtectIndexChildren(due, graph, cfg.DeleteMode)
+				deferred = append(deferred, protected...)
+			}
+			if len(referrers) > 0 {
+				due, protected, _ = ecr.ApplyReferrers(images, due, referrers, repoUri, cfg.DeleteMode)
+				for i := range due {
+					due[i].RepositoryName = repoName
+				}
+				deferred = append(deferred, protected...)
+				// 重新加入的制品同样受最小镜像年龄约束；它们不在候选中，无需推迟记录
+				due, _ = ecr.ApplyMinAge(due, minAge, time.Now())
+			}
+			return due, deferred
+		}
+		due, scheduled := markCandidates(scan, cfg, store, eligible, protect, time.Now())
+		for _, cand := range due {
+			scan.printf("  [Candidate] Tags: %v, Digest: %s, PushedAt: %s, LastPulledAt: %s, Remove: %s\n", cand.ImageTags, cand.ImageDigest, cand.PushTime.Format("2006-01-02T15:04:05Z"), ecr.FormatPullTime(cand.PullTime), removalDesc(cand, cfg.DeleteMode))
+		}
+		for _, s := range scheduled {
+			scan.printf("  [Scheduled] Tags: %v, Digest: %s, MarkedAt: %s, %s\n", s.ImageTags, s.ImageDigest, s.MarkedAt.Format("2006-01-02T15:04:05Z"), s.schedule())
+			scan.retained = append(scan.retained, ecr.Retained{RepositoryName: repoName, ImageDigest: s.ImageDigest, ImageTags: s.ImageTags, Reason: s.schedule()})
+		}
+		scan.candidates = due
+		scan.scheduled = scheduled
+		scan.protect = protect
+	} else {
+		markCandidates(scan, cfg, store, nil, nil, time.Now())
+		scan.printf("No candidate images for deletion in repository '%s'.\n", repoName)
+	}
+
+	// layer 去重分析：按 blob 引用计数计算删除候选后真正释放的存储
+	if cfg.LayerAnalysis {
+		stats := ecr.BuildLayerGraph(images, manifests).Analyze(scan.candidates, cfg.DeleteMode)
+		scan.layerStats = &stats
+		scan.printf("  [Layers] Unique stored: %s, freed by candidates: %s in %d blobs (naive sum %s)\n", formatBytes(stats.UniqueBytes), formatBytes(stats.ReclaimableBytes), stats.FreedBlobs, formatBytes(stats.NaiveBytes))
+		if stats.Missing > 0 {
+			scan.printf("  [Layers] %d images without manifest counted at full size\n", stats.Missing)
+		}
+	}
+
+	// 在本地评估仓库已有的生命周期策略，与清理规则对比
+	if cfg.LifecycleCheck {
+		checkLifecycle(scan, cfg, svc, images, inUse, repoUri)
+	}
+	return scan
+}
+
+// checkLifecycle 获取仓库已有的生命周期策略并离线评估，输出 ECR 将过期的镜像、与候选及保留规则的冲突和 in-use 警告
+// 获取或解析策略失败只影响该检查，不跳过仓库
+func checkLifecycle(scan *repoScan, cfg *config.Config, svc ecr.Registry, images []*awsecr.ImageDetail, inUse map[string]bool, repoUri string) {
+	policy, err := ecr.GetLifecyclePolicy(svc, scan.repoName)
+	if err != nil {
+		scan.printf("  [Lifecycle] Unable to evaluate lifecycle policy: %v\n", err)
+		return
+	}
+	if policy == nil {
+		scan.printf("  [Lifecycle] No lifecycle policy\n")
+		return
+	}
+	expiries := policy.Evaluate(images, time.Now())
+	scan.lifecycle = ecr.CompareLifecycle(expiries, scan.candidates, scan.retained, cfg.HoldTagRegex, inUse, repoUri, cfg.DeleteMode)
+	scan.lifecycleChecked = true
+	if len(scan.lifecycle) == 0 {
+		scan.printf("  [Lifecycle] Policy (%d rules) expires no images\n", len(policy.Rules))
+		return
+	}
+	for _, f := range scan.lifecycle {
+		desc := "also a cleaner candidate"
+		if !f.Agrees {
+			desc = "kept by cleaner: " + f.Conflict
+		}
+		switch {
+		case f.InUse:
+			scan.printf("  [Lifecycle warning] Rule %d expires in-use image Tags: %v, Digest: %s (%s)\n", f.RulePriority, f.ImageTags, f.ImageDigest, desc)
+		case f.Agrees:
+			scan.printf("  [Lifecycle] Rule %d expires Tags: %v, Digest: %s, PushedAt: %s (%s)\n", f.RulePriority, f.ImageTags, f.ImageDigest, f.PushTime.Format("2006-01-02T15:04:05Z"), desc)
+		default:
+			scan.printf("  [Lifecycle conflict] Rule %d expires Tags: %v, Digest: %s, PushedAt: %s (%s)\n", f.RulePriority, f.ImageTags, f.ImageDigest, f.PushTime.Format("2006-01-02T15:04:05Z"), desc)
+		}
+	}
+}
+
+// days 将天数转换为 time.Duration
+func days(n int) time.Duration {
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// dropRetained 移除已重新成为候选的镜像的保留记录
+func dropRetained(retained []ecr.Retained, candidates []ecr.Candidate) []ecr.Retained {
+	selected := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		selected[c.ImageDigest] = true
+	}
+	var kept []ecr.Retained
+	for _, r := range retained {
+		if !selected[r.ImageDigest] {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
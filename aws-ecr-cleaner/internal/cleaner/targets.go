@@ -0,0 +1,174 @@
+// aws-ecr-cleaner/internal/cleaner/targets.go
+package cleaner
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"aws-ecr-cleaner/internal/config"
+	"aws-ecr-cleaner/internal/ecr"
+	"aws-ecr-cleaner/internal/throttle"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awsecr "github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// target 是一个待清理的账户与区域的 Registry
+type target struct {
+	accountID string
+	source    string // 角色 ARN、fixture 路径或 ambient（当前凭证）
+	region    string
+	svc       ecr.Registry
+}
+
+// targetFailure 记录无法建立连接（如 AssumeRole 失败）的账户来源
+type targetFailure struct {
+	source string
+	err    error
+}
+
+// newLimiter 按配置创建限流器；每个账户与区域使用独立的限流器，ECR 的 API 配额按账户和区域计算
+func newLimiter(cfg *config.Config) *throttle.Limiter {
+	return throttle.New(throttle.Options{
+		RatePerSecond: cfg.APIRateLimit,
+		Burst:         cfg.APIBurst,
+		MaxRetries:    cfg.APIMaxRetries,
+		BaseDelay:     cfg.APIRetryBaseDelay,
+		MaxDelay:      cfg.APIRetryMaxDelay,
+		Debug:         cfg.Debug,
+	})
+}
+
+// resolveTargets 根据配置确定要清理的账户与区域，结果按区域分组、区域顺序与 cfg.Regions 一致
+// REGISTRY_FIXTURE 可为逗号分隔的多个 fixture（每个代表一个账户，各区域独立加载一份）；配置了 ASSUME_ROLE_ARNS 或 ORG_ROLE_NAME 时依次 AssumeRole；
+// 否则只清理当前凭证所在账户。单个账户连接失败不影响其它账户，记录在 failures 中
+func resolveTargets(cfg *config.Config) ([]target, []targetFailure, error) {
+	if cfg.RegistryFixture != "" {
+		var targets []target
+		for _, region := range cfg.Regions {
+			for _, path := range strings.Split(cfg.RegistryFixture, ",") {
+				path = strings.TrimSpace(path)
+				if path == "" {
+					continue
+				}
+				mem, err := ecr.LoadMemoryRegistry(path, region)
+				if err != nil {
+					return nil, nil, err
+				}
+				log.Printf("Using in-memory registry loaded from %s for region %s", path, region)
+				targets = append(targets, target{accountID: mem.AccountID, source: path, region: region, svc: ecr.NewThrottledRegistry(mem, newLimiter(cfg))})
+			}
+		}
+		return targets, nil, nil
+	}
+
+	// 建立 AWS session，重试交由共享限流器统一控制，关闭 SDK 自带重试以免重试预算叠加
+	sess, err := session.NewSession(&aws.Config{
+		Region:     aws.String(cfg.AWSRegion),
+		MaxRetries: aws.Int(0),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create AWS session: %w", err)
+	}
+	limiter := newLimiter(cfg)
+
+	if !cfg.MultiAccount() {
+		accountID, err := callerAccountID(sess, limiter, "GetCallerIdentity")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get AWS account ID: %w", err)
+		}
+		return regionTargets(cfg, []accountSession{{accountID: accountID, source: "ambient", sess: sess}}), nil, nil
+	}
+
+	var failures []targetFailure
+	roleArns := append([]string(nil), cfg.AssumeRoleArns...)
+	if cfg.OrgRoleName != "" {
+		var accountIDs []string
+		err := limiter.Do("ListAccounts", func() error {
+			ids, err := ecr.ListOrganizationAccounts(sess)
+			accountIDs = ids
+			return err
+		})
+		if err != nil {
+			failures = append(failures, targetFailure{source: "organizations", err: err})
+		}
+		excluded := make(map[string]bool, len(cfg.OrgExcludeAccounts))
+		for _, id := range cfg.OrgExcludeAccounts {
+			excluded[id] = true
+		}
+		for _, id := range accountIDs {
+			if excluded[id] {
+				if cfg.Debug {
+					log.Printf("[DEBUG] Excluding organization account: %s", id)
+				}
+				continue
+			}
+			roleArns = append(roleArns, ecr.RoleArn(cfg.AWSRegion, id, cfg.OrgRoleName))
+		}
+	}
+
+	var accounts []accountSession
+	seenRole := make(map[string]bool)
+	seenAccount := make(map[string]bool)
+	for _, roleArn := range roleArns {
+		if seenRole[roleArn] {
+			continue
+		}
+		seenRole[roleArn] = true
+
+		roleSess := ecr.AssumeRoleSession(sess, roleArn)
+		accountID, err := callerAccountID(roleSess, limiter, "GetCallerIdentity "+roleArn)
+		if err != nil {
+			log.Printf("Failed to assume role %s: %v", roleArn, err)
+			failures = append(failures, targetFailure{source: roleArn, err: err})
+			continue
+		}
+		if seenAccount[accountID] {
+			log.Printf("Account %s already targeted, skipping role %s", accountID, roleArn)
+			continue
+		}
+		seenAccount[accountID] = true
+		accounts = append(accounts, accountSession{accountID: accountID, source: roleArn, sess: roleSess})
+	}
+	return regionTargets(cfg, accounts), failures, nil
+}
+
+// validateAccountOverrides 在处理任何账户之前校验全部账户的策略覆盖
+// 覆盖取值非法时 ForAccount 直接 panic，提前校验可避免前面的账户已经删除、后面的账户才报错退出
+func validateAccountOverrides(cfg *config.Config, targets []target) {
+	for _, t := range targets {
+		cfg.ForAccount(t.accountID)
+	}
+}
+
+// accountSession 是已确认账户 ID 的 session
+type accountSession struct {
+	accountID string
+	source    string
+	sess      *session.Session
+}
+
+// regionTargets 为每个区域、每个账户创建 ECR 客户端，按区域分组
+func regionTargets(cfg *config.Config, accounts []accountSession) []target {
+	var targets []target
+	for _, region := range cfg.Regions {
+		for _, a := range accounts {
+			client := awsecr.New(a.sess, aws.NewConfig().WithRegion(region))
+			targets = append(targets, target{accountID: a.accountID, source: a.source, region: region, svc: ecr.NewThrottledRegistry(client, newLimiter(cfg))})
+		}
+	}
+	return targets
+}
+
+// callerAccountID 通过限流器调用 STS 获取 session 所属账户 ID
+func callerAccountID(sess *session.Session, limiter *throttle.Limiter, op string) (string, error) {
+	var accountID string
+	err := limiter.Do(op, func() error {
+		var err error
+		accountID, err = ecr.GetAccountID(sess)
+		return err
+	})
+	return accountID, err
+}
@@ -3,30 +3,142 @@ package config
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"aws-ecr-cleaner/internal/util"
 )
 
 // Config 保存所有配置信息
 type Config struct {
-	LogDir            string
-	LogFilePath       string
-	Debug             bool
-	DryRun            bool
-	ListOnly          bool
-	ProtectLatest     int
-	ProtectInUseByK8s bool
-	TargetRepoRegex   string
-	ExcludeRepoRegex  string
-	HoldTagRegex      string
-	AWSRegion         string
-	Env               string
-	ImageListFile     string
-	AutoConfirm       bool // 如果为 true，则跳过交互确认直接删除
-	InteractiveMode   bool // 如果为 true，则保留终端输出，用于交互提示
+	LogDir             string
+	LogFilePath        string
+	Debug              bool
+	DryRun             bool
+	ListOnly           bool
+	ProtectLatest      int
+	ProtectInUseByK8s  bool
+	TargetRepoRegex    string
+	ExcludeRepoRegex   string
+	HoldTagRegex       string
+	AWSRegion          string
+	Env                string
+	ImageListFile      string
+	AutoConfirm        bool          // 如果为 true，则跳过交互确认直接删除
+	InteractiveMode    bool          // 如果为 true，则保留终端输出，用于交互提示
+	RegistryFixture    string        // 若设置，则使用该 fixture 文件构建内存 ECR，不访问 AWS
+	ScanConcurrency    int           // 并发扫描仓库的 worker 数量
+	APIRateLimit       float64       // ECR/STS 调用的稳态速率上限（次/秒）
+	APIBurst           int           // 限流令牌桶容量
+	APIMaxRetries      int           // 限流/可重试错误的最大重试次数
+	APIRetryBaseDelay  time.Duration // 指数退避初始等待
+	APIRetryMaxDelay   time.Duration // 指数退避最大等待
+	DeleteMode         string        // digest：按 digest 删除整个 manifest；untag：只移除过期 tag
+	AssumeRoleArns     []string      // 依次 AssumeRole 清理的账户角色 ARN
+	OrgRoleName        string        // 若设置，则通过 Organizations ListAccounts 发现账户并 AssumeRole 该角色名
+	OrgExcludeAccounts []string      // Organizations 发现时跳过的账户 ID
+	AccountID          string        // 当前清理的账户 ID，由 ForAccount 设置
+	Regions            []string      // 依次清理的区域，未设置 AWS_REGIONS 时只包含 AWSRegion
+	ParallelRegions    bool          // 若为 true，则并行处理各区域
+	ProtectPulledDays  int           // 最近 N 天内被拉取过的镜像一律保留，0 表示不启用
+	IdlePullDays       int           // 只删除 N 天内未被拉取（从未拉取时按推送时间）的镜像，0 表示不启用
+	StoragePrice       float64       // ECR 存储单价（美元 / GB-月），用于估算节省的费用
+	LayerAnalysis      bool          // 若为 true，则获取全部 manifest 按 layer 去重估算可回收存储
+	LifecycleCheck     bool          // 若为 true，则获取各仓库已有的生命周期策略并在本地评估其过期结果
+	RepoHoldTagRegex   string        // 仓库资源 tag 追加的保留正则，由 ForRepository 设置
+	MinImageAgeHours   int           // 推送不足 N 小时的镜像一律保留，0 表示不启用
+
+	// TARGET_REPO_TAGS：按仓库资源 tag 选择目标仓库，与 TARGET_REPO_REGEX 同时满足才处理
+	TargetRepoTags  string
+	RepoTagSelector *util.TagSelector
+
+	// 空仓库删除（默认关闭）：仓库创建超过 EmptyRepoMinAgeHours 且持续为空超过 EmptyRepoMinEmptyHours 才删除
+	DeleteEmptyRepos       bool
+	EmptyRepoMinAgeHours   int
+	EmptyRepoMinEmptyHours int
+	StateFile              string // 跨运行状态文件（记录仓库首次为空的时间、镜像删除标记等）
+	RepoBackupDir          string // 删除仓库前导出仓库设置的目录
+
+	// 删除前归档：设置 ArchiveDir 后，按 digest 删除的镜像先下载为 OCI image layout，校验通过才删除
+	ArchiveDir    string
+	ArchiveFormat string // dir：OCI layout 目录；tar：每次运行打包为一个 tar 文件
+
+	// 标记-清除：镜像需在 DeleteGraceDays 天内持续为候选才删除，首次标记时间记录在 StateFile 中；0 表示发现即删除
+	DeleteGraceDays int
+
+	// 隔离仓库（软删除）：设置 QuarantineRepo 后，按 digest 删除的镜像先复制到该仓库，purge 子命令删除超过 QuarantineRetentionDays 的镜像
+	QuarantineRepo          string
+	QuarantineRetentionDays int
+
+	// 最大镜像年龄：推送超过 MaxImageAgeDays 天的带 tag 镜像即使被保留规则命中也成为候选（正在使用的镜像除外），0 表示不启用
+	MaxImageAgeDays int
+
+	// 按仓库保留最新的 N 个带 tag 镜像与 N 个未打标签镜像，与是否在使用无关，0 表示不启用
+	KeepLatestTagged   int
+	KeepLatestUntagged int
+
+	// TAG_GROUP_RULES：按正则捕获组将 tag 分组，每组保留排序最靠前的 N 个镜像
+	TagGroupRules string
+	TagGroups     []util.TagGroupRule
+
+	// 语义化版本保留：每个版本流保留最新的 SemverKeepMinors 条发布线、每条线最新的 SemverKeepPatches 个正式版本，
+	// 以及高于最新正式版本的 SemverKeepPrereleases 个预发布版本；SemverKeepMinors 为 0 表示不启用
+	SemverKeepMinors      int
+	SemverKeepPatches     int
+	SemverKeepPrereleases int
+}
+
+// accountOverrideKeys 是可以按账户覆盖的清理策略，环境变量名为 <KEY>_<账户 ID>，例如 HOLD_TAG_REGEX_123456789012
+var accountOverrideKeys = []string{
+	"TARGET_REPO_REGEX",
+	"EXCLUDE_REPO_REGEX",
+	"TARGET_REPO_TAGS",
+	"HOLD_TAG_REGEX",
+	"PROTECT_LATEST",
+	"PROTECT_INUSE_BY_K8S",
+	"DELETE_MODE",
+	"PROTECT_PULLED_WITHIN_DAYS",
+	"DELETE_IF_NOT_PULLED_DAYS",
+	"MIN_IMAGE_AGE_HOURS",
+	"MAX_IMAGE_AGE_DAYS",
+	"KEEP_LATEST_TAGGED",
+	"KEEP_LATEST_UNTAGGED",
+	"TAG_GROUP_RULES",
+	"SEMVER_KEEP_MINORS",
+	"SEMVER_KEEP_PATCHES",
+	"SEMVER_KEEP_PRERELEASES",
+}
+
+// 仓库资源 tag 中的保留键：团队无法修改全局 .env，但可以为自己的仓库打 tag 覆盖清理策略
+const (
+	RepoTagSkip          = "ecr-cleaner:skip"           // true：该仓库不参与清理
+	RepoTagProtectLatest = "ecr-cleaner:protect-latest" // 覆盖 PROTECT_LATEST
+	RepoTagHoldTagRegex  = "ecr-cleaner:hold-tag-regex" // 在 HOLD_TAG_REGEX 之外追加的保留正则
+	RepoTagMinAgeHours   = "ecr-cleaner:min-age-hours"  // 覆盖 MIN_IMAGE_AGE_HOURS
+	RepoTagMaxAgeDays    = "ecr-cleaner:max-age-days"   // 覆盖 MAX_IMAGE_AGE_DAYS
+
+	RepoTagKeepLatestTagged   = "ecr-cleaner:keep-latest-tagged"   // 覆盖 KEEP_LATEST_TAGGED
+	RepoTagKeepLatestUntagged = "ecr-cleaner:keep-latest-untagged" // 覆盖 KEEP_LATEST_UNTAGGED
+)
+
+// 归档格式
+const (
+	ArchiveFormatDir = "dir" // 按账户与区域累积的 OCI image layout 目录
+	ArchiveFormatTar = "tar" // 每次运行打包为一个 OCI image layout tar 文件
+)
+
+// repoOverrideKeys 按固定顺序列出仓库 tag 覆盖，保证报告输出稳定
+var repoOverrideKeys = []string{RepoTagSkip, RepoTagProtectLatest, RepoTagHoldTagRegex, RepoTagMinAgeHours, RepoTagMaxAgeDays,
+	RepoTagKeepLatestTagged, RepoTagKeepLatestUntagged}
+
+// RepoOverrides 是从仓库资源 tag 解析出的策略覆盖
+type RepoOverrides struct {
+	Skip    bool     // 仓库选择不参与清理
+	Applied []string // 生效的覆盖，格式为 key=value
 }
 
 func LoadConfig() *Config {
@@ -41,24 +153,112 @@ func LoadConfig() *Config {
 
 	protectLatest := 3
 	if v := os.Getenv("PROTECT_LATEST"); v != "" {
-		if num, err := strconv.Atoi(v); err == nil {
-			protectLatest = num
-		}
+		protectLatest = parseIntAtLeast("PROTECT_LATEST", v, 0)
 	}
 
 	protectInUseByK8s := os.Getenv("PROTECT_INUSE_BY_K8S") == "true"
 	targetRepoRegex := os.Getenv("TARGET_REPO_REGEX")
 	holdTagRegex := os.Getenv("HOLD_TAG_REGEX")
 	excludeRepoRegex := os.Getenv("EXCLUDE_REPO_REGEX")
+	targetRepoTags := os.Getenv("TARGET_REPO_TAGS")
+	repoTagSelector := parseTagSelector("TARGET_REPO_TAGS", targetRepoTags)
 
 	if targetRepoRegex == "" || holdTagRegex == "" {
 		panic("TARGET_REPO_REGEX and HOLD_TAG_REGEX must be set in .env")
 	}
 
+	// 空仓库删除默认关闭；开启后仓库需创建满 EMPTY_REPO_MIN_AGE_HOURS 且持续为空满 EMPTY_REPO_MIN_EMPTY_HOURS（默认均为 24）
+	deleteEmptyRepos := os.Getenv("DELETE_EMPTY_REPOS") == "true"
+	emptyRepoMinAgeHours := 24
+	if v := os.Getenv("EMPTY_REPO_MIN_AGE_HOURS"); v != "" {
+		emptyRepoMinAgeHours = parseIntAtLeast("EMPTY_REPO_MIN_AGE_HOURS", v, 0)
+	}
+	emptyRepoMinEmptyHours := 24
+	if v := os.Getenv("EMPTY_REPO_MIN_EMPTY_HOURS"); v != "" {
+		emptyRepoMinEmptyHours = parseIntAtLeast("EMPTY_REPO_MIN_EMPTY_HOURS", v, 0)
+	}
+	stateFile := os.Getenv("STATE_FILE")
+	if stateFile == "" {
+		stateFile = filepath.Join("state", "ecr_cleaner_state.json")
+	}
+	repoBackupDir := os.Getenv("REPO_BACKUP_DIR")
+	if repoBackupDir == "" {
+		repoBackupDir = filepath.Join("backups", "repositories")
+	}
+
+	// 删除前归档默认关闭；ARCHIVE_FORMAT 为 dir（默认）或 tar
+	archiveDir := os.Getenv("ARCHIVE_DIR")
+	archiveFormat := os.Getenv("ARCHIVE_FORMAT")
+	if archiveFormat == "" {
+		archiveFormat = ArchiveFormatDir
+	}
+	if archiveFormat != ArchiveFormatDir && archiveFormat != ArchiveFormatTar {
+		panic(fmt.Sprintf("Invalid ARCHIVE_FORMAT value '%s'. Must be one of: dir, tar", archiveFormat))
+	}
+
+	// 删除宽限期默认关闭（0）
+	deleteGraceDays := 0
+	if v := os.Getenv("DELETE_GRACE_DAYS"); v != "" {
+		deleteGraceDays = parseIntAtLeast("DELETE_GRACE_DAYS", v, 0)
+	}
+
+	// 镜像年龄规则默认不启用：最小年龄以小时计，最大年龄以天计
+	minImageAgeHours := 0
+	if v := os.Getenv("MIN_IMAGE_AGE_HOURS"); v != "" {
+		minImageAgeHours = parseIntAtLeast("MIN_IMAGE_AGE_HOURS", v, 0)
+	}
+	maxImageAgeDays := 0
+	if v := os.Getenv("MAX_IMAGE_AGE_DAYS"); v != "" {
+		maxImageAgeDays = parseIntAtLeast("MAX_IMAGE_AGE_DAYS", v, 0)
+	}
+
+	// 按仓库保留最新镜像的数量，默认不启用
+	keepLatestTagged := 0
+	if v := os.Getenv("KEEP_LATEST_TAGGED"); v != "" {
+		keepLatestTagged = parseIntAtLeast("KEEP_LATEST_TAGGED", v, 0)
+	}
+	keepLatestUntagged := 0
+	if v := os.Getenv("KEEP_LATEST_UNTAGGED"); v != "" {
+		keepLatestUntagged = parseIntAtLeast("KEEP_LATEST_UNTAGGED", v, 0)
+	}
+
+	// 按 tag 分组保留，默认不启用
+	tagGroupRules := os.Getenv("TAG_GROUP_RULES")
+	tagGroups := parseTagGroupRules("TAG_GROUP_RULES", tagGroupRules)
+
+	// 语义化版本保留默认不启用；启用后每条发布线默认保留最新的正式版本与 1 个更新的预发布版本
+	semverKeepMinors := 0
+	if v := os.Getenv("SEMVER_KEEP_MINORS"); v != "" {
+		semverKeepMinors = parseIntAtLeast("SEMVER_KEEP_MINORS", v, 0)
+	}
+	semverKeepPatches := 1
+	if v := os.Getenv("SEMVER_KEEP_PATCHES"); v != "" {
+		semverKeepPatches = parseIntAtLeast("SEMVER_KEEP_PATCHES", v, 1)
+	}
+	semverKeepPrereleases := 1
+	if v := os.Getenv("SEMVER_KEEP_PRERELEASES"); v != "" {
+		semverKeepPrereleases = parseIntAtLeast("SEMVER_KEEP_PRERELEASES", v, 0)
+	}
+
+	// 隔离仓库默认关闭；隔离的镜像默认保留 30 天
+	quarantineRepo := os.Getenv("QUARANTINE_REPO")
+	quarantineRetentionDays := 30
+	if v := os.Getenv("QUARANTINE_RETENTION_DAYS"); v != "" {
+		quarantineRetentionDays = parseIntAtLeast("QUARANTINE_RETENTION_DAYS", v, 1)
+	}
+
+	// 多区域：AWS_REGIONS 为逗号分隔的区域列表，未设置时只处理 AWS_REGION
 	awsRegion := os.Getenv("AWS_REGION")
-	if awsRegion == "" {
-		panic("AWS_REGION must be set in environment")
+	regions := splitList(os.Getenv("AWS_REGIONS"))
+	if len(regions) == 0 {
+		if awsRegion == "" {
+			panic("AWS_REGION or AWS_REGIONS must be set in environment")
+		}
+		regions = []string{awsRegion}
+	} else if awsRegion == "" {
+		awsRegion = regions[0]
 	}
+	parallelRegions := os.Getenv("PARALLEL_REGIONS") == "true"
 
 	envVal := strings.ToLower(os.Getenv("ENV"))
 	if envVal == "" {
@@ -81,24 +281,348 @@ func LoadConfig() *Config {
 	logFilePath := filepath.Join(logDir, logFilename)
 
 	// 新增两个配置项：
-	autoConfirm := os.Getenv("AUTO_CONFIRM") == "true"           // 若为 true，则自动确认删除
+	autoConfirm := os.Getenv("AUTO_CONFIRM") == "true"         // 若为 true，则自动确认删除
 	interactiveMode := os.Getenv("INTERACTIVE_MODE") == "true" // 若为 true，则在终端保留输出，便于交互
 
+	// 本地/CI 运行时可指定 fixture 文件替代真实 ECR
+	registryFixture := os.Getenv("REGISTRY_FIXTURE")
+
+	// 并发扫描仓库的 worker 数量，默认串行
+	scanConcurrency := 1
+	if v := os.Getenv("SCAN_CONCURRENCY"); v != "" {
+		scanConcurrency = parseIntAtLeast("SCAN_CONCURRENCY", v, 1)
+	}
+
+	// ECR/STS 调用的共享限流与重试参数
+	apiRateLimit := 10.0
+	if v := os.Getenv("API_RATE_LIMIT"); v != "" {
+		num, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(num > 0) || math.IsInf(num, 0) {
+			panic(fmt.Sprintf("Invalid API_RATE_LIMIT value '%s'. Must be a positive number", v))
+		}
+		apiRateLimit = num
+	}
+	apiBurst := 10
+	if v := os.Getenv("API_BURST"); v != "" {
+		apiBurst = parseIntAtLeast("API_BURST", v, 1)
+	}
+	apiMaxRetries := 8
+	if v := os.Getenv("API_MAX_RETRIES"); v != "" {
+		apiMaxRetries = parseIntAtLeast("API_MAX_RETRIES", v, 0)
+	}
+	apiRetryBaseDelay := 500 * time.Millisecond
+	if v := os.Getenv("API_RETRY_BASE_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			panic(fmt.Sprintf("Invalid API_RETRY_BASE_DELAY value '%s'. Must be a non-negative duration such as 500ms", v))
+		}
+		apiRetryBaseDelay = d
+	}
+	apiRetryMaxDelay := 30 * time.Second
+	if v := os.Getenv("API_RETRY_MAX_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			panic(fmt.Sprintf("Invalid API_RETRY_MAX_DELAY value '%s'. Must be a non-negative duration such as 30s", v))
+		}
+		apiRetryMaxDelay = d
+	}
+
+	// 删除模式，默认按 digest 删除整个 manifest
+	deleteMode := parseDeleteMode("DELETE_MODE", os.Getenv("DELETE_MODE"))
+
+	// 基于 LastRecordedPullTime 的保留规则，默认不启用
+	protectPulledDays := 0
+	if v := os.Getenv("PROTECT_PULLED_WITHIN_DAYS"); v != "" {
+		protectPulledDays = parseIntAtLeast("PROTECT_PULLED_WITHIN_DAYS", v, 0)
+	}
+	idlePullDays := 0
+	if v := os.Getenv("DELETE_IF_NOT_PULLED_DAYS"); v != "" {
+		idlePullDays = parseIntAtLeast("DELETE_IF_NOT_PULLED_DAYS", v, 0)
+	}
+
+	// ECR 存储单价，默认 0.10 美元 / GB-月
+	storagePrice := 0.10
+	if v := os.Getenv("STORAGE_PRICE_PER_GB_MONTH"); v != "" {
+		num, err := strconv.ParseFloat(v, 64)
+		if err != nil || !(num >= 0) || math.IsInf(num, 0) {
+			panic(fmt.Sprintf("Invalid STORAGE_PRICE_PER_GB_MONTH value '%s'. Must be a non-negative number", v))
+		}
+		storagePrice = num
+	}
+
+	// layer 去重分析需要获取全部镜像的 manifest，默认关闭
+	layerAnalysis := os.Getenv("LAYER_ANALYSIS") == "true"
+
+	// 评估已有生命周期策略需要为每个仓库额外调用一次 GetLifecyclePolicy，默认关闭
+	lifecycleCheck := os.Getenv("LIFECYCLE_CHECK") == "true"
+
+	// 并行处理区域时无法逐个区域交互确认
+	if parallelRegions && len(regions) > 1 && !autoConfirm && !listOnly {
+		panic("PARALLEL_REGIONS requires AUTO_CONFIRM=true or LIST_ONLY=true")
+	}
+
+	// 多账户：显式角色列表与 Organizations 发现可同时使用
+	assumeRoleArns := splitList(os.Getenv("ASSUME_ROLE_ARNS"))
+	orgRoleName := os.Getenv("ORG_ROLE_NAME")
+	orgExcludeAccounts := splitList(os.Getenv("ORG_EXCLUDE_ACCOUNTS"))
+
 	return &Config{
-		LogDir:            logDir,
-		LogFilePath:       logFilePath,
-		Debug:             debug,
-		DryRun:            dryRun,
-		ListOnly:          listOnly,
-		ProtectLatest:     protectLatest,
-		ProtectInUseByK8s: protectInUseByK8s,
-		TargetRepoRegex:   targetRepoRegex,
-		ExcludeRepoRegex:  excludeRepoRegex,
-		HoldTagRegex:      holdTagRegex,
-		AWSRegion:         awsRegion,
-		Env:               envVal,
-		ImageListFile:     imageListFile,
-		AutoConfirm:       autoConfirm,
-		InteractiveMode:   interactiveMode,
+		LogDir:             logDir,
+		LogFilePath:        logFilePath,
+		Debug:              debug,
+		DryRun:             dryRun,
+		ListOnly:           listOnly,
+		ProtectLatest:      protectLatest,
+		ProtectInUseByK8s:  protectInUseByK8s,
+		TargetRepoRegex:    targetRepoRegex,
+		ExcludeRepoRegex:   excludeRepoRegex,
+		TargetRepoTags:     targetRepoTags,
+		RepoTagSelector:    repoTagSelector,
+		HoldTagRegex:       holdTagRegex,
+		AWSRegion:          awsRegion,
+		Env:                envVal,
+		ImageListFile:      imageListFile,
+		AutoConfirm:        autoConfirm,
+		InteractiveMode:    interactiveMode,
+		RegistryFixture:    registryFixture,
+		ScanConcurrency:    scanConcurrency,
+		APIRateLimit:       apiRateLimit,
+		APIBurst:           apiBurst,
+		APIMaxRetries:      apiMaxRetries,
+		APIRetryBaseDelay:  apiRetryBaseDelay,
+		APIRetryMaxDelay:   apiRetryMaxDelay,
+		DeleteMode:         deleteMode,
+		AssumeRoleArns:     assumeRoleArns,
+		OrgRoleName:        orgRoleName,
+		OrgExcludeAccounts: orgExcludeAccounts,
+		Regions:            regions,
+		ParallelRegions:    parallelRegions,
+		ProtectPulledDays:  protectPulledDays,
+		IdlePullDays:       idlePullDays,
+		StoragePrice:       storagePrice,
+		LayerAnalysis:      layerAnalysis,
+		LifecycleCheck:     lifecycleCheck,
+		MinImageAgeHours:   minImageAgeHours,
+
+		DeleteEmptyRepos:       deleteEmptyRepos,
+		EmptyRepoMinAgeHours:   emptyRepoMinAgeHours,
+		EmptyRepoMinEmptyHours: emptyRepoMinEmptyHours,
+		StateFile:              stateFile,
+		RepoBackupDir:          repoBackupDir,
+
+		ArchiveDir:    archiveDir,
+		ArchiveFormat: archiveFormat,
+
+		DeleteGraceDays: deleteGraceDays,
+
+		QuarantineRepo:          quarantineRepo,
+		QuarantineRetentionDays: quarantineRetentionDays,
+
+		MaxImageAgeDays: maxImageAgeDays,
+
+		KeepLatestTagged:   keepLatestTagged,
+		KeepLatestUntagged: keepLatestUntagged,
+
+		TagGroupRules: tagGroupRules,
+		TagGroups:     tagGroups,
+
+		SemverKeepMinors:      semverKeepMinors,
+		SemverKeepPatches:     semverKeepPatches,
+		SemverKeepPrereleases: semverKeepPrereleases,
+	}
+}
+
+// MultiAccount 判断是否配置了多账户清理
+func (c *Config) MultiAccount() bool {
+	return len(c.AssumeRoleArns) > 0 || c.OrgRoleName != ""
+}
+
+// ForAccount 返回指定账户的配置副本，应用 <KEY>_<账户 ID> 形式的策略覆盖
+func (c *Config) ForAccount(accountID string) *Config {
+	ac := *c
+	ac.AccountID = accountID
+	for _, key := range accountOverrideKeys {
+		envKey := key + "_" + accountID
+		v, ok := os.LookupEnv(envKey)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "TARGET_REPO_REGEX":
+			ac.TargetRepoRegex = v
+		case "EXCLUDE_REPO_REGEX":
+			ac.ExcludeRepoRegex = v
+		case "TARGET_REPO_TAGS":
+			ac.TargetRepoTags = v
+			ac.RepoTagSelector = parseTagSelector(envKey, v)
+		case "HOLD_TAG_REGEX":
+			ac.HoldTagRegex = v
+		case "PROTECT_LATEST":
+			ac.ProtectLatest = parseIntAtLeast(envKey, v, 0)
+		case "PROTECT_INUSE_BY_K8S":
+			ac.ProtectInUseByK8s = v == "true"
+		case "DELETE_MODE":
+			ac.DeleteMode = parseDeleteMode(envKey, v)
+		case "PROTECT_PULLED_WITHIN_DAYS":
+			ac.ProtectPulledDays = parseIntAtLeast(envKey, v, 0)
+		case "DELETE_IF_NOT_PULLED_DAYS":
+			ac.IdlePullDays = parseIntAtLeast(envKey, v, 0)
+		case "MIN_IMAGE_AGE_HOURS":
+			ac.MinImageAgeHours = parseIntAtLeast(envKey, v, 0)
+		case "MAX_IMAGE_AGE_DAYS":
+			ac.MaxImageAgeDays = parseIntAtLeast(envKey, v, 0)
+		case "KEEP_LATEST_TAGGED":
+			ac.KeepLatestTagged = parseIntAtLeast(envKey, v, 0)
+		case "KEEP_LATEST_UNTAGGED":
+			ac.KeepLatestUntagged = parseIntAtLeast(envKey, v, 0)
+		case "TAG_GROUP_RULES":
+			ac.TagGroupRules = v
+			ac.TagGroups = parseTagGroupRules(envKey, v)
+		case "SEMVER_KEEP_MINORS":
+			ac.SemverKeepMinors = parseIntAtLeast(envKey, v, 0)
+		case "SEMVER_KEEP_PATCHES":
+			ac.SemverKeepPatches = parseIntAtLeast(envKey, v, 1)
+		case "SEMVER_KEEP_PRERELEASES":
+			ac.SemverKeepPrereleases = parseIntAtLeast(envKey, v, 0)
+		}
+	}
+	if ac.TargetRepoRegex == "" || ac.HoldTagRegex == "" {
+		panic(fmt.Sprintf("TARGET_REPO_REGEX and HOLD_TAG_REGEX must not be empty for account %s", accountID))
+	}
+	return &ac
+}
+
+// ForRepository 返回应用仓库资源 tag 覆盖后的配置副本
+// tag 由仓库所属团队维护，非法取值不会中止整个运行，而是以错误返回，由调用方跳过该仓库
+func (c *Config) ForRepository(tags map[string]string) (*Config, RepoOverrides, error) {
+	rc := *c
+	var overrides RepoOverrides
+	for _, key := range repoOverrideKeys {
+		v, ok := tags[key]
+		if !ok {
+			continue
+		}
+		switch key {
+		case RepoTagSkip:
+			skip, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, RepoOverrides{}, fmt.Errorf("invalid %s value '%s': must be true or false", key, v)
+			}
+			overrides.Skip = skip
+		case RepoTagProtectLatest:
+			num, err := repoTagInt(key, v, 0)
+			if err != nil {
+				return nil, RepoOverrides{}, err
+			}
+			rc.ProtectLatest = num
+		case RepoTagHoldTagRegex:
+			if err := util.ValidateMultiRegex(v); err != nil {
+				return nil, RepoOverrides{}, fmt.Errorf("invalid %s value '%s': %v", key, v, err)
+			}
+			rc.RepoHoldTagRegex = v
+		case RepoTagMinAgeHours:
+			num, err := repoTagInt(key, v, 0)
+			if err != nil {
+				return nil, RepoOverrides{}, err
+			}
+			rc.MinImageAgeHours = num
+		case RepoTagMaxAgeDays:
+			num, err := repoTagInt(key, v, 0)
+			if err != nil {
+				return nil, RepoOverrides{}, err
+			}
+			rc.MaxImageAgeDays = num
+		case RepoTagKeepLatestTagged:
+			num, err := repoTagInt(key, v, 0)
+			if err != nil {
+				return nil, RepoOverrides{}, err
+			}
+			rc.KeepLatestTagged = num
+		case RepoTagKeepLatestUntagged:
+			num, err := repoTagInt(key, v, 0)
+			if err != nil {
+				return nil, RepoOverrides{}, err
+			}
+			rc.KeepLatestUntagged = num
+		}
+		overrides.Applied = append(overrides.Applied, key+"="+v)
+	}
+	return &rc, overrides, nil
+}
+
+// AccountOverrides 返回指定账户实际生效的策略覆盖（环境变量名），用于报告
+func AccountOverrides(accountID string) []string {
+	var keys []string
+	for _, key := range accountOverrideKeys {
+		if _, ok := os.LookupEnv(key + "_" + accountID); ok {
+			keys = append(keys, key+"_"+accountID)
+		}
+	}
+	return keys
+}
+
+// parseIntAtLeast 解析不小于 min 的整数配置，非法取值直接 panic
+func parseIntAtLeast(envKey, v string, min int) int {
+	num, err := strconv.Atoi(v)
+	if err != nil || num < min {
+		if min == 1 {
+			panic(fmt.Sprintf("Invalid %s value '%s'. Must be a positive integer", envKey, v))
+		}
+		panic(fmt.Sprintf("Invalid %s value '%s'. Must be a non-negative integer", envKey, v))
+	}
+	return num
+}
+
+// repoTagInt 解析仓库 tag 中不小于 min 的整数覆盖，非法取值以错误返回
+func repoTagInt(key, v string, min int) (int, error) {
+	num, err := strconv.Atoi(v)
+	if err != nil || num < min {
+		if min == 1 {
+			return 0, fmt.Errorf("invalid %s value '%s': must be a positive integer", key, v)
+		}
+		return 0, fmt.Errorf("invalid %s value '%s': must be a non-negative integer", key, v)
+	}
+	return num, nil
+}
+
+// parseDeleteMode 校验删除模式，空值默认为 digest
+func parseDeleteMode(envKey, v string) string {
+	mode := strings.ToLower(v)
+	switch mode {
+	case "":
+		return "digest"
+	case "digest", "untag":
+		return mode
+	default:
+		panic(fmt.Sprintf("Invalid %s value '%s'. Must be one of: digest, untag", envKey, mode))
+	}
+}
+
+// parseTagSelector 解析 tag 选择器，语法错误时 panic
+func parseTagSelector(envKey, v string) *util.TagSelector {
+	selector, err := util.ParseTagSelector(v)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid %s value: %v", envKey, err))
+	}
+	return selector
+}
+
+// parseTagGroupRules 解析按 tag 分组的保留规则，非法时 panic
+func parseTagGroupRules(envKey, v string) []util.TagGroupRule {
+	rules, err := util.ParseTagGroupRules(v)
+	if err != nil {
+		panic(fmt.Sprintf("Invalid %s value: %v", envKey, err))
+	}
+	return rules
+}
+
+// splitList 解析逗号分隔的列表，忽略空白项
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
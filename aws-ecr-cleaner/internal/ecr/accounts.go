@@ -0,0 +1,51 @@
+// aws-ecr-cleaner/internal/ecr/accounts.go
+package ecr
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/organizations"
+)
+
+// roleSessionName 是 AssumeRole 时使用的会话名，便于在 CloudTrail 中识别清理操作
+const roleSessionName = "aws-ecr-cleaner"
+
+// AssumeRoleSession 基于 base session 创建使用 roleArn 临时凭证的 session
+// 凭证在首次调用时获取并自动续期，失败会在首次 API 调用（如 GetAccountID）时返回
+func AssumeRoleSession(base *session.Session, roleArn string) *session.Session {
+	creds := stscreds.NewCredentials(base, roleArn, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = roleSessionName
+	})
+	return base.Copy(&aws.Config{Credentials: creds})
+}
+
+// ListOrganizationAccounts 通过 Organizations ListAccounts 返回状态为 ACTIVE 的账户 ID
+// 需要在管理账户或委派管理员账户中调用
+func ListOrganizationAccounts(sess *session.Session) ([]string, error) {
+	var accountIDs []string
+	err := organizations.New(sess).ListAccountsPages(&organizations.ListAccountsInput{}, func(page *organizations.ListAccountsOutput, lastPage bool) bool {
+		for _, account := range page.Accounts {
+			if aws.StringValue(account.Status) == organizations.AccountStatusActive {
+				accountIDs = append(accountIDs, aws.StringValue(account.Id))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return accountIDs, nil
+}
+
+// RoleArn 根据区域所属分区构造账户内指定角色名的 ARN
+func RoleArn(region, accountID, roleName string) string {
+	partition := "aws"
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		partition = p.ID()
+	}
+	return fmt.Sprintf("arn:%s:iam::%s:role/%s", partition, accountID, roleName)
+}
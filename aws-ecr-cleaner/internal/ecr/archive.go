@@ -0,0 +1,164 @@
+// aws-ecr-cleaner/internal/ecr/archive.go
+package ecr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// BlobDownloader 由自带 blob 下载客户端的 Registry 实现：MemoryRegistry 的下载地址为 memory://，由其自己的 RoundTripper 提供内容；
+// 包装其它 Registry 的实现（如 ThrottledRegistry）转发被包装者的客户端
+type BlobDownloader interface {
+	BlobHTTPClient() *http.Client
+}
+
+// blobClient 返回下载 GetDownloadUrlForLayer 预签名地址使用的 HTTP 客户端，Registry 未提供时使用 http.DefaultClient
+func blobClient(svc Registry) *http.Client {
+	if d, ok := svc.(BlobDownloader); ok {
+		if client := d.BlobHTTPClient(); client != nil {
+			return client
+		}
+	}
+	return http.DefaultClient
+}
+
+// DownloadLayer 通过 GetDownloadUrlForLayer 获取预签名地址并下载 blob（layer 或 config），调用方负责关闭返回的 Body
+func DownloadLayer(svc Registry, repositoryName, digest string) (io.ReadCloser, error) {
+	out, err := svc.GetDownloadUrlForLayer(&ecr.GetDownloadUrlForLayerInput{
+		RepositoryName: aws.String(repositoryName),
+		LayerDigest:    aws.String(digest),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := blobClient(svc).Get(aws.StringValue(out.DownloadUrl))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob %s: %w", digest, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to download blob %s: %s", digest, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// getManifest 通过 BatchGetImage 获取单个 manifest 的原始内容，并校验内容的 sha256 与 digest 一致
+func getManifest(svc Registry, repositoryName, digest string) (*Manifest, error) {
+	out, err := svc.BatchGetImage(&ecr.BatchGetImageInput{
+		RepositoryName:     aws.String(repositoryName),
+		ImageIds:           []*ecr.ImageIdentifier{{ImageDigest: aws.String(digest)}},
+		AcceptedMediaTypes: acceptedManifestTypes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Images) == 0 {
+		reason := "not found"
+		if len(out.Failures) > 0 {
+			reason = aws.StringValue(out.Failures[0].FailureReason)
+		}
+		return nil, fmt.Errorf("failed to get manifest %s: %s", digest, reason)
+	}
+	img := out.Images[0]
+	raw := aws.StringValue(img.ImageManifest)
+	sum := sha256.Sum256([]byte(raw))
+	if got := "sha256:" + hex.EncodeToString(sum[:]); got != digest {
+		return nil, fmt.Errorf("digest mismatch for manifest %s: got %s", digest, got)
+	}
+	return ParseManifest(digest, raw, aws.StringValue(img.ImageManifestMediaType))
+}
+
+// ArchiveImage 将候选镜像归档到 layout：manifest、config 与全部 layer（index 时递归包含子 manifest），
+// 写入后重新读取每个 blob 校验大小与 sha256，全部通过后才写入 index.json，返回镜像 manifest 的描述符
+// 调用方只应在返回 nil 错误后删除镜像
+func ArchiveImage(svc Registry, layout *OCILayout, c Candidate, now time.Time) (Descriptor, error) {
+	var written []Descriptor
+	root, err := archiveManifest(svc, layout, c.RepositoryName, c.ImageDigest, &written)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	for _, d := range written {
+		if err := layout.VerifyBlob(d); err != nil {
+			return Descriptor{}, fmt.Errorf("archive verification failed: %w", err)
+		}
+	}
+
+	var entries []Descriptor
+	annotate := func(tag string) Descriptor {
+		d := Descriptor{MediaType: root.MediaType, Digest: root.Digest, Size: root.Size, Annotations: map[string]string{
+			AnnotationRepository: c.RepositoryName,
+			AnnotationArchivedAt: now.UTC().Format(time.RFC3339),
+		}}
+		if tag != "" {
+			d.Annotations[AnnotationRefName] = tag
+		}
+		return d
+	}
+	for _, tag := range c.ImageTags {
+		entries = append(entries, annotate(tag))
+	}
+	if len(c.ImageTags) == 0 {
+		entries = append(entries, annotate(""))
+	}
+	if err := layout.AddToIndex(entries); err != nil {
+		return Descriptor{}, fmt.Errorf("failed to update archive index: %w", err)
+	}
+	return root, nil
+}
+
+// archiveManifest 归档单个 manifest 及其引用的内容，written 收集本次涉及的全部 blob 描述符供校验
+func archiveManifest(svc Registry, layout *OCILayout, repositoryName, digest string, written *[]Descriptor) (Descriptor, error) {
+	m, err := getManifest(svc, repositoryName, digest)
+	if err != nil {
+		return Descriptor{}, err
+	}
+	desc := Descriptor{MediaType: m.MediaType, Digest: digest, Size: int64(len(m.Raw))}
+	if !layout.HasBlob(digest) {
+		if _, err := layout.WriteBlob(digest, strings.NewReader(m.Raw)); err != nil {
+			return Descriptor{}, err
+		}
+	}
+	*written = append(*written, desc)
+
+	if m.IsIndex() {
+		for _, child := range m.Manifests {
+			if _, err := archiveManifest(svc, layout, repositoryName, child.Digest, written); err != nil {
+				return Descriptor{}, fmt.Errorf("child manifest %s: %w", child.Digest, err)
+			}
+		}
+		return desc, nil
+	}
+
+	var blobs []Descriptor
+	if m.Config != nil {
+		blobs = append(blobs, *m.Config)
+	}
+	blobs = append(blobs, m.Layers...)
+	for _, b := range blobs {
+		// 外部（non-distributable）layer 不在 ECR 中保存，无法也无需归档
+		if strings.Contains(b.MediaType, "nondistributable") || strings.Contains(b.MediaType, "foreign") {
+			continue
+		}
+		if !layout.HasBlob(b.Digest) {
+			body, err := DownloadLayer(svc, repositoryName, b.Digest)
+			if err != nil {
+				return Descriptor{}, err
+			}
+			_, err = layout.WriteBlob(b.Digest, body)
+			body.Close()
+			if err != nil {
+				return Descriptor{}, err
+			}
+		}
+		*written = append(*written, b)
+	}
+	return desc, nil
+}
@@ -0,0 +1,105 @@
+package ecr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// contentDigest 返回内容的 sha256 digest
+func contentDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// multiArchFixture 构造一个内容真实可校验的多架构镜像：index（tag v1）→ 子 manifest → config 与 layer
+// 返回 fixture 与 index、子 manifest 的 digest
+func multiArchFixture() (Fixture, string, string) {
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	layer := []byte("layer contents")
+	child := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":%q,"size":%d},"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar+gzip","digest":%q,"size":%d}]}`,
+		MediaTypeOCIManifest, contentDigest(config), len(config), contentDigest(layer), len(layer)))
+	index := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[{"mediaType":%q,"digest":%q,"size":%d,"platform":{"architecture":"amd64","os":"linux"}}]}`,
+		MediaTypeOCIIndex, MediaTypeOCIManifest, contentDigest(child), len(child)))
+
+	indexDigest, childDigest := contentDigest(index), contentDigest(child)
+	return Fixture{
+		AccountID: "123456789012",
+		Repositories: []FixtureRepository{{
+			RepositoryName: testRepo,
+			Images:         []*ecr.ImageDetail{image(indexDigest, day, "v1"), image(childDigest, day)},
+			Manifests:      map[string]json.RawMessage{indexDigest: index, childDigest: child},
+		}},
+		Blobs: map[string][]byte{contentDigest(config): config, contentDigest(layer): layer},
+	}, indexDigest, childDigest
+}
+
+func TestArchiveImage(t *testing.T) {
+	fixture, indexDigest, childDigest := multiArchFixture()
+	source := NewMemoryRegistry(fixture, "us-east-1")
+	dir := t.TempDir()
+	layout, err := OpenOCILayout(filepath.Join(dir, "layout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := ArchiveImage(source, layout, candidate(indexDigest, day, "v1"), testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Digest != indexDigest || root.MediaType != MediaTypeOCIIndex {
+		t.Fatalf("archived root = %+v, want index %s", root, indexDigest)
+	}
+	// index、子 manifest、config 与 layer 均写入 layout
+	for _, digest := range append([]string{indexDigest, childDigest}, mapKeys(fixture.Blobs)...) {
+		if !layout.HasBlob(digest) {
+			t.Errorf("blob %s missing from archive", digest)
+		}
+	}
+
+	idx, err := layout.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, ok := idx.Find(testRepo, "v1")
+	if !ok {
+		t.Fatalf("v1 not found in archive index: %+v", idx.Manifests)
+	}
+	if desc.Annotations[AnnotationArchivedAt] != testNow.Format(time.RFC3339) {
+		t.Errorf("archived-at = %q, want %q", desc.Annotations[AnnotationArchivedAt], testNow.Format(time.RFC3339))
+	}
+	if byDigest, ok := idx.Find(testRepo, indexDigest); !ok || !reflect.DeepEqual(byDigest, desc) {
+		t.Errorf("lookup by digest = %+v, want %+v", byDigest, desc)
+	}
+	if _, ok := idx.Find("saas/web", "v1"); ok {
+		t.Error("v1 found under another repository")
+	}
+
+	tarPath := filepath.Join(dir, "archive.tar")
+	if err := PackOCILayout(layout.Root, tarPath); err != nil {
+		t.Fatal(err)
+	}
+	packed, err := VerifyOCITarball(tarPath)
+	if err != nil {
+		t.Fatalf("packed archive does not verify: %v", err)
+	}
+	if !reflect.DeepEqual(packed, idx) {
+		t.Errorf("packed index = %+v, want %+v", packed, idx)
+	}
+}
+
+// mapKeys 返回 map 的键
+func mapKeys(m map[string][]byte) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,145 @@
+// aws-ecr-cleaner/internal/ecr/backup.go
+package ecr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// RepositoryBackup 是删除仓库前导出的仓库设置，字段足以通过 CreateRepository、SetRepositoryPolicy、
+// PutLifecyclePolicy 原样重建仓库；策略保留原始文本，不做解析与格式化
+type RepositoryBackup struct {
+	RepositoryName             string                          `json:"repositoryName"`
+	RepositoryArn              string                          `json:"repositoryArn"`
+	RepositoryUri              string                          `json:"repositoryUri"`
+	RegistryId                 string                          `json:"registryId"`
+	CreatedAt                  time.Time                       `json:"createdAt"`
+	ExportedAt                 time.Time                       `json:"exportedAt"`
+	ImageTagMutability         string                          `json:"imageTagMutability,omitempty"`
+	ImageScanningConfiguration *ecr.ImageScanningConfiguration `json:"imageScanningConfiguration,omitempty"`
+	EncryptionConfiguration    *ecr.EncryptionConfiguration    `json:"encryptionConfiguration,omitempty"`
+	Tags                       []*ecr.Tag                      `json:"tags,omitempty"`
+	RepositoryPolicy           string                          `json:"repositoryPolicy,omitempty"`
+	LifecyclePolicy            string                          `json:"lifecyclePolicy,omitempty"`
+}
+
+// ExportRepository 导出仓库的策略、生命周期策略、资源 tag、镜像扫描与加密设置
+// 仓库未设置策略或生命周期策略时对应字段为空；其它错误直接返回，调用方不应在导出失败时删除仓库
+func ExportRepository(svc Registry, repo *ecr.Repository, now time.Time) (*RepositoryBackup, error) {
+	name := aws.StringValue(repo.RepositoryName)
+	backup := &RepositoryBackup{
+		RepositoryName:             name,
+		RepositoryArn:              aws.StringValue(repo.RepositoryArn),
+		RepositoryUri:              aws.StringValue(repo.RepositoryUri),
+		RegistryId:                 aws.StringValue(repo.RegistryId),
+		CreatedAt:                  aws.TimeValue(repo.CreatedAt),
+		ExportedAt:                 now,
+		ImageTagMutability:         aws.StringValue(repo.ImageTagMutability),
+		ImageScanningConfiguration: repo.ImageScanningConfiguration,
+		EncryptionConfiguration:    repo.EncryptionConfiguration,
+	}
+
+	policy, err := svc.GetRepositoryPolicy(&ecr.GetRepositoryPolicyInput{RepositoryName: aws.String(name)})
+	if err != nil && !isErrorCode(err, ecr.ErrCodeRepositoryPolicyNotFoundException) {
+		return nil, err
+	}
+	if err == nil {
+		backup.RepositoryPolicy = aws.StringValue(policy.PolicyText)
+	}
+
+	lifecycle, err := svc.GetLifecyclePolicy(&ecr.GetLifecyclePolicyInput{RepositoryName: aws.String(name)})
+	if err != nil && !isErrorCode(err, ecr.ErrCodeLifecyclePolicyNotFoundException) {
+		return nil, err
+	}
+	if err == nil {
+		backup.LifecyclePolicy = aws.StringValue(lifecycle.LifecyclePolicyText)
+	}
+
+	tags, err := svc.ListTagsForResource(&ecr.ListTagsForResourceInput{ResourceArn: repo.RepositoryArn})
+	if err != nil {
+		return nil, err
+	}
+	backup.Tags = tags.Tags
+	return backup, nil
+}
+
+// LoadRepositoryBackup 读取 ExportRepository 导出的仓库设置文件
+func LoadRepositoryBackup(path string) (*RepositoryBackup, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b RepositoryBackup
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("failed to parse repository backup '%s': %w", path, err)
+	}
+	return &b, nil
+}
+
+// RecreateRepository 创建仓库；backup 不为 nil 时按导出的设置重建（tag 可变性、镜像扫描、加密、资源 tag、仓库策略与生命周期策略），
+// 否则使用 ECR 默认设置。策略写入失败时返回错误，此时仓库已创建
+func RecreateRepository(svc Registry, name string, backup *RepositoryBackup) (*ecr.Repository, error) {
+	input := &ecr.CreateRepositoryInput{RepositoryName: aws.String(name)}
+	if backup != nil {
+		if backup.ImageTagMutability != "" {
+			input.ImageTagMutability = aws.String(backup.ImageTagMutability)
+		}
+		input.ImageScanningConfiguration = backup.ImageScanningConfiguration
+		input.EncryptionConfiguration = backup.EncryptionConfiguration
+		input.Tags = backup.Tags
+	}
+	out, err := svc.CreateRepository(input)
+	if err != nil {
+		return nil, err
+	}
+	if backup == nil {
+		return out.Repository, nil
+	}
+	if backup.RepositoryPolicy != "" {
+		if _, err := svc.SetRepositoryPolicy(&ecr.SetRepositoryPolicyInput{
+			RepositoryName: aws.String(name),
+			PolicyText:     aws.String(backup.RepositoryPolicy),
+		}); err != nil {
+			return out.Repository, fmt.Errorf("failed to restore repository policy: %w", err)
+		}
+	}
+	if backup.LifecyclePolicy != "" {
+		if err := PutLifecyclePolicy(svc, name, backup.LifecyclePolicy); err != nil {
+			return out.Repository, fmt.Errorf("failed to restore lifecycle policy: %w", err)
+		}
+	}
+	return out.Repository, nil
+}
+
+// ErrRepositoryNotEmpty 表示要删除的仓库中已有镜像
+var ErrRepositoryNotEmpty = errors.New("repository is not empty")
+
+// DeleteEmptyRepository 删除空仓库；不使用 Force，仓库中已有镜像时 ECR 拒绝删除，返回 ErrRepositoryNotEmpty
+func DeleteEmptyRepository(svc Registry, name string) error {
+	_, err := svc.DeleteRepository(&ecr.DeleteRepositoryInput{
+		RepositoryName: aws.String(name),
+		Force:          aws.Bool(false),
+	})
+	if isErrorCode(err, ecr.ErrCodeRepositoryNotEmptyException) {
+		return ErrRepositoryNotEmpty
+	}
+	return err
+}
+
+// JSON 返回备份的 JSON 文本
+func (b *RepositoryBackup) JSON() ([]byte, error) {
+	return json.MarshalIndent(b, "", "  ")
+}
+
+// isErrorCode 判断 err 是否为指定错误码的 AWS 错误
+func isErrorCode(err error, code string) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == code
+}
@@ -2,6 +2,7 @@
 package ecr
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"sort"
@@ -15,13 +16,36 @@ import (
 	"github.com/aws/aws-sdk-go/service/sts"
 )
 
+// 删除模式
+const (
+	DeleteModeDigest = "digest" // 按 digest 删除整个 manifest（连同其所有 tag）
+	DeleteModeUntag  = "untag"  // 只移除过期 tag；全部 tag 均过期时按 digest 删除
+)
+
 // Candidate 保存待删除的镜像信息
 type Candidate struct {
 	RepositoryName string
 	RepositoryUri  string
 	ImageDigest    string
-	ImageTag       string
+	ImageTags      []string // 镜像当前的全部 tag，未打标签时为空
+	StaleTags      []string // 未单独命中 holdTagRegex 的 tag，untag 模式下只移除这些 tag
 	PushTime       time.Time
+	PullTime       time.Time // LastRecordedPullTime，从未记录拉取时为零值
+	Size           int64     // ImageSizeInBytes，按 digest 删除时可回收的存储上限
+	IsIndex        bool      // 多架构 index / manifest list
+}
+
+// RemovesManifest 判断在给定删除模式下是否会按 digest 删除整个 manifest
+func (c Candidate) RemovesManifest(mode string) bool {
+	return mode != DeleteModeUntag || len(c.ImageTags) == 0 || len(c.StaleTags) == len(c.ImageTags)
+}
+
+// Retained 记录被规则保留（不删除）的镜像及原因
+type Retained struct {
+	RepositoryName string
+	ImageDigest    string
+	ImageTags      []string
+	Reason         string
 }
 
 // ScannedImage 保存扫描到的镜像信息
@@ -31,10 +55,12 @@ type ScannedImage struct {
 	ImageDigest    string
 	ImageTags      []string
 	PushTime       time.Time
+	PullTime       time.Time
+	Size           int64
 }
 
 // GetRepositories 获取所有仓库，并用 compositeRegex 过滤
-func GetRepositories(svc *ecr.ECR, compositeRegex string, debug bool) ([]*ecr.Repository, error) {
+func GetRepositories(svc Registry, compositeRegex string, debug bool) ([]*ecr.Repository, error) {
 	var repos []*ecr.Repository
 	input := &ecr.DescribeRepositoriesInput{}
 	err := svc.DescribeRepositoriesPages(input, func(page *ecr.DescribeRepositoriesOutput, lastPage bool) bool {
@@ -55,8 +81,38 @@ func GetRepositories(svc *ecr.ECR, compositeRegex string, debug bool) ([]*ecr.Re
 	return repos, nil
 }
 
+// GetRepository 按名称获取单个仓库，仓库不存在时返回 nil
+func GetRepository(svc Registry, repositoryName string) (*ecr.Repository, error) {
+	var repo *ecr.Repository
+	err := svc.DescribeRepositoriesPages(&ecr.DescribeRepositoriesInput{
+		RepositoryNames: []*string{aws.String(repositoryName)},
+	}, func(page *ecr.DescribeRepositoriesOutput, lastPage bool) bool {
+		if len(page.Repositories) > 0 {
+			repo = page.Repositories[0]
+		}
+		return false
+	})
+	if isErrorCode(err, ecr.ErrCodeRepositoryNotFoundException) {
+		return nil, nil
+	}
+	return repo, err
+}
+
+// GetRepositoryTags 获取仓库的资源 tag
+func GetRepositoryTags(svc Registry, repositoryArn string) (map[string]string, error) {
+	out, err := svc.ListTagsForResource(&ecr.ListTagsForResourceInput{ResourceArn: aws.String(repositoryArn)})
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(out.Tags))
+	for _, t := range out.Tags {
+		tags[aws.StringValue(t.Key)] = aws.StringValue(t.Value)
+	}
+	return tags, nil
+}
+
 // GetImages 获取指定仓库的所有镜像详情
-func GetImages(svc *ecr.ECR, repositoryName string, debug bool) ([]*ecr.ImageDetail, error) {
+func GetImages(svc Registry, repositoryName string, debug bool) ([]*ecr.ImageDetail, error) {
 	var images []*ecr.ImageDetail
 	input := &ecr.DescribeImagesInput{
 		RepositoryName: aws.String(repositoryName),
@@ -74,26 +130,54 @@ func GetImages(svc *ecr.ECR, repositoryName string, debug bool) ([]*ecr.ImageDet
 	return images, nil
 }
 
-// FilterImagesForDeletion 根据规则过滤候选镜像
+// FilterRules 是 FilterImagesForDeletion 选择候选镜像的规则
+type FilterRules struct {
+	HoldTagRegex     string
+	ProtectLatest    int  // 保护最新的 N 个正在使用的镜像
+	ProtectInUse     bool // 是否按 in-use 列表区分正在使用的镜像
+	KeepLatestTagged int  // 始终保留最新的 N 个带 tag 镜像（未命中 HoldTagRegex 的），与是否在使用无关
+
+	TagGroups []util.TagGroupRule // 按 tag 分组，每组保留排序最靠前的 N 个镜像，与是否在使用无关
+	Semver    SemverRules         // 按语义化版本保留最新的发布线、正式版本与预发布版本
+}
+
+// FilterImagesForDeletion 根据规则过滤候选镜像，返回候选与按保留规则（TagGroups、Semver、KeepLatestTagged）保留的镜像
 // 修改：若镜像未打标签，则直接加入候选删除列表
-func FilterImagesForDeletion(images []*ecr.ImageDetail, holdTagRegex string, protectLatest int, inUse map[string]bool, repositoryUri string, protectInUse bool, debug bool) []Candidate {
+func FilterImagesForDeletion(images []*ecr.ImageDetail, rules FilterRules, inUse map[string]bool, repositoryUri string, debug bool) ([]Candidate, []Retained) {
 	var inUseCandidates []Candidate
 	var notInUseCandidates []Candidate
+	var retained []Retained
+	holdTagRegex := rules.HoldTagRegex
 
 	trimmedRepoUri := util.TrimRegistry(repositoryUri)
 
+	// 分组保留、语义化版本保留与最新的 N 个带 tag 镜像在 in-use 判断之前保留，不占用 PROTECT_LATEST 的名额
+	keptBy := make(map[string]string)
+	for _, reasons := range []map[string]string{keepByTagGroups(images, holdTagRegex, rules.TagGroups), keepBySemver(images, holdTagRegex, rules.Semver)} {
+		for digest, reason := range reasons {
+			if _, ok := keptBy[digest]; !ok {
+				keptBy[digest] = reason
+			}
+		}
+	}
+	newest := newestTagged(images, holdTagRegex, rules.KeepLatestTagged)
+
 	for _, image := range images {
 		var pushTime time.Time
 		if image.ImagePushedAt != nil {
 			pushTime = *image.ImagePushedAt
 		}
+		pullTime := aws.TimeValue(image.LastRecordedPullTime)
+		size := aws.Int64Value(image.ImageSizeInBytes)
 		// 若镜像未打标签，直接作为候选删除
 		if image.ImageTags == nil || len(image.ImageTags) == 0 {
 			cand := Candidate{
 				RepositoryUri: repositoryUri,
 				ImageDigest:   aws.StringValue(image.ImageDigest),
-				ImageTag:      "", // untagged
 				PushTime:      pushTime,
+				PullTime:      pullTime,
+				Size:          size,
+				IsIndex:       IsIndexMediaType(aws.StringValue(image.ImageManifestMediaType)),
 			}
 			notInUseCandidates = append(notInUseCandidates, cand)
 			continue
@@ -114,21 +198,52 @@ func FilterImagesForDeletion(images []*ecr.ImageDetail, holdTagRegex string, pro
 			continue
 		}
 
+		if reason, ok := keptBy[aws.StringValue(image.ImageDigest)]; ok {
+			retained = append(retained, Retained{
+				RepositoryName: aws.StringValue(image.RepositoryName),
+				ImageDigest:    aws.StringValue(image.ImageDigest),
+				ImageTags:      tagList,
+				Reason:         reason,
+			})
+			continue
+		}
+		if rank, ok := newest[aws.StringValue(image.ImageDigest)]; ok {
+			retained = append(retained, Retained{
+				RepositoryName: aws.StringValue(image.RepositoryName),
+				ImageDigest:    aws.StringValue(image.ImageDigest),
+				ImageTags:      tagList,
+				Reason:         fmt.Sprintf("newest tagged image %d of %d (KEEP_LATEST_TAGGED)", rank, rules.KeepLatestTagged),
+			})
+			continue
+		}
+
 		used := false
 		for _, tag := range image.ImageTags {
 			tagVal := aws.StringValue(tag)
 			fullImageUri := fmt.Sprintf("%s:%s", trimmedRepoUri, tagVal)
-			if protectInUse && inUse[fullImageUri] {
+			if rules.ProtectInUse && inUse[fullImageUri] {
 				used = true
 				break
 			}
 		}
 
+		// 逐个 tag 判断是否命中 holdTagRegex，未命中的 tag 视为过期 tag
+		var staleTags []string
+		for _, tagVal := range tagList {
+			if !util.HoldTagMatch(tagVal, holdTagRegex) {
+				staleTags = append(staleTags, tagVal)
+			}
+		}
+
 		cand := Candidate{
 			RepositoryUri: repositoryUri,
 			ImageDigest:   aws.StringValue(image.ImageDigest),
-			ImageTag:      aws.StringValue(image.ImageTags[0]),
+			ImageTags:     tagList,
+			StaleTags:     staleTags,
 			PushTime:      pushTime,
+			PullTime:      pullTime,
+			Size:          size,
+			IsIndex:       IsIndexMediaType(aws.StringValue(image.ImageManifestMediaType)),
 		}
 
 		if used {
@@ -141,7 +256,7 @@ func FilterImagesForDeletion(images []*ecr.ImageDetail, holdTagRegex string, pro
 	sort.Slice(inUseCandidates, func(i, j int) bool {
 		return inUseCandidates[i].PushTime.After(inUseCandidates[j].PushTime)
 	})
-	protectedCount := protectLatest
+	protectedCount := rules.ProtectLatest
 	if protectedCount > len(inUseCandidates) {
 		protectedCount = len(inUseCandidates)
 	}
@@ -154,7 +269,32 @@ func FilterImagesForDeletion(images []*ecr.ImageDetail, holdTagRegex string, pro
 	}
 
 	candidates := append(notInUseCandidates, inUseForDeletion...)
-	return candidates
+	return candidates, retained
+}
+
+// newestTagged 返回推送时间最新的 n 个带 tag 镜像（命中 holdTagRegex 的除外）的 digest 及其名次（从 1 开始），n <= 0 时返回 nil
+func newestTagged(images []*ecr.ImageDetail, holdTagRegex string, n int) map[string]int {
+	if n <= 0 {
+		return nil
+	}
+	var tagged []*ecr.ImageDetail
+	for _, image := range images {
+		tags := aws.StringValueSlice(image.ImageTags)
+		if len(tags) > 0 && !util.HoldTagMatch(fmt.Sprintf("%s", tags), holdTagRegex) {
+			tagged = append(tagged, image)
+		}
+	}
+	sort.SliceStable(tagged, func(i, j int) bool {
+		return aws.TimeValue(tagged[i].ImagePushedAt).After(aws.TimeValue(tagged[j].ImagePushedAt))
+	})
+	newest := make(map[string]int, n)
+	for i, image := range tagged {
+		if i == n {
+			break
+		}
+		newest[aws.StringValue(image.ImageDigest)] = i + 1
+	}
+	return newest
 }
 
 // GetAccountID 调用 STS 获取 AWS 账户 ID
@@ -168,37 +308,157 @@ func GetAccountID(sess *session.Session) (string, error) {
 	return aws.StringValue(result.Account), nil
 }
 
-// DeleteImage 删除候选镜像
-func DeleteImage(svc *ecr.ECR, candidate Candidate, dryRun bool, debug bool) error {
-	if dryRun {
-		log.Printf("[Dry-run] Would delete image in repository %s: Tag %s, Digest %s", candidate.RepositoryName, candidate.ImageTag, candidate.ImageDigest)
-		return nil
+// maxBatchDeleteIds 是 BatchDeleteImage 单次请求允许的最大 ImageIds 数量
+const maxBatchDeleteIds = 100
+
+// ErrNothingToUntag 表示 untag 模式下候选没有可移除的过期 tag，不生成任何 ImageId，镜像未做任何改动
+var ErrNothingToUntag = errors.New("nothing to untag: no stale tags")
+
+// DeleteResult 记录单个候选镜像的删除结果，Err 为 nil 表示全部 ImageId 删除成功
+type DeleteResult struct {
+	Candidate     Candidate
+	RemovedTags   []string // 实际移除的 tag（按 digest 删除时为镜像的全部 tag）
+	DigestDeleted bool     // manifest 是否已按 digest 删除
+	Err           error
+}
+
+// batchItem 是一次 BatchDeleteImage 请求中的单个 ImageId 及其所属候选
+type batchItem struct {
+	index int
+	id    *ecr.ImageIdentifier
+}
+
+// imageIdKey 生成 ImageIdentifier 的匹配键，用于将 result.Failures 映射回候选镜像
+func imageIdKey(id *ecr.ImageIdentifier) string {
+	return aws.StringValue(id.ImageDigest) + "|" + aws.StringValue(id.ImageTag)
+}
+
+// candidateIdentifiers 根据删除模式构造候选镜像的 ImageIdentifier
+// digest 模式只携带 digest，避免同时指定 tag 时 ECR 仅移除该 tag 而保留镜像；untag 模式每个过期 tag 一个 ImageId
+func candidateIdentifiers(candidate Candidate, mode string) []*ecr.ImageIdentifier {
+	if candidate.RemovesManifest(mode) {
+		return []*ecr.ImageIdentifier{{ImageDigest: aws.String(candidate.ImageDigest)}}
+	}
+	ids := make([]*ecr.ImageIdentifier, 0, len(candidate.StaleTags))
+	for _, tag := range candidate.StaleTags {
+		ids = append(ids, &ecr.ImageIdentifier{ImageTag: aws.String(tag)})
+	}
+	return ids
+}
+
+// DeleteImages 按仓库分组批量删除候选镜像，每次 BatchDeleteImage 最多携带 100 个 ImageId
+// 返回结果与传入候选顺序一致，单个 ID 的失败原因来自 result.Failures；没有可移除 tag 的候选以 ErrNothingToUntag 跳过
+func DeleteImages(svc Registry, candidates []Candidate, mode string, dryRun bool, debug bool) []DeleteResult {
+	results := make([]DeleteResult, len(candidates))
+
+	// 按 RepositoryName 分组，保持首次出现的仓库顺序
+	var repoOrder []string
+	byRepo := make(map[string][]batchItem)
+	for i, cand := range candidates {
+		results[i].Candidate = cand
+		ids := candidateIdentifiers(cand, mode)
+		if len(ids) == 0 {
+			results[i].Err = ErrNothingToUntag
+			continue
+		}
+		if _, ok := byRepo[cand.RepositoryName]; !ok {
+			repoOrder = append(repoOrder, cand.RepositoryName)
+		}
+		for _, id := range ids {
+			byRepo[cand.RepositoryName] = append(byRepo[cand.RepositoryName], batchItem{index: i, id: id})
+		}
+	}
+
+	for _, repoName := range repoOrder {
+		// index 先于子 manifest 删除，否则 ECR 会以 ImageReferencedByManifestList 拒绝删除子 manifest
+		items := byRepo[repoName]
+		sort.SliceStable(items, func(i, j int) bool {
+			return results[items[i].index].Candidate.IsIndex && !results[items[j].index].Candidate.IsIndex
+		})
+		for start := 0; start < len(items); start += maxBatchDeleteIds {
+			end := start + maxBatchDeleteIds
+			if end > len(items) {
+				end = len(items)
+			}
+			deleteBatch(svc, repoName, items[start:end], results, dryRun, debug)
+		}
 	}
+	return results
+}
 
-	// 构造 ImageIdentifier，如果 ImageTag 为空，则不设置该字段
-	imageIdentifier := &ecr.ImageIdentifier{
-		ImageDigest: aws.String(candidate.ImageDigest),
+// recordRemoval 将单个成功的 ImageId 记入结果
+func recordRemoval(r *DeleteResult, id *ecr.ImageIdentifier) {
+	if id.ImageTag != nil {
+		r.RemovedTags = append(r.RemovedTags, aws.StringValue(id.ImageTag))
+		return
 	}
-	if candidate.ImageTag != "" {
-		imageIdentifier.ImageTag = aws.String(candidate.ImageTag)
+	r.DigestDeleted = true
+	r.RemovedTags = append(r.RemovedTags, r.Candidate.ImageTags...)
+}
+
+// deleteBatch 对同一仓库内的一批 ImageId 执行一次 BatchDeleteImage，并回填 results
+func deleteBatch(svc Registry, repoName string, items []batchItem, results []DeleteResult, dryRun bool, debug bool) {
+	if dryRun {
+		for _, item := range items {
+			log.Printf("[Dry-run] Would delete image in repository %s: Tag %s, Digest %s", repoName, aws.StringValue(item.id.ImageTag), results[item.index].Candidate.ImageDigest)
+			recordRemoval(&results[item.index], item.id)
+		}
+		return
+	}
+
+	imageIds := make([]*ecr.ImageIdentifier, 0, len(items))
+	byKey := make(map[string]batchItem, len(items))
+	for _, item := range items {
+		imageIds = append(imageIds, item.id)
+		byKey[imageIdKey(item.id)] = item
 	}
 
 	delInput := &ecr.BatchDeleteImageInput{
-		RepositoryName: aws.String(candidate.RepositoryName),
-		ImageIds:       []*ecr.ImageIdentifier{imageIdentifier},
+		RepositoryName: aws.String(repoName),
+		ImageIds:       imageIds,
 	}
 	result, err := svc.BatchDeleteImage(delInput)
 	if err != nil {
-		return err
-	}
-	if len(result.Failures) > 0 {
-		return fmt.Errorf("failed to delete image: %v", result.Failures)
+		for _, item := range items {
+			results[item.index].Err = err
+		}
+		return
 	}
 	if debug {
-		log.Printf("[DEBUG] Deleted image response: %v", result)
+		log.Printf("[DEBUG] Batch delete response for repository %s: %d deleted, %d failures", repoName, len(result.ImageIds), len(result.Failures))
+	}
+
+	failed := make(map[string]bool)
+	for _, failure := range result.Failures {
+		if failure.ImageId == nil {
+			continue
+		}
+		failErr := fmt.Errorf("%s: %s", aws.StringValue(failure.FailureCode), aws.StringValue(failure.FailureReason))
+		key := imageIdKey(failure.ImageId)
+		if item, ok := byKey[key]; ok {
+			results[item.index].Err = failErr
+			failed[key] = true
+			continue
+		}
+		// 部分失败只回传 digest 或 tag，退而按单一字段匹配
+		digest := aws.StringValue(failure.ImageId.ImageDigest)
+		tag := aws.StringValue(failure.ImageId.ImageTag)
+		for _, item := range items {
+			cand := results[item.index].Candidate
+			if (digest != "" && cand.ImageDigest == digest) || (tag != "" && aws.StringValue(item.id.ImageTag) == tag) {
+				results[item.index].Err = failErr
+				failed[imageIdKey(item.id)] = true
+			}
+		}
+	}
+
+	for _, item := range items {
+		if failed[imageIdKey(item.id)] {
+			continue
+		}
+		recordRemoval(&results[item.index], item.id)
+		log.Printf("Deleted image (Tag %s, Digest %s) in repository %s", aws.StringValue(item.id.ImageTag), results[item.index].Candidate.ImageDigest, repoName)
 	}
-	log.Printf("Deleted image (Tag %s) in repository %s", candidate.ImageTag, candidate.RepositoryName)
-	return nil
 }
 
 // MultiRegexMatch 暴露工具函数给外部使用（如在过滤仓库时使用 EXCLUDE_REPO_REGEX）
@@ -0,0 +1,408 @@
+package ecr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"aws-ecr-cleaner/internal/util"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// testNow 是测试使用的固定当前时间
+var testNow = time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+
+const (
+	testRepo    = "saas/api"
+	testRepoUri = "123456789012.dkr.ecr.us-east-1.amazonaws.com/saas/api"
+)
+
+// dg 返回由 c 重复构成的 sha256 digest，便于在用例中区分镜像
+func dg(c string) string {
+	return "sha256:" + strings.Repeat(c, 64)[:64]
+}
+
+// image 构造推送于 age 之前的镜像
+func image(digest string, age time.Duration, tags ...string) *ecr.ImageDetail {
+	return &ecr.ImageDetail{
+		RepositoryName: aws.String(testRepo),
+		ImageDigest:    aws.String(digest),
+		ImageTags:      aws.StringSlice(tags),
+		ImagePushedAt:  aws.Time(testNow.Add(-age)),
+	}
+}
+
+// candidate 构造推送于 age 之前、全部 tag 均过期的候选
+func candidate(digest string, age time.Duration, tags ...string) Candidate {
+	return Candidate{RepositoryName: testRepo, RepositoryUri: testRepoUri, ImageDigest: digest, ImageTags: tags, StaleTags: tags, PushTime: testNow.Add(-age)}
+}
+
+// candidateDigests 返回候选的 digest，按字典序排序
+func candidateDigests(candidates []Candidate) []string {
+	digests := []string{}
+	for _, c := range candidates {
+		digests = append(digests, c.ImageDigest)
+	}
+	sort.Strings(digests)
+	return digests
+}
+
+// retainedDigests 返回保留记录的 digest，按字典序排序
+func retainedDigests(retained []Retained) []string {
+	digests := []string{}
+	for _, r := range retained {
+		digests = append(digests, r.ImageDigest)
+	}
+	sort.Strings(digests)
+	return digests
+}
+
+// sorted 返回排序后的 digest 列表副本
+func sorted(digests ...string) []string {
+	out := append([]string{}, digests...)
+	sort.Strings(out)
+	return out
+}
+
+const day = 24 * time.Hour
+
+func TestFilterImagesForDeletion(t *testing.T) {
+	tagGroups, err := util.ParseTagGroupRules(`^(?P<group>.+)-(?P<order>\d+)$=1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inUseKey := func(tag string) string { return util.TrimRegistry(testRepoUri) + ":" + tag }
+
+	tests := []struct {
+		name         string
+		images       []*ecr.ImageDetail
+		rules        FilterRules
+		inUse        map[string]bool
+		wantCands    []string
+		wantRetained []string
+		wantStale    map[string][]string // digest → 期望的 StaleTags
+	}{
+		{
+			name: "untagged images are candidates and held tags are skipped",
+			images: []*ecr.ImageDetail{
+				image(dg("a"), 3*day),
+				image(dg("b"), 2*day, "release-1"),
+				image(dg("c"), 1*day, "feature-x"),
+			},
+			rules:     FilterRules{HoldTagRegex: "release"},
+			wantCands: sorted(dg("a"), dg("c")),
+		},
+		{
+			name: "hold regex matches the combined tag string, stale tags per tag",
+			images: []*ecr.ImageDetail{
+				image(dg("a"), 1*day, "release-1", "feature-x"),
+			},
+			// ^release 不匹配合并后的 "[release-1 feature-x]"，镜像仍是候选；逐 tag 判断时 release-1 命中，不是过期 tag
+			rules:     FilterRules{HoldTagRegex: "^release"},
+			wantCands: []string{dg("a")},
+			wantStale: map[string][]string{dg("a"): {"feature-x"}},
+		},
+		{
+			name: "protect latest keeps the newest in-use images only",
+			images: []*ecr.ImageDetail{
+				image(dg("a"), 1*day, "v3"),
+				image(dg("b"), 2*day, "v2"),
+				image(dg("c"), 3*day, "v1"),
+			},
+			rules:     FilterRules{HoldTagRegex: "release", ProtectLatest: 1, ProtectInUse: true},
+			inUse:     map[string]bool{inUseKey("v3"): true, inUseKey("v2"): true},
+			wantCands: sorted(dg("b"), dg("c")),
+		},
+		{
+			name: "keep latest tagged ignores held images",
+			images: []*ecr.ImageDetail{
+				image(dg("a"), 1*day, "release-9"),
+				image(dg("b"), 2*day, "v3"),
+				image(dg("c"), 3*day, "v2"),
+				image(dg("d"), 4*day, "v1"),
+				image(dg("e"), 5*day),
+			},
+			rules:        FilterRules{HoldTagRegex: "release", KeepLatestTagged: 2},
+			wantCands:    sorted(dg("d"), dg("e")),
+			wantRetained: sorted(dg("b"), dg("c")),
+		},
+		{
+			name: "tag groups keep the highest order per group",
+			images: []*ecr.ImageDetail{
+				image(dg("a"), 1*day, "main-1"),
+				image(dg("b"), 2*day, "main-2"),
+				image(dg("c"), 3*day, "dev-5"),
+				image(dg("d"), 4*day, "latest"),
+			},
+			rules:        FilterRules{HoldTagRegex: "release", TagGroups: tagGroups},
+			wantCands:    sorted(dg("a"), dg("d")),
+			wantRetained: sorted(dg("b"), dg("c")),
+		},
+		{
+			name: "semver keeps the latest line, patch and newer pre-release",
+			images: []*ecr.ImageDetail{
+				image(dg("a"), 5*day, "v1.1.5"),
+				image(dg("b"), 4*day, "v1.2.0"),
+				image(dg("c"), 3*day, "v1.2.1"),
+				image(dg("d"), 2*day, "v1.2.0-rc.1"),
+				image(dg("e"), 1*day, "v1.3.0-rc.1"),
+				image(dg("f"), 1*day, "nightly"),
+			},
+			rules:        FilterRules{HoldTagRegex: "release", Semver: SemverRules{KeepMinors: 1, KeepPatches: 1, KeepPrereleases: 1}},
+			wantCands:    sorted(dg("a"), dg("b"), dg("d"), dg("f")),
+			wantRetained: sorted(dg("c"), dg("e")),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cands, retained := FilterImagesForDeletion(tt.images, tt.rules, tt.inUse, testRepoUri, false)
+			if got := candidateDigests(cands); !reflect.DeepEqual(got, tt.wantCands) {
+				t.Errorf("candidates = %v, want %v", got, tt.wantCands)
+			}
+			want := tt.wantRetained
+			if want == nil {
+				want = []string{}
+			}
+			if got := retainedDigests(retained); !reflect.DeepEqual(got, want) {
+				t.Errorf("retained = %v, want %v", got, want)
+			}
+			for _, c := range cands {
+				if stale, ok := tt.wantStale[c.ImageDigest]; ok && !reflect.DeepEqual(c.StaleTags, stale) {
+					t.Errorf("stale tags of %s = %v, want %v", c.ImageDigest, c.StaleTags, stale)
+				}
+			}
+		})
+	}
+}
+
+// countingRegistry 记录每次 BatchDeleteImage 请求携带的 ImageId 数量
+type countingRegistry struct {
+	Registry
+	batches []int
+}
+
+func (c *countingRegistry) BatchDeleteImage(input *ecr.BatchDeleteImageInput) (*ecr.BatchDeleteImageOutput, error) {
+	c.batches = append(c.batches, len(input.ImageIds))
+	return c.Registry.BatchDeleteImage(input)
+}
+
+// newTestRegistry 构造只包含 testRepo 的内存仓库
+func newTestRegistry(images []*ecr.ImageDetail, manifests map[string]json.RawMessage) *MemoryRegistry {
+	return NewMemoryRegistry(Fixture{
+		AccountID:    "123456789012",
+		Repositories: []FixtureRepository{{RepositoryName: testRepo, Images: images, Manifests: manifests}},
+	}, "us-east-1")
+}
+
+// indexManifest 返回引用 children 的 OCI index
+func indexManifest(children ...string) json.RawMessage {
+	var descs []string
+	for _, c := range children {
+		descs = append(descs, fmt.Sprintf(`{"mediaType":%q,"digest":%q,"size":100,"platform":{"architecture":"amd64","os":"linux"}}`, MediaTypeOCIManifest, c))
+	}
+	return json.RawMessage(fmt.Sprintf(`{"schemaVersion":2,"mediaType":%q,"manifests":[%s]}`, MediaTypeOCIIndex, strings.Join(descs, ",")))
+}
+
+func TestDeleteImagesChunksBatches(t *testing.T) {
+	var images []*ecr.ImageDetail
+	var cands []Candidate
+	for i := 0; i < 250; i++ {
+		digest := fmt.Sprintf("sha256:%064x", i)
+		images = append(images, image(digest, day))
+		cands = append(cands, candidate(digest, day))
+	}
+	mem := newTestRegistry(images, nil)
+	svc := &countingRegistry{Registry: mem}
+
+	results := DeleteImages(svc, cands, DeleteModeDigest, false, false)
+	if want := []int{100, 100, 50}; !reflect.DeepEqual(svc.batches, want) {
+		t.Errorf("batch sizes = %v, want %v", svc.batches, want)
+	}
+	for i, r := range results {
+		if r.Err != nil || !r.DigestDeleted || r.Candidate.ImageDigest != cands[i].ImageDigest {
+			t.Fatalf("result %d = %+v, want deleted %s", i, r, cands[i].ImageDigest)
+		}
+	}
+	remaining, err := GetImages(mem, testRepo, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 0 {
+		t.Errorf("%d images remain after deletion", len(remaining))
+	}
+}
+
+func TestDeleteImages(t *testing.T) {
+	tagged := func(digest string, tags, stale []string) Candidate {
+		c := candidate(digest, day, tags...)
+		c.StaleTags = stale
+		return c
+	}
+	tests := []struct {
+		name       string
+		images     []*ecr.ImageDetail
+		manifests  map[string]json.RawMessage
+		candidates []Candidate
+		mode       string
+		dryRun     bool
+		wantErr    map[string]string // digest → 错误包含的内容，未列出的候选应成功
+		wantTags   map[string][]string
+		wantDigest map[string]bool // digest → 是否按 digest 删除
+		wantLeft   []string        // 删除后仓库中剩余的 digest
+		wantCalls  int
+	}{
+		{
+			name:       "failures are mapped back to their candidates",
+			images:     []*ecr.ImageDetail{image(dg("a"), day, "v1")},
+			candidates: []Candidate{candidate(dg("a"), day, "v1"), candidate(dg("b"), day)},
+			mode:       DeleteModeDigest,
+			wantErr:    map[string]string{dg("b"): ecr.ImageFailureCodeImageNotFound},
+			wantTags:   map[string][]string{dg("a"): {"v1"}},
+			wantDigest: map[string]bool{dg("a"): true},
+			wantLeft:   []string{},
+			wantCalls:  1,
+		},
+		{
+			name: "child referenced by a retained index fails",
+			images: []*ecr.ImageDetail{
+				image(dg("i"), day, "multi"),
+				image(dg("c"), day),
+			},
+			manifests:  map[string]json.RawMessage{dg("i"): indexManifest(dg("c"))},
+			candidates: []Candidate{candidate(dg("c"), day)},
+			mode:       DeleteModeDigest,
+			wantErr:    map[string]string{dg("c"): ecr.ImageFailureCodeImageReferencedByManifestList},
+			wantLeft:   sorted(dg("c"), dg("i")),
+			wantCalls:  1,
+		},
+		{
+			name: "index is deleted before its children",
+			images: []*ecr.ImageDetail{
+				image(dg("c"), day),
+				image(dg("i"), day, "multi"),
+			},
+			manifests: map[string]json.RawMessage{dg("i"): indexManifest(dg("c"))},
+			candidates: []Candidate{
+				candidate(dg("c"), day),
+				func() Candidate { c := candidate(dg("i"), day, "multi"); c.IsIndex = true; return c }(),
+			},
+			mode:       DeleteModeDigest,
+			wantDigest: map[string]bool{dg("c"): true, dg("i"): true},
+			wantLeft:   []string{},
+			wantCalls:  1,
+		},
+		{
+			name:   "untag mode removes only stale tags and skips candidates without any",
+			images: []*ecr.ImageDetail{image(dg("a"), day, "v1", "release-1"), image(dg("b"), day, "release-2")},
+			candidates: []Candidate{
+				tagged(dg("a"), []string{"v1", "release-1"}, []string{"v1"}),
+				tagged(dg("b"), []string{"release-2"}, nil),
+			},
+			mode:       DeleteModeUntag,
+			wantErr:    map[string]string{dg("b"): ErrNothingToUntag.Error()},
+			wantTags:   map[string][]string{dg("a"): {"v1"}},
+			wantDigest: map[string]bool{dg("a"): false},
+			wantLeft:   sorted(dg("a"), dg("b")),
+			wantCalls:  1,
+		},
+		{
+			name:       "dry run records removals without calling the registry",
+			images:     []*ecr.ImageDetail{image(dg("a"), day, "v1")},
+			candidates: []Candidate{candidate(dg("a"), day, "v1")},
+			mode:       DeleteModeDigest,
+			dryRun:     true,
+			wantDigest: map[string]bool{dg("a"): true},
+			wantLeft:   []string{dg("a")},
+			wantCalls:  0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := newTestRegistry(tt.images, tt.manifests)
+			svc := &countingRegistry{Registry: mem}
+			results := DeleteImages(svc, tt.candidates, tt.mode, tt.dryRun, false)
+			if len(results) != len(tt.candidates) {
+				t.Fatalf("got %d results for %d candidates", len(results), len(tt.candidates))
+			}
+			if len(svc.batches) != tt.wantCalls {
+				t.Errorf("BatchDeleteImage calls = %d, want %d", len(svc.batches), tt.wantCalls)
+			}
+			for i, r := range results {
+				digest := tt.candidates[i].ImageDigest
+				if r.Candidate.ImageDigest != digest {
+					t.Errorf("result %d is for %s, want %s", i, r.Candidate.ImageDigest, digest)
+				}
+				if want, ok := tt.wantErr[digest]; ok {
+					if r.Err == nil || !strings.Contains(r.Err.Error(), want) {
+						t.Errorf("error for %s = %v, want %q", digest, r.Err, want)
+					}
+					continue
+				}
+				if r.Err != nil {
+					t.Errorf("unexpected error for %s: %v", digest, r.Err)
+				}
+				if want, ok := tt.wantTags[digest]; ok && !reflect.DeepEqual(r.RemovedTags, want) {
+					t.Errorf("removed tags of %s = %v, want %v", digest, r.RemovedTags, want)
+				}
+				if want, ok := tt.wantDigest[digest]; ok && r.DigestDeleted != want {
+					t.Errorf("digest deleted for %s = %v, want %v", digest, r.DigestDeleted, want)
+				}
+			}
+			remaining, err := GetImages(mem, testRepo, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			left := []string{}
+			for _, img := range remaining {
+				left = append(left, aws.StringValue(img.ImageDigest))
+			}
+			sort.Strings(left)
+			if !reflect.DeepEqual(left, tt.wantLeft) {
+				t.Errorf("remaining images = %v, want %v", left, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestDeleteImagesNothingToUntagIsSentinel(t *testing.T) {
+	c := candidate(dg("a"), day, "release-1")
+	c.StaleTags = nil
+	results := DeleteImages(newTestRegistry([]*ecr.ImageDetail{image(dg("a"), day, "release-1")}, nil), []Candidate{c}, DeleteModeUntag, false, false)
+	if !errors.Is(results[0].Err, ErrNothingToUntag) || results[0].DigestDeleted || len(results[0].RemovedTags) > 0 {
+		t.Errorf("result = %+v, want ErrNothingToUntag without removals", results[0])
+	}
+}
+
+func TestDeleteEmptyRepository(t *testing.T) {
+	tests := []struct {
+		name    string
+		images  []*ecr.ImageDetail
+		wantErr error
+	}{
+		{name: "empty repository is deleted"},
+		{name: "repository with images is not forced", images: []*ecr.ImageDetail{image(dg("a"), day, "v1")}, wantErr: ErrRepositoryNotEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mem := newTestRegistry(tt.images, nil)
+			err := DeleteEmptyRepository(mem, testRepo)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			repo, err := GetRepository(mem, testRepo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exists := repo != nil; exists != (tt.wantErr != nil) {
+				t.Errorf("repository exists = %v after deletion", exists)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+// aws-ecr-cleaner/internal/ecr/layers.go
+package ecr
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// LayerGraph 保存仓库内镜像 → blob（config 与 layer）的引用关系，用于按去重后的大小估算可回收存储
+// ECR 在同一仓库内按 digest 去重存储 blob，只有不再被任何镜像引用的 blob 才会真正释放
+type LayerGraph struct {
+	blobSize map[string]int64    // blob digest → 大小
+	refs     map[string][]string // 镜像 digest → 引用的 blob digest
+	Missing  int                 // 未能获取 manifest、按 ImageSizeInBytes 整体计入的镜像数量
+}
+
+// LayerStats 是单个仓库的 layer 去重分析结果
+type LayerStats struct {
+	UniqueBytes      int64 // 仓库内去重后的 blob 总大小
+	ReclaimableBytes int64 // 删除候选后不再被引用的 blob 总大小
+	NaiveBytes       int64 // 候选镜像 ImageSizeInBytes 之和（未去重）
+	FreedBlobs       int   // 不再被引用的 blob 数量
+	Missing          int   // 未能获取 manifest 的镜像数量
+}
+
+// BuildLayerGraph 根据镜像列表与已获取的 manifest 构建引用图
+// index 本身不引用 layer，其子 manifest 作为独立镜像计入；缺少 manifest 的镜像视为一个独占 blob
+func BuildLayerGraph(images []*ecr.ImageDetail, manifests map[string]*Manifest) *LayerGraph {
+	g := &LayerGraph{
+		blobSize: make(map[string]int64),
+		refs:     make(map[string][]string),
+	}
+	for _, image := range images {
+		digest := aws.StringValue(image.ImageDigest)
+		m, ok := manifests[digest]
+		if !ok {
+			g.Missing++
+			g.blobSize[digest] = aws.Int64Value(image.ImageSizeInBytes)
+			g.refs[digest] = []string{digest}
+			continue
+		}
+		var blobs []string
+		if m.Config != nil && m.Config.Digest != "" {
+			g.blobSize[m.Config.Digest] = m.Config.Size
+			blobs = append(blobs, m.Config.Digest)
+		}
+		for _, layer := range m.Layers {
+			g.blobSize[layer.Digest] = layer.Size
+			blobs = append(blobs, layer.Digest)
+		}
+		g.refs[digest] = blobs
+	}
+	return g
+}
+
+// Analyze 计算删除 removed 中的镜像后不再被引用的 blob 大小
+func (g *LayerGraph) Analyze(candidates []Candidate, mode string) LayerStats {
+	removed := make(map[string]bool)
+	stats := LayerStats{Missing: g.Missing}
+	for _, c := range candidates {
+		if c.RemovesManifest(mode) {
+			removed[c.ImageDigest] = true
+			stats.NaiveBytes += c.Size
+		}
+	}
+
+	retained := make(map[string]bool)
+	for image, blobs := range g.refs {
+		if removed[image] {
+			continue
+		}
+		for _, b := range blobs {
+			retained[b] = true
+		}
+	}
+	freed := make(map[string]bool)
+	for image, blobs := range g.refs {
+		if !removed[image] {
+			continue
+		}
+		for _, b := range blobs {
+			if !retained[b] && !freed[b] {
+				freed[b] = true
+				stats.ReclaimableBytes += g.blobSize[b]
+			}
+		}
+	}
+	stats.FreedBlobs = len(freed)
+	for _, size := range g.blobSize {
+		stats.UniqueBytes += size
+	}
+	return stats
+}
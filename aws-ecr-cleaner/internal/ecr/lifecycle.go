@@ -0,0 +1,554 @@
+// aws-ecr-cleaner/internal/ecr/lifecycle.go
+package ecr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"aws-ecr-cleaner/internal/util"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// 生命周期策略的取值
+const (
+	TagStatusTagged   = "tagged"
+	TagStatusUntagged = "untagged"
+	TagStatusAny      = "any"
+
+	CountTypeImageCountMoreThan = "imageCountMoreThan"
+	CountTypeSinceImagePushed   = "sinceImagePushed"
+)
+
+// holdRuleCount 是保留规则使用的 imageCountMoreThan 数量。生命周期策略没有“保留”动作，只能用 expire 规则占住镜像：
+// imageCountMoreThan 只过期超出最新 N 个之外的镜像，N 远大于单个仓库的镜像数量上限（默认配额 20000）时该规则永远不会过期任何镜像；
+// 而 ECR 将每个镜像归属于第一条 tag 条件匹配的规则，被该规则占住的镜像不再参与低优先级规则的评估，因此实际上永不过期
+const holdRuleCount = 999999
+
+// LifecyclePolicy 是 ECR 生命周期策略文档
+type LifecyclePolicy struct {
+	Rules []LifecycleRule `json:"rules"`
+}
+
+// LifecycleRule 是生命周期策略中的单条规则
+type LifecycleRule struct {
+	RulePriority int                `json:"rulePriority"`
+	Description  string             `json:"description,omitempty"`
+	Selection    LifecycleSelection `json:"selection"`
+	Action       LifecycleAction    `json:"action"`
+}
+
+// LifecycleSelection 描述规则选择镜像的条件
+type LifecycleSelection struct {
+	TagStatus      string   `json:"tagStatus"`
+	TagPrefixList  []string `json:"tagPrefixList,omitempty"`
+	TagPatternList []string `json:"tagPatternList,omitempty"`
+	CountType      string   `json:"countType"`
+	CountUnit      string   `json:"countUnit,omitempty"`
+	CountNumber    int      `json:"countNumber"`
+}
+
+// LifecycleAction 是规则的动作，目前 ECR 只支持 expire
+type LifecycleAction struct {
+	Type string `json:"type"`
+}
+
+// LifecycleRules 是编译生命周期策略所需的清理规则
+type LifecycleRules struct {
+	HoldTagRegex      string
+	ProtectLatest     int
+	ProtectInUse      bool
+	DeleteMode        string
+	ProtectPulledDays int
+	IdlePullDays      int
+
+	DeleteGraceDays int
+
+	MinImageAgeHours int
+	MaxImageAgeDays  int
+
+	KeepLatestTagged   int
+	KeepLatestUntagged int
+
+	TagGroupRules    string
+	SemverKeepMinors int
+
+	RepoHoldTagRegex string // 仓库资源 tag 追加的保留正则，与 HOLD_TAG_REGEX 一样编译为保留规则
+}
+
+// CompileLifecyclePolicy 将清理规则中能由 ECR 生命周期策略原生表达的部分编译为策略，并返回无法表达的规则说明
+// 生命周期策略按优先级匹配，被高优先级规则匹配的镜像不会再被低优先级规则过期，因此：
+//  1. HOLD_TAG_REGEX 与仓库 tag 追加的保留正则的每个分支编译为一条保留规则（tagPatternList 要求镜像同时匹配列表中全部模式，所以每个分支单独一条）；
+//  2. 未打标签的镜像推送 1 天后过期（生命周期策略的最小粒度为 1 天，而清理程序会立即删除）；
+//  3. 其余带 tag 的镜像推送 1 天后过期，仅在 HOLD_TAG_REGEX 可完全表达且不依赖 in-use / 拉取时间 / untag 模式时生成；
+//  4. 设置 DELETE_GRACE_DAYS 时以推送后的天数近似宽限期（策略无法得知镜像何时成为候选）；
+//  5. MIN_IMAGE_AGE_HOURS 超过过期天数时向上取整为天数；MAX_IMAGE_AGE_DAYS 需要越过保留规则，无法表达；
+//  6. KEEP_LATEST_* 的计数规则会匹配全部同类镜像、使按推送天数过期的规则失效，设置时不生成对应的过期规则；
+//     TAG_GROUP_RULES 需要按捕获组分组计数、SEMVER_KEEP_* 需要比较版本号，同样无法表达。
+func CompileLifecyclePolicy(rules LifecycleRules) (*LifecyclePolicy, []string) {
+	policy := &LifecyclePolicy{}
+	var unexpressible []string
+	priority := 1
+
+	type holdPattern struct{ pattern, source string }
+	var holds []holdPattern
+	holdExpressible := true
+	for _, src := range []struct{ name, regex string }{{"HOLD_TAG_REGEX", rules.HoldTagRegex}, {"repository hold-tag-regex", rules.RepoHoldTagRegex}} {
+		if src.regex == "" {
+			continue
+		}
+		patterns, err := HoldTagPatterns(src.regex)
+		if err != nil {
+			holdExpressible = false
+			unexpressible = append(unexpressible, fmt.Sprintf("%s %q: %v; tagged images are not expired by the compiled policy", src.name, src.regex, err))
+		}
+		for _, p := range patterns {
+			holds = append(holds, holdPattern{pattern: p, source: src.name})
+		}
+	}
+	for _, h := range holds {
+		policy.Rules = append(policy.Rules, LifecycleRule{
+			RulePriority: priority,
+			Description:  fmt.Sprintf("hold tags matching %s (%s)", h.pattern, h.source),
+			Selection: LifecycleSelection{
+				TagStatus:      TagStatusTagged,
+				TagPatternList: []string{h.pattern},
+				CountType:      CountTypeImageCountMoreThan,
+				CountNumber:    holdRuleCount,
+			},
+			Action: LifecycleAction{Type: "expire"},
+		})
+		priority++
+	}
+
+	expireDays := 1
+	untaggedDesc := "expire untagged images (cleaner deletes them immediately; lifecycle minimum is 1 day)"
+	if rules.DeleteGraceDays > 0 {
+		expireDays = rules.DeleteGraceDays
+		untaggedDesc = fmt.Sprintf("expire untagged images %d days after push (DELETE_GRACE_DAYS)", expireDays)
+		unexpressible = append(unexpressible, fmt.Sprintf("DELETE_GRACE_DAYS=%d: lifecycle policies cannot track when an image became a candidate; approximated as %d days since push", rules.DeleteGraceDays, expireDays))
+	}
+	if minDays := (rules.MinImageAgeHours + 23) / 24; minDays > expireDays {
+		expireDays = minDays
+		untaggedDesc = fmt.Sprintf("expire untagged images %d days after push (MIN_IMAGE_AGE_HOURS=%d, rounded up to days)", expireDays, rules.MinImageAgeHours)
+	}
+	if rules.MaxImageAgeDays > 0 {
+		unexpressible = append(unexpressible, fmt.Sprintf("MAX_IMAGE_AGE_DAYS=%d: a lifecycle rule matching held images would stop lower-priority rules from expiring anything else; held images are not expired by the compiled policy", rules.MaxImageAgeDays))
+	}
+
+	pullRules := rules.ProtectPulledDays > 0 || rules.IdlePullDays > 0
+	switch {
+	case pullRules:
+		unexpressible = append(unexpressible, "PROTECT_PULLED_WITHIN_DAYS / DELETE_IF_NOT_PULLED_DAYS: lifecycle policies cannot select by pull time; no expiry rules are generated")
+	case rules.KeepLatestUntagged > 0:
+		unexpressible = append(unexpressible, fmt.Sprintf("KEEP_LATEST_UNTAGGED=%d: a count rule cannot be combined with expiry by age; no expiry rules are generated", rules.KeepLatestUntagged))
+	default:
+		policy.Rules = append(policy.Rules, LifecycleRule{
+			RulePriority: priority,
+			Description:  untaggedDesc,
+			Selection: LifecycleSelection{
+				TagStatus:   TagStatusUntagged,
+				CountType:   CountTypeSinceImagePushed,
+				CountUnit:   "days",
+				CountNumber: expireDays,
+			},
+			Action: LifecycleAction{Type: "expire"},
+		})
+		priority++
+	}
+
+	switch {
+	case !holdExpressible || pullRules || rules.KeepLatestUntagged > 0:
+	case rules.ProtectInUse:
+		unexpressible = append(unexpressible, fmt.Sprintf("PROTECT_INUSE_BY_K8S with PROTECT_LATEST=%d: lifecycle policies cannot see in-use images; tagged images are not expired by the compiled policy", rules.ProtectLatest))
+	case rules.TagGroupRules != "":
+		unexpressible = append(unexpressible, fmt.Sprintf("TAG_GROUP_RULES %q: lifecycle policies cannot group images by capture group; tagged images are not expired by the compiled policy", rules.TagGroupRules))
+	case rules.SemverKeepMinors > 0:
+		unexpressible = append(unexpressible, fmt.Sprintf("SEMVER_KEEP_MINORS=%d: lifecycle policies cannot compare semantic versions; tagged images are not expired by the compiled policy", rules.SemverKeepMinors))
+	case rules.KeepLatestTagged > 0:
+		unexpressible = append(unexpressible, fmt.Sprintf("KEEP_LATEST_TAGGED=%d: a count rule cannot be combined with expiry by age; tagged images are not expired by the compiled policy", rules.KeepLatestTagged))
+	case rules.DeleteMode == DeleteModeUntag:
+		unexpressible = append(unexpressible, "DELETE_MODE=untag: lifecycle policies expire whole images and cannot remove individual tags; tagged images are not expired by the compiled policy")
+	default:
+		policy.Rules = append(policy.Rules, LifecycleRule{
+			RulePriority: priority,
+			Description:  "expire all other images not matched by a hold rule",
+			Selection: LifecycleSelection{
+				TagStatus:   TagStatusAny,
+				CountType:   CountTypeSinceImagePushed,
+				CountUnit:   "days",
+				CountNumber: expireDays,
+			},
+			Action: LifecycleAction{Type: "expire"},
+		})
+	}
+
+	unexpressible = append(unexpressible, "multi-arch index children and OCI referrers are not evaluated by the compiled policy")
+	return policy, unexpressible
+}
+
+// literalPattern 匹配可以转换为 tagPatternList 的正则片段：字面字符与转义的 . - _
+var literalPattern = regexp.MustCompile(`^(?:[A-Za-z0-9_\-]|\\[.\-_])*$`)
+
+// HoldTagPatterns 将 HOLD_TAG_REGEX 转换为 ECR tagPatternList 模式，每个 | 或 OR 分支一个模式
+// 清理程序用正则匹配合并后的 tag 字符串（如 "[v1 release-2]"），只有“某个 tag 包含一段字面字符”的分支在逐 tag 匹配的
+// tagPatternList 中含义相同，编译为 *<字面字符>*；两端可以是 .*（首尾锚点紧跟 .* 时等价于未锚定）。
+// 其余分支含义不同，返回错误：^ 与 $ 锚定的是方括号而不是单个 tag，清理程序永远不会匹配；字面字符之间的 .* 可以跨越多个 tag
+func HoldTagPatterns(holdTagRegex string) ([]string, error) {
+	if strings.Contains(holdTagRegex, "&&") {
+		return nil, fmt.Errorf("&& combinations cannot be expressed")
+	}
+	var patterns []string
+	for _, part := range strings.Split(holdTagRegex, "OR") {
+		for _, alt := range strings.Split(strings.TrimSpace(part), "|") {
+			alt = strings.TrimSpace(alt)
+			anchoredStart := strings.HasPrefix(alt, "^")
+			anchoredEnd := strings.HasSuffix(alt, "$") && !strings.HasSuffix(alt, `\$`)
+			body := strings.TrimSuffix(strings.TrimPrefix(alt, "^"), "$")
+			literal := body
+			for strings.HasPrefix(literal, ".*") {
+				literal = literal[2:]
+			}
+			for strings.HasSuffix(literal, ".*") && !strings.HasSuffix(literal, `\.*`) {
+				literal = literal[:len(literal)-2]
+			}
+			switch {
+			case body == "":
+				return nil, fmt.Errorf("branch %q is empty", alt)
+			case strings.Contains(literal, ".*"):
+				return nil, fmt.Errorf("branch %q: .* between literals can match across tags in the combined tag string", alt)
+			case !literalPattern.MatchString(literal):
+				return nil, fmt.Errorf("branch %q is not a literal/wildcard pattern", alt)
+			case anchoredStart && !strings.HasPrefix(body, ".*"):
+				return nil, fmt.Errorf("branch %q: ^ anchors the combined tag string \"[tag ...]\", not a single tag, so the cleaner never matches it", alt)
+			case anchoredEnd && !strings.HasSuffix(body, ".*"):
+				return nil, fmt.Errorf("branch %q: $ anchors the combined tag string \"[tag ...]\", not a single tag, so the cleaner never matches it", alt)
+			}
+			p := strings.NewReplacer(`\.`, ".", `\-`, "-", `\_`, "_").Replace(literal)
+			patterns = append(patterns, strings.ReplaceAll("*"+p+"*", "**", "*"))
+		}
+	}
+	return patterns, nil
+}
+
+// JSON 返回策略的 JSON 文本
+func (p *LifecyclePolicy) JSON() (string, error) {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// PreviewLifecyclePolicy 对仓库启动生命周期策略预览并轮询至完成，返回预计过期的镜像
+func PreviewLifecyclePolicy(svc Registry, repositoryName, policyText string, pollInterval, timeout time.Duration) ([]*ecr.LifecyclePolicyPreviewResult, error) {
+	_, err := svc.StartLifecyclePolicyPreview(&ecr.StartLifecyclePolicyPreviewInput{
+		RepositoryName:      aws.String(repositoryName),
+		LifecyclePolicyText: aws.String(policyText),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var results []*ecr.LifecyclePolicyPreviewResult
+		var status string
+		input := &ecr.GetLifecyclePolicyPreviewInput{RepositoryName: aws.String(repositoryName)}
+		for {
+			out, err := svc.GetLifecyclePolicyPreview(input)
+			if err != nil {
+				return nil, err
+			}
+			status = aws.StringValue(out.Status)
+			if status != ecr.LifecyclePolicyPreviewStatusComplete {
+				break
+			}
+			results = append(results, out.PreviewResults...)
+			if out.NextToken == nil {
+				break
+			}
+			input.NextToken = out.NextToken
+		}
+
+		switch status {
+		case ecr.LifecyclePolicyPreviewStatusComplete:
+			return results, nil
+		case ecr.LifecyclePolicyPreviewStatusInProgress:
+			if time.Now().After(deadline) {
+				return nil, fmt.Errorf("lifecycle policy preview for %s did not complete within %s", repositoryName, timeout)
+			}
+			time.Sleep(pollInterval)
+		default:
+			return nil, fmt.Errorf("lifecycle policy preview for %s ended with status %s", repositoryName, status)
+		}
+	}
+}
+
+// PutLifecyclePolicy 为仓库设置生命周期策略
+func PutLifecyclePolicy(svc Registry, repositoryName, policyText string) error {
+	_, err := svc.PutLifecyclePolicy(&ecr.PutLifecyclePolicyInput{
+		RepositoryName:      aws.String(repositoryName),
+		LifecyclePolicyText: aws.String(policyText),
+	})
+	return err
+}
+
+// GetLifecyclePolicy 获取并解析仓库当前的生命周期策略，仓库未设置策略时返回 nil
+func GetLifecyclePolicy(svc Registry, repositoryName string) (*LifecyclePolicy, error) {
+	text, err := GetLifecyclePolicyText(svc, repositoryName)
+	if err != nil || text == "" {
+		return nil, err
+	}
+	return ParseLifecyclePolicy(text)
+}
+
+// GetLifecyclePolicyText 获取仓库当前生命周期策略的原始文本（可能是手写的），仓库未设置策略时返回空字符串
+func GetLifecyclePolicyText(svc Registry, repositoryName string) (string, error) {
+	out, err := svc.GetLifecyclePolicy(&ecr.GetLifecyclePolicyInput{RepositoryName: aws.String(repositoryName)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == ecr.ErrCodeLifecyclePolicyNotFoundException {
+			return "", nil
+		}
+		return "", err
+	}
+	return aws.StringValue(out.LifecyclePolicyText), nil
+}
+
+// FormatPolicyText 按 JSON 方法相同的缩进格式化策略文本，保留字段顺序与未知字段，便于与编译出的策略逐行对比；不是合法 JSON 时原样返回
+func FormatPolicyText(text string) string {
+	var compact, buf bytes.Buffer
+	if err := json.Compact(&compact, []byte(text)); err != nil {
+		return text
+	}
+	if err := json.Indent(&buf, compact.Bytes(), "", "  "); err != nil {
+		return text
+	}
+	return buf.String()
+}
+
+// ParseLifecyclePolicy 解析生命周期策略文本，按 rulePriority 排序规则，并按 ECR 的约束校验
+// 离线评估只支持 imageCountMoreThan 与 sinceImagePushed 两种 countType 以及 expire 动作
+func ParseLifecyclePolicy(text string) (*LifecyclePolicy, error) {
+	var p LifecyclePolicy
+	if err := json.Unmarshal([]byte(text), &p); err != nil {
+		return nil, fmt.Errorf("invalid lifecycle policy: %w", err)
+	}
+	if len(p.Rules) == 0 {
+		return nil, fmt.Errorf("invalid lifecycle policy: no rules")
+	}
+	sort.SliceStable(p.Rules, func(i, j int) bool {
+		return p.Rules[i].RulePriority < p.Rules[j].RulePriority
+	})
+
+	seen := make(map[int]bool)
+	for i, rule := range p.Rules {
+		if seen[rule.RulePriority] {
+			return nil, fmt.Errorf("invalid lifecycle policy: duplicate rulePriority %d", rule.RulePriority)
+		}
+		seen[rule.RulePriority] = true
+
+		sel := rule.Selection
+		hasPrefix, hasPattern := len(sel.TagPrefixList) > 0, len(sel.TagPatternList) > 0
+		switch sel.TagStatus {
+		case TagStatusTagged:
+			if hasPrefix == hasPattern {
+				return nil, fmt.Errorf("rule %d: tagged rules require exactly one of tagPrefixList or tagPatternList", rule.RulePriority)
+			}
+		case TagStatusUntagged, TagStatusAny:
+			if hasPrefix || hasPattern {
+				return nil, fmt.Errorf("rule %d: tagPrefixList and tagPatternList are only allowed with tagStatus tagged", rule.RulePriority)
+			}
+			if sel.TagStatus == TagStatusAny && i != len(p.Rules)-1 {
+				return nil, fmt.Errorf("rule %d: a rule with tagStatus any must have the highest rulePriority", rule.RulePriority)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: unknown tagStatus %q", rule.RulePriority, sel.TagStatus)
+		}
+
+		switch sel.CountType {
+		case CountTypeImageCountMoreThan:
+			if sel.CountUnit != "" {
+				return nil, fmt.Errorf("rule %d: countUnit is not allowed with imageCountMoreThan", rule.RulePriority)
+			}
+		case CountTypeSinceImagePushed:
+			if sel.CountUnit != "days" {
+				return nil, fmt.Errorf("rule %d: sinceImagePushed requires countUnit days", rule.RulePriority)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: countType %q is not supported by the offline evaluator", rule.RulePriority, sel.CountType)
+		}
+		if sel.CountNumber < 1 {
+			return nil, fmt.Errorf("rule %d: countNumber must be at least 1", rule.RulePriority)
+		}
+		if rule.Action.Type != "expire" {
+			return nil, fmt.Errorf("rule %d: action %q is not supported by the offline evaluator", rule.RulePriority, rule.Action.Type)
+		}
+	}
+	return &p, nil
+}
+
+// LifecycleExpiry 是生命周期策略将过期的镜像及命中的规则
+type LifecycleExpiry struct {
+	ImageDigest  string
+	ImageTags    []string
+	PushTime     time.Time
+	RulePriority int
+	Description  string
+}
+
+// Evaluate 按 ECR 的语义在本地评估策略：
+// 规则按 rulePriority 从小到大评估；镜像一旦满足某条规则的 tag 条件即归属该规则，不再参与更低优先级规则的评估，
+// 因此每个镜像最多被一条规则过期。imageCountMoreThan 按推送时间保留最新的 countNumber 个镜像，
+// sinceImagePushed 过期推送时间早于 countNumber 天前的镜像。
+func (p *LifecyclePolicy) Evaluate(images []*ecr.ImageDetail, now time.Time) []LifecycleExpiry {
+	rules := append([]LifecycleRule(nil), p.Rules...)
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].RulePriority < rules[j].RulePriority
+	})
+
+	claimed := make(map[string]bool)
+	var expiries []LifecycleExpiry
+	for _, rule := range rules {
+		var matched []*ecr.ImageDetail
+		for _, image := range images {
+			digest := aws.StringValue(image.ImageDigest)
+			if claimed[digest] || !rule.Selection.matches(aws.StringValueSlice(image.ImageTags)) {
+				continue
+			}
+			claimed[digest] = true
+			matched = append(matched, image)
+		}
+
+		var expired []*ecr.ImageDetail
+		switch rule.Selection.CountType {
+		case CountTypeImageCountMoreThan:
+			sort.SliceStable(matched, func(i, j int) bool {
+				return aws.TimeValue(matched[i].ImagePushedAt).After(aws.TimeValue(matched[j].ImagePushedAt))
+			})
+			if len(matched) > rule.Selection.CountNumber {
+				expired = matched[rule.Selection.CountNumber:]
+			}
+		case CountTypeSinceImagePushed:
+			cutoff := now.Add(-time.Duration(rule.Selection.CountNumber) * 24 * time.Hour)
+			for _, image := range matched {
+				if aws.TimeValue(image.ImagePushedAt).Before(cutoff) {
+					expired = append(expired, image)
+				}
+			}
+		}
+		for _, image := range expired {
+			expiries = append(expiries, LifecycleExpiry{
+				ImageDigest:  aws.StringValue(image.ImageDigest),
+				ImageTags:    aws.StringValueSlice(image.ImageTags),
+				PushTime:     aws.TimeValue(image.ImagePushedAt),
+				RulePriority: rule.RulePriority,
+				Description:  rule.Description,
+			})
+		}
+	}
+	return expiries
+}
+
+// matches 判断镜像的 tag 是否满足规则的 tag 条件
+// tagged 规则要求 tagPrefixList / tagPatternList 中的每一项都至少被一个 tag 匹配
+func (s LifecycleSelection) matches(tags []string) bool {
+	switch s.TagStatus {
+	case TagStatusUntagged:
+		return len(tags) == 0
+	case TagStatusAny:
+		return true
+	case TagStatusTagged:
+		if len(tags) == 0 {
+			return false
+		}
+		for _, prefix := range s.TagPrefixList {
+			if !anyTag(tags, func(tag string) bool { return strings.HasPrefix(tag, prefix) }) {
+				return false
+			}
+		}
+		for _, pattern := range s.TagPatternList {
+			re := tagPatternRegexp(pattern)
+			if !anyTag(tags, re.MatchString) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func anyTag(tags []string, match func(string) bool) bool {
+	for _, tag := range tags {
+		if match(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// tagPatternRegexp 将 tagPatternList 中的通配符模式（* 匹配任意字符）转换为完整匹配的正则
+func tagPatternRegexp(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// LifecycleFinding 是生命周期策略过期结果与清理规则的对比
+type LifecycleFinding struct {
+	LifecycleExpiry
+	Agrees   bool   // 清理程序同样会按 digest 删除该镜像
+	Conflict string // 清理程序保留该镜像（或只移除部分 tag）的原因，Agrees 为 true 时为空
+	InUse    bool   // 镜像的某个 tag 正在 Kubernetes 中使用
+}
+
+// CompareLifecycle 将生命周期策略的过期结果与清理程序的最终候选、保留记录及 HOLD_TAG_REGEX 对比
+func CompareLifecycle(expiries []LifecycleExpiry, candidates []Candidate, retained []Retained, holdTagRegex string, inUse map[string]bool, repositoryUri, mode string) []LifecycleFinding {
+	byDigest := make(map[string]Candidate, len(candidates))
+	for _, c := range candidates {
+		byDigest[c.ImageDigest] = c
+	}
+	reasons := make(map[string]string, len(retained))
+	for _, r := range retained {
+		reasons[r.ImageDigest] = r.Reason
+	}
+	trimmedRepoUri := util.TrimRegistry(repositoryUri)
+
+	var findings []LifecycleFinding
+	for _, e := range expiries {
+		f := LifecycleFinding{LifecycleExpiry: e}
+		for _, tag := range e.ImageTags {
+			if inUse[fmt.Sprintf("%s:%s", trimmedRepoUri, tag)] {
+				f.InUse = true
+				break
+			}
+		}
+		c, isCandidate := byDigest[e.ImageDigest]
+		reason, isRetained := reasons[e.ImageDigest]
+		switch {
+		case isCandidate && c.RemovesManifest(mode):
+			f.Agrees = true
+		case isCandidate:
+			f.Conflict = fmt.Sprintf("cleaner only removes stale tags %v", c.StaleTags)
+		case isRetained:
+			f.Conflict = reason
+		case len(e.ImageTags) > 0 && util.HoldTagMatch(fmt.Sprintf("%s", e.ImageTags), holdTagRegex):
+			f.Conflict = "held by HOLD_TAG_REGEX"
+		case f.InUse:
+			f.Conflict = "in use and among the newest PROTECT_LATEST in-use images"
+		default:
+			f.Conflict = "kept by cleaner rules"
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
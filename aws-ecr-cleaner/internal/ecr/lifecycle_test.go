@@ -0,0 +1,200 @@
+package ecr
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"aws-ecr-cleaner/internal/util"
+
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func TestHoldTagPatterns(t *testing.T) {
+	tests := []struct {
+		regex   string
+		want    []string
+		wantErr string
+	}{
+		{regex: "release", want: []string{"*release*"}},
+		{regex: "release|hotfix OR stable", want: []string{"*release*", "*hotfix*", "*stable*"}},
+		{regex: `.*2\.90.*$`, want: []string{"*2.90*"}},
+		{regex: "^.*prod", want: []string{"*prod*"}},
+		{regex: "^.*", want: []string{"*"}},
+		{regex: "^release", wantErr: "^ anchors the combined tag string"},
+		{regex: "release$", wantErr: "$ anchors the combined tag string"},
+		{regex: "rel.*ease", wantErr: "can match across tags"},
+		{regex: "v[0-9]+", wantErr: "not a literal/wildcard pattern"},
+		{regex: "release|", wantErr: "is empty"},
+		{regex: "release && prod", wantErr: "&& combinations"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.regex, func(t *testing.T) {
+			got, err := HoldTagPatterns(tt.regex)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("patterns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestHoldTagPatternsAgreeWithCleaner 校验可表达的分支在 tagPatternList 中与清理程序对合并 tag 字符串的匹配结果一致
+func TestHoldTagPatternsAgreeWithCleaner(t *testing.T) {
+	tagSets := [][]string{{"release-1"}, {"v1", "release-2"}, {"v2.90.1"}, {"main"}, {"pre-release", "x"}}
+	for _, regex := range []string{"release", `.*2\.90.*$`, "^.*main.*$"} {
+		patterns, err := HoldTagPatterns(regex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tags := range tagSets {
+			cleaner := util.HoldTagMatch("["+strings.Join(tags, " ")+"]", regex)
+			policy := false
+			for _, p := range patterns {
+				if (LifecycleSelection{TagStatus: TagStatusTagged, TagPatternList: []string{p}}).matches(tags) {
+					policy = true
+				}
+			}
+			if cleaner != policy {
+				t.Errorf("regex %q on tags %v: cleaner holds %v, policy holds %v", regex, tags, cleaner, policy)
+			}
+		}
+	}
+}
+
+func TestParseLifecyclePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr string
+	}{
+		{
+			name: "valid policy is sorted by priority",
+			text: `{"rules":[
+				{"rulePriority":2,"selection":{"tagStatus":"any","countType":"imageCountMoreThan","countNumber":5},"action":{"type":"expire"}},
+				{"rulePriority":1,"selection":{"tagStatus":"untagged","countType":"sinceImagePushed","countUnit":"days","countNumber":1},"action":{"type":"expire"}}]}`,
+		},
+		{name: "invalid json", text: `{"rules":`, wantErr: "invalid lifecycle policy"},
+		{name: "no rules", text: `{"rules":[]}`, wantErr: "no rules"},
+		{
+			name: "duplicate priority",
+			text: `{"rules":[
+				{"rulePriority":1,"selection":{"tagStatus":"untagged","countType":"imageCountMoreThan","countNumber":1},"action":{"type":"expire"}},
+				{"rulePriority":1,"selection":{"tagStatus":"untagged","countType":"imageCountMoreThan","countNumber":1},"action":{"type":"expire"}}]}`,
+			wantErr: "duplicate rulePriority 1",
+		},
+		{
+			name:    "tagged rule without a tag list",
+			text:    `{"rules":[{"rulePriority":1,"selection":{"tagStatus":"tagged","countType":"imageCountMoreThan","countNumber":1},"action":{"type":"expire"}}]}`,
+			wantErr: "exactly one of tagPrefixList or tagPatternList",
+		},
+		{
+			name: "any rule not last",
+			text: `{"rules":[
+				{"rulePriority":1,"selection":{"tagStatus":"any","countType":"imageCountMoreThan","countNumber":1},"action":{"type":"expire"}},
+				{"rulePriority":2,"selection":{"tagStatus":"untagged","countType":"imageCountMoreThan","countNumber":1},"action":{"type":"expire"}}]}`,
+			wantErr: "must have the highest rulePriority",
+		},
+		{
+			name:    "sinceImagePushed without days",
+			text:    `{"rules":[{"rulePriority":1,"selection":{"tagStatus":"untagged","countType":"sinceImagePushed","countNumber":1},"action":{"type":"expire"}}]}`,
+			wantErr: "requires countUnit days",
+		},
+		{
+			name:    "countNumber below one",
+			text:    `{"rules":[{"rulePriority":1,"selection":{"tagStatus":"untagged","countType":"imageCountMoreThan","countNumber":0},"action":{"type":"expire"}}]}`,
+			wantErr: "countNumber must be at least 1",
+		},
+		{
+			name:    "unsupported action",
+			text:    `{"rules":[{"rulePriority":1,"selection":{"tagStatus":"untagged","countType":"imageCountMoreThan","countNumber":1},"action":{"type":"transition"}}]}`,
+			wantErr: "not supported by the offline evaluator",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParseLifecyclePolicy(tt.text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i < len(p.Rules); i++ {
+				if p.Rules[i-1].RulePriority >= p.Rules[i].RulePriority {
+					t.Errorf("rules not sorted by priority: %+v", p.Rules)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	const policy = `{"rules":[
+		{"rulePriority":1,"selection":{"tagStatus":"tagged","tagPrefixList":["release"],"countType":"imageCountMoreThan","countNumber":999999},"action":{"type":"expire"}},
+		{"rulePriority":2,"selection":{"tagStatus":"untagged","countType":"sinceImagePushed","countUnit":"days","countNumber":7},"action":{"type":"expire"}},
+		{"rulePriority":3,"selection":{"tagStatus":"tagged","tagPatternList":["*-rc*"],"countType":"imageCountMoreThan","countNumber":1},"action":{"type":"expire"}},
+		{"rulePriority":4,"selection":{"tagStatus":"any","countType":"imageCountMoreThan","countNumber":2},"action":{"type":"expire"}}]}`
+	p, err := ParseLifecyclePolicy(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := []*ecr.ImageDetail{
+		image(dg("a"), 400*day, "release-1"), // 被保留规则占住，永不过期
+		image(dg("b"), 10*day),               // 未打标签且超过 7 天
+		image(dg("c"), 3*day),                // 未打标签但不足 7 天，归属规则 2 后不再参与规则 4
+		image(dg("d"), 2*day, "v2-rc1"),      // 规则 3 中最新的一个
+		image(dg("e"), 5*day, "v1-rc2"),      // 规则 3 超出数量
+		image(dg("f"), 1*day, "v3"),          // 规则 4 中最新的两个之一
+		image(dg("g"), 2*day, "v2"),          // 规则 4 中最新的两个之一
+		image(dg("h"), 9*day, "v1"),          // 规则 4 超出数量
+	}
+	got := make(map[string]int)
+	for _, e := range p.Evaluate(images, testNow) {
+		got[e.ImageDigest] = e.RulePriority
+	}
+	want := map[string]int{dg("b"): 2, dg("e"): 3, dg("h"): 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expiries = %v, want %v", got, want)
+	}
+}
+
+func TestCompiledPolicyHoldsHeldTags(t *testing.T) {
+	policy, _ := CompileLifecyclePolicy(LifecycleRules{HoldTagRegex: "release", RepoHoldTagRegex: "stable", DeleteMode: DeleteModeDigest})
+	text, err := policy.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseLifecyclePolicy(text)
+	if err != nil {
+		t.Fatalf("compiled policy does not parse: %v\n%s", err, text)
+	}
+	images := []*ecr.ImageDetail{
+		image(dg("a"), 30*day, "release-1"),
+		image(dg("b"), 30*day, "stable"),
+		image(dg("c"), 30*day, "feature-x"),
+		image(dg("d"), 30*day),
+		image(dg("e"), 1*time.Hour, "feature-y"),
+	}
+	var expired []string
+	for _, e := range parsed.Evaluate(images, testNow) {
+		expired = append(expired, e.ImageDigest)
+	}
+	sort.Strings(expired)
+	if want := sorted(dg("c"), dg("d")); !reflect.DeepEqual(expired, want) {
+		t.Errorf("expired = %v, want %v\n%s", expired, want, text)
+	}
+}
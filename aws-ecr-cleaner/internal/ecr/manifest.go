@@ -0,0 +1,247 @@
+// aws-ecr-cleaner/internal/ecr/manifest.go
+package ecr
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// manifest 相关的 media type
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// maxBatchGetIds 是 BatchGetImage 单次请求允许的最大 ImageIds 数量
+const maxBatchGetIds = 100
+
+// acceptedManifestTypes 请求 BatchGetImage 时接受的 manifest 类型，保证 index 以原始形式返回
+var acceptedManifestTypes = []*string{
+	aws.String(MediaTypeDockerManifest),
+	aws.String(MediaTypeDockerManifestList),
+	aws.String(MediaTypeOCIManifest),
+	aws.String(MediaTypeOCIIndex),
+}
+
+// Platform 描述 index 中子 manifest 的平台
+type Platform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String 返回 os/arch[/variant] 形式的平台描述
+func (p *Platform) String() string {
+	if p == nil {
+		return "unknown"
+	}
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// Descriptor 是 manifest 中引用其它内容的描述符
+type Descriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Platform     *Platform         `json:"platform,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// Manifest 是解析后的镜像 manifest 或 index，Raw 保留 ECR 返回的原始内容
+type Manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        *Descriptor       `json:"config,omitempty"`
+	Layers        []Descriptor      `json:"layers,omitempty"`
+	Manifests     []Descriptor      `json:"manifests,omitempty"`
+	Subject       *Descriptor       `json:"subject,omitempty"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+
+	Digest string `json:"-"`
+	Raw    string `json:"-"`
+}
+
+// IsIndexMediaType 判断 media type 是否为多架构 index / manifest list
+func IsIndexMediaType(mediaType string) bool {
+	return mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIIndex
+}
+
+// IsIndex 判断 manifest 是否为多架构 index
+func (m *Manifest) IsIndex() bool {
+	return IsIndexMediaType(m.MediaType) || (m.MediaType == "" && len(m.Manifests) > 0)
+}
+
+// ParseManifest 解析原始 manifest，mediaType 为 ECR 返回的 ImageManifestMediaType（manifest 本身未声明时使用）
+func ParseManifest(digest, raw, mediaType string) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal([]byte(raw), &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", digest, err)
+	}
+	if m.MediaType == "" {
+		m.MediaType = mediaType
+	}
+	m.Digest = digest
+	m.Raw = raw
+	return &m, nil
+}
+
+// GetManifests 通过 BatchGetImage 获取指定 digest 的 manifest，每次最多 100 个
+// 扫描后已被删除（ImageNotFound）的 digest 跳过；其它失败返回错误，避免缺失的 index 导致其子 manifest 被误删
+func GetManifests(svc Registry, repositoryName string, digests []string, debug bool) (map[string]*Manifest, error) {
+	manifests := make(map[string]*Manifest, len(digests))
+	for start := 0; start < len(digests); start += maxBatchGetIds {
+		end := start + maxBatchGetIds
+		if end > len(digests) {
+			end = len(digests)
+		}
+		var ids []*ecr.ImageIdentifier
+		for _, d := range digests[start:end] {
+			ids = append(ids, &ecr.ImageIdentifier{ImageDigest: aws.String(d)})
+		}
+		out, err := svc.BatchGetImage(&ecr.BatchGetImageInput{
+			RepositoryName:     aws.String(repositoryName),
+			ImageIds:           ids,
+			AcceptedMediaTypes: acceptedManifestTypes,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, failure := range out.Failures {
+			var digest string
+			if failure.ImageId != nil {
+				digest = aws.StringValue(failure.ImageId.ImageDigest)
+			}
+			if aws.StringValue(failure.FailureCode) != ecr.ImageFailureCodeImageNotFound {
+				return nil, fmt.Errorf("failed to get manifest %s in repository %s: %s: %s", digest, repositoryName, aws.StringValue(failure.FailureCode), aws.StringValue(failure.FailureReason))
+			}
+			if debug {
+				log.Printf("[DEBUG] Unable to get manifest %s in repository %s: %s", digest, repositoryName, aws.StringValue(failure.FailureReason))
+			}
+		}
+		for _, img := range out.Images {
+			digest := aws.StringValue(img.ImageId.ImageDigest)
+			m, err := ParseManifest(digest, aws.StringValue(img.ImageManifest), aws.StringValue(img.ImageManifestMediaType))
+			if err != nil {
+				return nil, err
+			}
+			manifests[digest] = m
+		}
+	}
+	return manifests, nil
+}
+
+// ManifestGraph 保存仓库内 index → 子 manifest 的引用关系
+type ManifestGraph struct {
+	Children map[string][]Descriptor // index digest → 子 manifest 描述符
+}
+
+// BuildManifestGraph 根据已获取的 manifest 构建 index → 子 manifest 图
+func BuildManifestGraph(manifests map[string]*Manifest) *ManifestGraph {
+	g := &ManifestGraph{Children: make(map[string][]Descriptor)}
+	for digest, m := range manifests {
+		if m.IsIndex() {
+			g.Children[digest] = m.Manifests
+		}
+	}
+	return g
+}
+
+// IndexDigests 返回镜像列表中 media type 为 index 的 digest，用于按需获取 manifest
+func IndexDigests(images []*ecr.ImageDetail) []string {
+	var digests []string
+	for _, image := range images {
+		if IsIndexMediaType(aws.StringValue(image.ImageManifestMediaType)) {
+			digests = append(digests, aws.StringValue(image.ImageDigest))
+		}
+	}
+	return digests
+}
+
+// ProtectIndexChildren 从候选中移除被保留 index（含嵌套 index）引用的子 manifest
+// 删除模式决定某个 index 候选是否真的会被删除：untag 模式下仅移除部分 tag 的 index 仍视为保留
+func ProtectIndexChildren(candidates []Candidate, graph *ManifestGraph, mode string) ([]Candidate, []Retained) {
+	removed := make(map[string]bool)
+	for _, c := range candidates {
+		if c.RemovesManifest(mode) {
+			removed[c.ImageDigest] = true
+		}
+	}
+
+	// 从所有保留的 index 出发，沿引用关系标记受保护的子 manifest
+	protectedBy := make(map[string]string)
+	var queue []string
+	for digest := range graph.Children {
+		if !removed[digest] {
+			queue = append(queue, digest)
+		}
+	}
+	sort.Strings(queue)
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for _, child := range graph.Children[parent] {
+			if _, seen := protectedBy[child.Digest]; seen {
+				continue
+			}
+			protectedBy[child.Digest] = fmt.Sprintf("child manifest (%s) of retained index %s", child.Platform, parent)
+			if _, isIndex := graph.Children[child.Digest]; isIndex {
+				queue = append(queue, child.Digest)
+			}
+		}
+	}
+
+	var kept []Candidate
+	var retained []Retained
+	for _, c := range candidates {
+		if reason, ok := protectedBy[c.ImageDigest]; ok {
+			retained = append(retained, Retained{
+				RepositoryName: c.RepositoryName,
+				ImageDigest:    c.ImageDigest,
+				ImageTags:      c.ImageTags,
+				Reason:         reason,
+			})
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept, retained
+}
+
+// OrphanIndexes 返回所有子 manifest 都已不在仓库中的 index digest
+func OrphanIndexes(graph *ManifestGraph, images []*ecr.ImageDetail) []string {
+	present := make(map[string]bool, len(images))
+	for _, image := range images {
+		present[aws.StringValue(image.ImageDigest)] = true
+	}
+	var orphans []string
+	for _, image := range images {
+		digest := aws.StringValue(image.ImageDigest)
+		children, ok := graph.Children[digest]
+		if !ok || len(children) == 0 {
+			continue
+		}
+		missing := 0
+		for _, child := range children {
+			if !present[child.Digest] {
+				missing++
+			}
+		}
+		if missing == len(children) {
+			orphans = append(orphans, digest)
+		}
+	}
+	return orphans
+}
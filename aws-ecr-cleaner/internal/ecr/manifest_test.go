@@ -0,0 +1,137 @@
+package ecr
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func TestProtectIndexChildren(t *testing.T) {
+	// i1 → c1, c2；i2 → n（嵌套 index）→ c3
+	graph := &ManifestGraph{Children: map[string][]Descriptor{
+		dg("1"): {{Digest: dg("a")}, {Digest: dg("b")}},
+		dg("2"): {{Digest: dg("n"), MediaType: MediaTypeOCIIndex}},
+		dg("n"): {{Digest: dg("c")}},
+	}}
+	index := func(digest string, tags, stale []string) Candidate {
+		c := candidate(digest, day, tags...)
+		c.StaleTags = stale
+		c.IsIndex = true
+		return c
+	}
+
+	tests := []struct {
+		name         string
+		candidates   []Candidate
+		mode         string
+		wantCands    []string
+		wantRetained []string
+	}{
+		{
+			name:         "children of retained indexes are protected",
+			candidates:   []Candidate{candidate(dg("a"), day), candidate(dg("b"), day), candidate(dg("c"), day), candidate(dg("x"), day)},
+			mode:         DeleteModeDigest,
+			wantCands:    []string{dg("x")},
+			wantRetained: sorted(dg("a"), dg("b"), dg("c")),
+		},
+		{
+			name:         "children follow a deleted index",
+			candidates:   []Candidate{index(dg("1"), []string{"v1"}, []string{"v1"}), candidate(dg("a"), day), candidate(dg("b"), day), candidate(dg("c"), day)},
+			mode:         DeleteModeDigest,
+			wantCands:    sorted(dg("1"), dg("a"), dg("b")),
+			wantRetained: []string{dg("c")},
+		},
+		{
+			name:         "nested index children follow the outer index",
+			candidates:   []Candidate{index(dg("2"), nil, nil), index(dg("n"), nil, nil), candidate(dg("c"), day)},
+			mode:         DeleteModeDigest,
+			wantCands:    sorted(dg("2"), dg("n"), dg("c")),
+			wantRetained: []string{},
+		},
+		{
+			name:         "partially untagged index is still retained",
+			candidates:   []Candidate{index(dg("1"), []string{"v1", "release-1"}, []string{"v1"}), candidate(dg("a"), day)},
+			mode:         DeleteModeUntag,
+			wantCands:    []string{dg("1")},
+			wantRetained: []string{dg("a")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cands, retained := ProtectIndexChildren(tt.candidates, graph, tt.mode)
+			if got := candidateDigests(cands); !reflect.DeepEqual(got, tt.wantCands) {
+				t.Errorf("candidates = %v, want %v", got, tt.wantCands)
+			}
+			if got := retainedDigests(retained); !reflect.DeepEqual(got, tt.wantRetained) {
+				t.Errorf("retained = %v, want %v", got, tt.wantRetained)
+			}
+		})
+	}
+}
+
+// failingManifestRegistry 对 failures 中的 digest，BatchGetImage 以给定的失败代码代替返回的镜像
+type failingManifestRegistry struct {
+	Registry
+	failures map[string]string
+}
+
+func (f *failingManifestRegistry) BatchGetImage(input *ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error) {
+	out, err := f.Registry.BatchGetImage(input)
+	if err != nil {
+		return nil, err
+	}
+	var images []*ecr.Image
+	for _, img := range out.Images {
+		if code, ok := f.failures[aws.StringValue(img.ImageId.ImageDigest)]; ok {
+			out.Failures = append(out.Failures, &ecr.ImageFailure{ImageId: img.ImageId, FailureCode: aws.String(code), FailureReason: aws.String("injected failure")})
+			continue
+		}
+		images = append(images, img)
+	}
+	out.Images = images
+	return out, nil
+}
+
+func TestGetManifests(t *testing.T) {
+	images := []*ecr.ImageDetail{image(dg("1"), day, "multi"), image(dg("2"), day, "arm"), image(dg("a"), day)}
+	manifests := map[string]json.RawMessage{dg("1"): indexManifest(dg("a")), dg("2"): indexManifest(dg("a"))}
+
+	tests := []struct {
+		name     string
+		failures map[string]string
+		want     []string
+		wantErr  string
+	}{
+		{name: "all manifests", want: sorted(dg("1"), dg("2"))},
+		{name: "images deleted since the scan are skipped", failures: map[string]string{dg("2"): ecr.ImageFailureCodeImageNotFound}, want: []string{dg("1")}},
+		{name: "other failures are errors", failures: map[string]string{dg("2"): ecr.ImageFailureCodeKmsError}, wantErr: "failed to get manifest " + dg("2")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := &failingManifestRegistry{Registry: newTestRegistry(images, manifests), failures: tt.failures}
+			got, err := GetManifests(svc, testRepo, []string{dg("1"), dg("2")}, false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			digests := []string{}
+			for digest := range got {
+				digests = append(digests, digest)
+			}
+			sort.Strings(digests)
+			if !reflect.DeepEqual(digests, tt.want) {
+				t.Errorf("manifests = %v, want %v", digests, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,868 @@
+// aws-ecr-cleaner/internal/ecr/memory.go
+package ecr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// memoryPageSize 模拟 ECR 分页返回的条数
+const memoryPageSize = 100
+
+// Fixture 描述内存仓库的初始数据，通常从 JSON 文件加载
+// 镜像字段直接复用 SDK 的 ImageDetail，JSON 键名与 AWS CLI 输出一致（如 imageDigest、imageTags、imagePushedAt）
+// Blobs 以 digest 为键保存 config 与 layer 的内容（base64），供 GetDownloadUrlForLayer 返回的 memory:// 地址下载
+type Fixture struct {
+	AccountID    string              `json:"accountId"`
+	Repositories []FixtureRepository `json:"repositories"`
+	Blobs        map[string][]byte   `json:"blobs"`
+}
+
+// FixtureRepository 描述 fixture 中的单个仓库
+// Manifests 以 digest 为键保存原始 manifest（JSON 对象），供 BatchGetImage 返回
+// LifecyclePolicy 是仓库已有的生命周期策略（JSON 对象），供 GetLifecyclePolicy 返回
+// Tags 是仓库的资源 tag，格式与 aws ecr list-tags-for-resource 输出一致（Key / Value）
+// RepositoryPolicy 与仓库设置字段与 aws ecr describe-repositories 输出一致，未给出时使用 ECR 的默认值
+type FixtureRepository struct {
+	RepositoryName             string                          `json:"repositoryName"`
+	CreatedAt                  *time.Time                      `json:"createdAt"`
+	Images                     []*ecr.ImageDetail              `json:"images"`
+	Manifests                  map[string]json.RawMessage      `json:"manifests"`
+	LifecyclePolicy            json.RawMessage                 `json:"lifecyclePolicy"`
+	Tags                       []*ecr.Tag                      `json:"tags"`
+	RepositoryPolicy           json.RawMessage                 `json:"repositoryPolicy"`
+	ImageTagMutability         string                          `json:"imageTagMutability"`
+	ImageScanningConfiguration *ecr.ImageScanningConfiguration `json:"imageScanningConfiguration"`
+	EncryptionConfiguration    *ecr.EncryptionConfiguration    `json:"encryptionConfiguration"`
+}
+
+type memoryRepository struct {
+	repo            *ecr.Repository
+	images          []*ecr.ImageDetail
+	manifests       map[string]string
+	lifecyclePolicy string
+	preview         []*ecr.LifecyclePolicyPreviewResult // 最近一次预览的结果
+	previewed       bool
+	tags            []*ecr.Tag
+	policy          string
+}
+
+// MemoryRegistry 是 Registry 的内存实现，行为尽量贴近真实 ECR（分页、按 tag/digest 删除、Force 删除仓库）
+type MemoryRegistry struct {
+	AccountID string
+	Region    string
+
+	mu         sync.Mutex
+	repos      map[string]*memoryRepository
+	blobs      map[string][]byte
+	uploads    map[string]*bytes.Buffer // 进行中的 layer 上传，以 uploadId 为键
+	nextUpload int
+	client     *http.Client // 下载 memory:// 地址的 blob，见 BlobHTTPClient
+}
+
+// LoadMemoryRegistry 从 fixture 文件创建内存仓库
+func LoadMemoryRegistry(path, region string) (*MemoryRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry fixture '%s': %w", path, err)
+	}
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse registry fixture '%s': %w", path, err)
+	}
+	return NewMemoryRegistry(fixture, region), nil
+}
+
+// NewMemoryRegistry 根据 fixture 构造内存仓库，未指定 accountId 时使用 000000000000
+func NewMemoryRegistry(fixture Fixture, region string) *MemoryRegistry {
+	accountID := fixture.AccountID
+	if accountID == "" {
+		accountID = "000000000000"
+	}
+	m := &MemoryRegistry{
+		AccountID: accountID,
+		Region:    region,
+		repos:     make(map[string]*memoryRepository),
+		blobs:     make(map[string][]byte, len(fixture.Blobs)),
+		uploads:   make(map[string]*bytes.Buffer),
+	}
+	for digest, data := range fixture.Blobs {
+		m.blobs[digest] = data
+	}
+	m.client = &http.Client{Transport: memoryBlobServer{m}}
+	for _, fr := range fixture.Repositories {
+		createdAt := time.Now()
+		if fr.CreatedAt != nil {
+			createdAt = *fr.CreatedAt
+		}
+		repo := m.newRepository(fr.RepositoryName, createdAt, fr.ImageTagMutability, fr.ImageScanningConfiguration, fr.EncryptionConfiguration)
+		manifests := make(map[string]string, len(fr.Manifests))
+		for digest, raw := range fr.Manifests {
+			manifests[digest] = string(raw)
+		}
+		for _, img := range fr.Images {
+			img.RegistryId = aws.String(accountID)
+			img.RepositoryName = aws.String(fr.RepositoryName)
+			// 未显式给出 imageManifestMediaType 时从 manifest 内容推断
+			if img.ImageManifestMediaType == nil {
+				if raw, ok := manifests[aws.StringValue(img.ImageDigest)]; ok {
+					var head struct {
+						MediaType string `json:"mediaType"`
+					}
+					if json.Unmarshal([]byte(raw), &head) == nil && head.MediaType != "" {
+						img.ImageManifestMediaType = aws.String(head.MediaType)
+					}
+				}
+			}
+		}
+		m.repos[fr.RepositoryName] = &memoryRepository{repo: repo, images: fr.Images, manifests: manifests, lifecyclePolicy: string(fr.LifecyclePolicy), tags: fr.Tags, policy: string(fr.RepositoryPolicy)}
+	}
+	return m
+}
+
+// newRepository 构造仓库描述，未给出的设置使用 ECR 的默认值
+func (m *MemoryRegistry) newRepository(name string, createdAt time.Time, mutability string, scanning *ecr.ImageScanningConfiguration, encryption *ecr.EncryptionConfiguration) *ecr.Repository {
+	if mutability == "" {
+		mutability = ecr.ImageTagMutabilityMutable
+	}
+	if scanning == nil {
+		scanning = &ecr.ImageScanningConfiguration{ScanOnPush: aws.Bool(false)}
+	}
+	if encryption == nil {
+		encryption = &ecr.EncryptionConfiguration{EncryptionType: aws.String(ecr.EncryptionTypeAes256)}
+	}
+	return &ecr.Repository{
+		RegistryId:                 aws.String(m.AccountID),
+		RepositoryName:             aws.String(name),
+		RepositoryArn:              aws.String(fmt.Sprintf("arn:aws:ecr:%s:%s:repository/%s", m.Region, m.AccountID, name)),
+		RepositoryUri:              aws.String(fmt.Sprintf("%s.dkr.ecr.%s.amazonaws.com/%s", m.AccountID, m.Region, name)),
+		CreatedAt:                  aws.Time(createdAt),
+		ImageTagMutability:         aws.String(mutability),
+		ImageScanningConfiguration: scanning,
+		EncryptionConfiguration:    encryption,
+	}
+}
+
+// sortedNames 按名称排序返回仓库列表，保证输出稳定
+func (m *MemoryRegistry) sortedNames() []string {
+	names := make([]string, 0, len(m.repos))
+	for name := range m.repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func repositoryNotFound(name string) error {
+	return awserr.New(ecr.ErrCodeRepositoryNotFoundException,
+		fmt.Sprintf("The repository with name '%s' does not exist in the registry", name), nil)
+}
+
+// DescribeRepositoriesPages 实现 Registry
+func (m *MemoryRegistry) DescribeRepositoriesPages(input *ecr.DescribeRepositoriesInput, fn func(*ecr.DescribeRepositoriesOutput, bool) bool) error {
+	m.mu.Lock()
+	var repos []*ecr.Repository
+	if len(input.RepositoryNames) > 0 {
+		for _, n := range input.RepositoryNames {
+			r, ok := m.repos[aws.StringValue(n)]
+			if !ok {
+				m.mu.Unlock()
+				return repositoryNotFound(aws.StringValue(n))
+			}
+			repos = append(repos, r.repo)
+		}
+	} else {
+		for _, name := range m.sortedNames() {
+			repos = append(repos, m.repos[name].repo)
+		}
+	}
+	m.mu.Unlock()
+
+	return paginate(len(repos), input.NextToken, func(start, end int, nextToken *string) bool {
+		return fn(&ecr.DescribeRepositoriesOutput{Repositories: repos[start:end], NextToken: nextToken}, nextToken == nil)
+	})
+}
+
+// DescribeImagesPages 实现 Registry
+func (m *MemoryRegistry) DescribeImagesPages(input *ecr.DescribeImagesInput, fn func(*ecr.DescribeImagesOutput, bool) bool) error {
+	m.mu.Lock()
+	r, ok := m.repos[aws.StringValue(input.RepositoryName)]
+	if !ok {
+		m.mu.Unlock()
+		return repositoryNotFound(aws.StringValue(input.RepositoryName))
+	}
+	images := make([]*ecr.ImageDetail, 0, len(r.images))
+	for _, img := range r.images {
+		cp := *img
+		cp.ImageTags = append([]*string(nil), img.ImageTags...)
+		images = append(images, &cp)
+	}
+	m.mu.Unlock()
+
+	return paginate(len(images), input.NextToken, func(start, end int, nextToken *string) bool {
+		return fn(&ecr.DescribeImagesOutput{ImageDetails: images[start:end], NextToken: nextToken}, nextToken == nil)
+	})
+}
+
+// paginate 按 memoryPageSize 切分 total 条记录并逐页回调，NextToken 为下一页起始下标
+func paginate(total int, token *string, page func(start, end int, nextToken *string) bool) error {
+	start := 0
+	if token != nil {
+		n, err := strconv.Atoi(aws.StringValue(token))
+		if err != nil || n < 0 || n > total {
+			return awserr.New(ecr.ErrCodeInvalidParameterException, "Invalid NextToken", err)
+		}
+		start = n
+	}
+	for {
+		end := start + memoryPageSize
+		if end > total {
+			end = total
+		}
+		var nextToken *string
+		if end < total {
+			nextToken = aws.String(strconv.Itoa(end))
+		}
+		if !page(start, end, nextToken) || nextToken == nil {
+			return nil
+		}
+		start = end
+	}
+}
+
+// BatchGetImage 实现 Registry，只返回 fixture 中提供了 manifest 的镜像
+func (m *MemoryRegistry) BatchGetImage(input *ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.repos[aws.StringValue(input.RepositoryName)]
+	if !ok {
+		return nil, repositoryNotFound(aws.StringValue(input.RepositoryName))
+	}
+
+	out := &ecr.BatchGetImageOutput{}
+	for _, id := range input.ImageIds {
+		img := r.findImage(aws.StringValue(id.ImageDigest), aws.StringValue(id.ImageTag))
+		if img == nil {
+			out.Failures = append(out.Failures, &ecr.ImageFailure{
+				ImageId:       id,
+				FailureCode:   aws.String(ecr.ImageFailureCodeImageNotFound),
+				FailureReason: aws.String("Requested image not found"),
+			})
+			continue
+		}
+		raw, ok := r.manifests[aws.StringValue(img.ImageDigest)]
+		if !ok {
+			out.Failures = append(out.Failures, &ecr.ImageFailure{
+				ImageId:       id,
+				FailureCode:   aws.String(ecr.ImageFailureCodeImageNotFound),
+				FailureReason: aws.String("Manifest not present in fixture"),
+			})
+			continue
+		}
+		out.Images = append(out.Images, &ecr.Image{
+			RegistryId:             aws.String(m.AccountID),
+			RepositoryName:         input.RepositoryName,
+			ImageId:                &ecr.ImageIdentifier{ImageDigest: img.ImageDigest, ImageTag: id.ImageTag},
+			ImageManifest:          aws.String(raw),
+			ImageManifestMediaType: img.ImageManifestMediaType,
+		})
+	}
+	return out, nil
+}
+
+// findImage 按 digest 和/或 tag 查找镜像
+func (r *memoryRepository) findImage(digest, tag string) *ecr.ImageDetail {
+	for _, img := range r.images {
+		if digest != "" && aws.StringValue(img.ImageDigest) != digest {
+			continue
+		}
+		if tag != "" && !hasTag(img, tag) {
+			continue
+		}
+		return img
+	}
+	return nil
+}
+
+// referencedByIndex 判断仓库中是否仍有 index 引用该 digest
+func (r *memoryRepository) referencedByIndex(digest string) bool {
+	for _, img := range r.images {
+		raw, ok := r.manifests[aws.StringValue(img.ImageDigest)]
+		if !ok {
+			continue
+		}
+		m, err := ParseManifest(aws.StringValue(img.ImageDigest), raw, aws.StringValue(img.ImageManifestMediaType))
+		if err != nil || !m.IsIndex() {
+			continue
+		}
+		for _, child := range m.Manifests {
+			if child.Digest == digest {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// BatchDeleteImage 实现 Registry
+// 仅指定 digest 时删除整个 manifest；指定 tag 时只移除该 tag，移除最后一个 tag 后镜像随之删除（与 ECR 一致）
+func (m *MemoryRegistry) BatchDeleteImage(input *ecr.BatchDeleteImageInput) (*ecr.BatchDeleteImageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.repos[aws.StringValue(input.RepositoryName)]
+	if !ok {
+		return nil, repositoryNotFound(aws.StringValue(input.RepositoryName))
+	}
+
+	out := &ecr.BatchDeleteImageOutput{}
+	for _, id := range input.ImageIds {
+		digest := aws.StringValue(id.ImageDigest)
+		tag := aws.StringValue(id.ImageTag)
+
+		idx := -1
+		for i, img := range r.images {
+			if digest != "" && aws.StringValue(img.ImageDigest) != digest {
+				continue
+			}
+			if tag != "" && !hasTag(img, tag) {
+				continue
+			}
+			idx = i
+			break
+		}
+		if idx < 0 {
+			out.Failures = append(out.Failures, &ecr.ImageFailure{
+				ImageId:       id,
+				FailureCode:   aws.String(ecr.ImageFailureCodeImageNotFound),
+				FailureReason: aws.String("Requested image not found"),
+			})
+			continue
+		}
+
+		img := r.images[idx]
+		if tag == "" && r.referencedByIndex(aws.StringValue(img.ImageDigest)) {
+			out.Failures = append(out.Failures, &ecr.ImageFailure{
+				ImageId:       id,
+				FailureCode:   aws.String(ecr.ImageFailureCodeImageReferencedByManifestList),
+				FailureReason: aws.String("Requested image is referenced by an image index"),
+			})
+			continue
+		}
+		if tag != "" {
+			var remaining []*string
+			for _, t := range img.ImageTags {
+				if aws.StringValue(t) != tag {
+					remaining = append(remaining, t)
+				}
+			}
+			img.ImageTags = remaining
+			if len(remaining) > 0 {
+				out.ImageIds = append(out.ImageIds, &ecr.ImageIdentifier{ImageDigest: img.ImageDigest, ImageTag: aws.String(tag)})
+				continue
+			}
+		}
+		r.images = append(r.images[:idx], r.images[idx+1:]...)
+		out.ImageIds = append(out.ImageIds, &ecr.ImageIdentifier{ImageDigest: img.ImageDigest, ImageTag: id.ImageTag})
+	}
+	return out, nil
+}
+
+// DeleteRepository 实现 Registry
+func (m *MemoryRegistry) DeleteRepository(input *ecr.DeleteRepositoryInput) (*ecr.DeleteRepositoryOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	r, ok := m.repos[name]
+	if !ok {
+		return nil, repositoryNotFound(name)
+	}
+	if len(r.images) > 0 && !aws.BoolValue(input.Force) {
+		return nil, awserr.New(ecr.ErrCodeRepositoryNotEmptyException,
+			fmt.Sprintf("The repository with name '%s' cannot be deleted because it still contains images", name), nil)
+	}
+	delete(m.repos, name)
+	return &ecr.DeleteRepositoryOutput{Repository: r.repo}, nil
+}
+
+// StartLifecyclePolicyPreview 实现 Registry；使用离线评估器立即完成预览
+func (m *MemoryRegistry) StartLifecyclePolicyPreview(input *ecr.StartLifecyclePolicyPreviewInput) (*ecr.StartLifecyclePolicyPreviewOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	r, ok := m.repos[name]
+	if !ok {
+		return nil, repositoryNotFound(name)
+	}
+	text := aws.StringValue(input.LifecyclePolicyText)
+	if text == "" {
+		text = r.lifecyclePolicy
+	}
+	policy, err := ParseLifecyclePolicy(text)
+	if err != nil {
+		return nil, awserr.New(ecr.ErrCodeInvalidParameterException, err.Error(), nil)
+	}
+	r.preview = nil
+	for _, e := range policy.Evaluate(r.images, time.Now()) {
+		r.preview = append(r.preview, &ecr.LifecyclePolicyPreviewResult{
+			ImageDigest:         aws.String(e.ImageDigest),
+			ImageTags:           aws.StringSlice(e.ImageTags),
+			ImagePushedAt:       aws.Time(e.PushTime),
+			AppliedRulePriority: aws.Int64(int64(e.RulePriority)),
+			Action:              &ecr.LifecyclePolicyRuleAction{Type: aws.String(ecr.ImageActionTypeExpire)},
+		})
+	}
+	r.previewed = true
+	return &ecr.StartLifecyclePolicyPreviewOutput{
+		RegistryId:          aws.String(m.AccountID),
+		RepositoryName:      aws.String(name),
+		LifecyclePolicyText: aws.String(text),
+		Status:              aws.String(ecr.LifecyclePolicyPreviewStatusInProgress),
+	}, nil
+}
+
+// GetLifecyclePolicyPreview 实现 Registry，按 memoryPageSize 分页返回最近一次预览的结果
+func (m *MemoryRegistry) GetLifecyclePolicyPreview(input *ecr.GetLifecyclePolicyPreviewInput) (*ecr.GetLifecyclePolicyPreviewOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	r, ok := m.repos[name]
+	if !ok {
+		return nil, repositoryNotFound(name)
+	}
+	if !r.previewed {
+		return nil, awserr.New(ecr.ErrCodeLifecyclePolicyPreviewNotFoundException, "There is no dry run for this repository", nil)
+	}
+	start := 0
+	if input.NextToken != nil {
+		n, err := strconv.Atoi(aws.StringValue(input.NextToken))
+		if err != nil || n < 0 || n > len(r.preview) {
+			return nil, awserr.New(ecr.ErrCodeInvalidParameterException, "Invalid NextToken", nil)
+		}
+		start = n
+	}
+	end := start + memoryPageSize
+	if end > len(r.preview) {
+		end = len(r.preview)
+	}
+	out := &ecr.GetLifecyclePolicyPreviewOutput{
+		RegistryId:     aws.String(m.AccountID),
+		RepositoryName: aws.String(name),
+		Status:         aws.String(ecr.LifecyclePolicyPreviewStatusComplete),
+		PreviewResults: r.preview[start:end],
+	}
+	if end < len(r.preview) {
+		out.NextToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+// GetLifecyclePolicy 实现 Registry
+func (m *MemoryRegistry) GetLifecyclePolicy(input *ecr.GetLifecyclePolicyInput) (*ecr.GetLifecyclePolicyOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	r, ok := m.repos[name]
+	if !ok {
+		return nil, repositoryNotFound(name)
+	}
+	if r.lifecyclePolicy == "" {
+		return nil, awserr.New(ecr.ErrCodeLifecyclePolicyNotFoundException, "Lifecycle policy does not exist for the repository", nil)
+	}
+	return &ecr.GetLifecyclePolicyOutput{
+		RegistryId:          aws.String(m.AccountID),
+		RepositoryName:      aws.String(name),
+		LifecyclePolicyText: aws.String(r.lifecyclePolicy),
+	}, nil
+}
+
+// PutLifecyclePolicy 实现 Registry，只保存策略文本
+func (m *MemoryRegistry) PutLifecyclePolicy(input *ecr.PutLifecyclePolicyInput) (*ecr.PutLifecyclePolicyOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	r, ok := m.repos[name]
+	if !ok {
+		return nil, repositoryNotFound(name)
+	}
+	r.lifecyclePolicy = aws.StringValue(input.LifecyclePolicyText)
+	return &ecr.PutLifecyclePolicyOutput{
+		RegistryId:          aws.String(m.AccountID),
+		RepositoryName:      aws.String(name),
+		LifecyclePolicyText: input.LifecyclePolicyText,
+	}, nil
+}
+
+// ListTagsForResource 实现 Registry，按仓库 ARN 查找
+func (m *MemoryRegistry) ListTagsForResource(input *ecr.ListTagsForResourceInput) (*ecr.ListTagsForResourceOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	arn := aws.StringValue(input.ResourceArn)
+	for _, r := range m.repos {
+		if aws.StringValue(r.repo.RepositoryArn) == arn {
+			return &ecr.ListTagsForResourceOutput{Tags: r.tags}, nil
+		}
+	}
+	return nil, awserr.New(ecr.ErrCodeRepositoryNotFoundException,
+		fmt.Sprintf("The repository with ARN '%s' does not exist in the registry", arn), nil)
+}
+
+// GetRepositoryPolicy 实现 Registry
+func (m *MemoryRegistry) GetRepositoryPolicy(input *ecr.GetRepositoryPolicyInput) (*ecr.GetRepositoryPolicyOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	r, ok := m.repos[name]
+	if !ok {
+		return nil, repositoryNotFound(name)
+	}
+	if r.policy == "" {
+		return nil, awserr.New(ecr.ErrCodeRepositoryPolicyNotFoundException, "Repository policy does not exist for the repository", nil)
+	}
+	return &ecr.GetRepositoryPolicyOutput{
+		RegistryId:     aws.String(m.AccountID),
+		RepositoryName: aws.String(name),
+		PolicyText:     aws.String(r.policy),
+	}, nil
+}
+
+// GetDownloadUrlForLayer 实现 Registry，返回由 BlobHTTPClient 提供内容的 memory:// 地址
+func (m *MemoryRegistry) GetDownloadUrlForLayer(input *ecr.GetDownloadUrlForLayerInput) (*ecr.GetDownloadUrlForLayerOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := m.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+	digest := aws.StringValue(input.LayerDigest)
+	if _, ok := m.blobs[digest]; !ok {
+		return nil, awserr.New(ecr.ErrCodeLayersNotFoundException,
+			fmt.Sprintf("The layer %s does not exist in the repository with name '%s'", digest, name), nil)
+	}
+	return &ecr.GetDownloadUrlForLayerOutput{
+		DownloadUrl: aws.String(fmt.Sprintf("memory://%s/%s/blobs/%s", memoryBlobHost(m.AccountID, m.Region), name, digest)),
+		LayerDigest: input.LayerDigest,
+	}, nil
+}
+
+// memoryPartSize 是 InitiateLayerUpload 返回的建议分片大小
+const memoryPartSize = 5 << 20
+
+// CreateRepository 实现 Registry
+func (m *MemoryRegistry) CreateRepository(input *ecr.CreateRepositoryInput) (*ecr.CreateRepositoryOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := m.repos[name]; ok {
+		return nil, awserr.New(ecr.ErrCodeRepositoryAlreadyExistsException,
+			fmt.Sprintf("The repository with name '%s' already exists in the registry", name), nil)
+	}
+	repo := m.newRepository(name, time.Now(), aws.StringValue(input.ImageTagMutability), input.ImageScanningConfiguration, input.EncryptionConfiguration)
+	m.repos[name] = &memoryRepository{repo: repo, manifests: make(map[string]string), tags: input.Tags}
+	return &ecr.CreateRepositoryOutput{Repository: repo}, nil
+}
+
+// SetRepositoryPolicy 实现 Registry
+func (m *MemoryRegistry) SetRepositoryPolicy(input *ecr.SetRepositoryPolicyInput) (*ecr.SetRepositoryPolicyOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	r, ok := m.repos[name]
+	if !ok {
+		return nil, repositoryNotFound(name)
+	}
+	r.policy = aws.StringValue(input.PolicyText)
+	return &ecr.SetRepositoryPolicyOutput{
+		RegistryId:     aws.String(m.AccountID),
+		RepositoryName: aws.String(name),
+		PolicyText:     input.PolicyText,
+	}, nil
+}
+
+// BatchCheckLayerAvailability 实现 Registry；blob 在整个内存仓库内共享
+func (m *MemoryRegistry) BatchCheckLayerAvailability(input *ecr.BatchCheckLayerAvailabilityInput) (*ecr.BatchCheckLayerAvailabilityOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := m.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+	out := &ecr.BatchCheckLayerAvailabilityOutput{}
+	for _, d := range input.LayerDigests {
+		data, ok := m.blobs[aws.StringValue(d)]
+		if !ok {
+			out.Failures = append(out.Failures, &ecr.LayerFailure{
+				LayerDigest:   d,
+				FailureCode:   aws.String(ecr.LayerFailureCodeMissingLayerDigest),
+				FailureReason: aws.String("Could not find layer"),
+			})
+			continue
+		}
+		out.Layers = append(out.Layers, &ecr.Layer{
+			LayerDigest:       d,
+			LayerAvailability: aws.String(ecr.LayerAvailabilityAvailable),
+			LayerSize:         aws.Int64(int64(len(data))),
+		})
+	}
+	return out, nil
+}
+
+// InitiateLayerUpload 实现 Registry
+func (m *MemoryRegistry) InitiateLayerUpload(input *ecr.InitiateLayerUploadInput) (*ecr.InitiateLayerUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := m.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+	m.nextUpload++
+	id := fmt.Sprintf("%s-%d", name, m.nextUpload)
+	m.uploads[id] = &bytes.Buffer{}
+	return &ecr.InitiateLayerUploadOutput{UploadId: aws.String(id), PartSize: aws.Int64(memoryPartSize)}, nil
+}
+
+// UploadLayerPart 实现 Registry，分片必须从已接收内容的末尾开始
+func (m *MemoryRegistry) UploadLayerPart(input *ecr.UploadLayerPartInput) (*ecr.UploadLayerPartOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := m.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+	buf, ok := m.uploads[aws.StringValue(input.UploadId)]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeUploadNotFoundException, "The upload could not be found", nil)
+	}
+	first, last := aws.Int64Value(input.PartFirstByte), aws.Int64Value(input.PartLastByte)
+	if first != int64(buf.Len()) || last-first+1 != int64(len(input.LayerPartBlob)) {
+		return nil, awserr.New(ecr.ErrCodeInvalidLayerPartException,
+			fmt.Sprintf("The layer part %d-%d is not contiguous with %d bytes received", first, last, buf.Len()), nil)
+	}
+	buf.Write(input.LayerPartBlob)
+	return &ecr.UploadLayerPartOutput{
+		RegistryId:       aws.String(m.AccountID),
+		RepositoryName:   aws.String(name),
+		UploadId:         input.UploadId,
+		LastByteReceived: aws.Int64(last),
+	}, nil
+}
+
+// CompleteLayerUpload 实现 Registry，校验上传内容的 sha256 与声明的 digest 一致
+func (m *MemoryRegistry) CompleteLayerUpload(input *ecr.CompleteLayerUploadInput) (*ecr.CompleteLayerUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	if _, ok := m.repos[name]; !ok {
+		return nil, repositoryNotFound(name)
+	}
+	id := aws.StringValue(input.UploadId)
+	buf, ok := m.uploads[id]
+	if !ok {
+		return nil, awserr.New(ecr.ErrCodeUploadNotFoundException, "The upload could not be found", nil)
+	}
+	delete(m.uploads, id)
+	if buf.Len() == 0 {
+		return nil, awserr.New(ecr.ErrCodeEmptyUploadException, "The upload contains no layer parts", nil)
+	}
+	if len(input.LayerDigests) != 1 {
+		return nil, awserr.New(ecr.ErrCodeInvalidParameterException, "Exactly one layer digest is required", nil)
+	}
+	digest := aws.StringValue(input.LayerDigests[0])
+	sum := sha256.Sum256(buf.Bytes())
+	if got := "sha256:" + hex.EncodeToString(sum[:]); got != digest {
+		return nil, awserr.New(ecr.ErrCodeInvalidLayerException,
+			fmt.Sprintf("The layer digest %s does not match the uploaded content (%s)", digest, got), nil)
+	}
+	if _, ok := m.blobs[digest]; ok {
+		return nil, awserr.New(ecr.ErrCodeLayerAlreadyExistsException,
+			fmt.Sprintf("The layer %s already exists in the repository with name '%s'", digest, name), nil)
+	}
+	m.blobs[digest] = buf.Bytes()
+	return &ecr.CompleteLayerUploadOutput{
+		RegistryId:     aws.String(m.AccountID),
+		RepositoryName: aws.String(name),
+		UploadId:       input.UploadId,
+		LayerDigest:    aws.String(digest),
+	}, nil
+}
+
+// PutImage 实现 Registry：校验 manifest 的 digest 与引用的内容，按 ECR 的规则处理 tag 移动与不可变 tag
+func (m *MemoryRegistry) PutImage(input *ecr.PutImageInput) (*ecr.PutImageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name := aws.StringValue(input.RepositoryName)
+	r, ok := m.repos[name]
+	if !ok {
+		return nil, repositoryNotFound(name)
+	}
+	raw := aws.StringValue(input.ImageManifest)
+	sum := sha256.Sum256([]byte(raw))
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if d := aws.StringValue(input.ImageDigest); d != "" && d != digest {
+		return nil, awserr.New(ecr.ErrCodeImageDigestDoesNotMatchException,
+			fmt.Sprintf("The image digest %s does not match the manifest digest %s", d, digest), nil)
+	}
+	manifest, err := ParseManifest(digest, raw, aws.StringValue(input.ImageManifestMediaType))
+	if err != nil {
+		return nil, awserr.New(ecr.ErrCodeInvalidParameterException, err.Error(), nil)
+	}
+
+	var size int64
+	if manifest.IsIndex() {
+		for _, child := range manifest.Manifests {
+			if r.findImage(child.Digest, "") == nil {
+				return nil, awserr.New(ecr.ErrCodeReferencedImagesNotFoundException,
+					fmt.Sprintf("The referenced image %s does not exist in the repository", child.Digest), nil)
+			}
+		}
+	} else {
+		blobs := manifest.Layers
+		if manifest.Config != nil {
+			blobs = append([]Descriptor{*manifest.Config}, blobs...)
+		}
+		for _, b := range blobs {
+			if _, ok := m.blobs[b.Digest]; !ok {
+				return nil, awserr.New(ecr.ErrCodeLayersNotFoundException,
+					fmt.Sprintf("The layer %s referenced by the manifest does not exist", b.Digest), nil)
+			}
+			size += b.Size
+		}
+	}
+
+	tag := aws.StringValue(input.ImageTag)
+	existing := r.findImage(digest, "")
+	if tag != "" {
+		if holder := r.findImage("", tag); holder != nil {
+			if holder == existing {
+				return nil, awserr.New(ecr.ErrCodeImageAlreadyExistsException,
+					fmt.Sprintf("Image with digest '%s' and tag '%s' already exists in the repository", digest, tag), nil)
+			}
+			if aws.StringValue(r.repo.ImageTagMutability) == ecr.ImageTagMutabilityImmutable {
+				return nil, awserr.New(ecr.ErrCodeImageTagAlreadyExistsException,
+					fmt.Sprintf("The image tag '%s' already exists in the repository and cannot be overwritten because the repository is immutable", tag), nil)
+			}
+			var remaining []*string
+			for _, t := range holder.ImageTags {
+				if aws.StringValue(t) != tag {
+					remaining = append(remaining, t)
+				}
+			}
+			holder.ImageTags = remaining
+		}
+	} else if existing != nil {
+		return nil, awserr.New(ecr.ErrCodeImageAlreadyExistsException,
+			fmt.Sprintf("Image with digest '%s' already exists in the repository", digest), nil)
+	}
+
+	if existing == nil {
+		existing = &ecr.ImageDetail{
+			RegistryId:             aws.String(m.AccountID),
+			RepositoryName:         aws.String(name),
+			ImageDigest:            aws.String(digest),
+			ImagePushedAt:          aws.Time(time.Now()),
+			ImageSizeInBytes:       aws.Int64(size),
+			ImageManifestMediaType: aws.String(manifest.MediaType),
+		}
+		r.images = append(r.images, existing)
+		r.manifests[digest] = raw
+	}
+	if tag != "" {
+		existing.ImageTags = append(existing.ImageTags, aws.String(tag))
+	}
+	return &ecr.PutImageOutput{Image: &ecr.Image{
+		RegistryId:             aws.String(m.AccountID),
+		RepositoryName:         aws.String(name),
+		ImageId:                &ecr.ImageIdentifier{ImageDigest: aws.String(digest), ImageTag: input.ImageTag},
+		ImageManifest:          aws.String(raw),
+		ImageManifestMediaType: aws.String(manifest.MediaType),
+	}}, nil
+}
+
+// memoryBlobHost 返回内存仓库在 memory:// 地址中的主机名
+func memoryBlobHost(accountID, region string) string {
+	return accountID + "." + region
+}
+
+// BlobHTTPClient 实现 BlobDownloader：下载本仓库 GetDownloadUrlForLayer 返回的 memory:// 地址，
+// 使归档与复制流程在内存仓库上也走与真实 ECR 相同的 HTTP 下载路径，而不影响真实 ECR 使用的默认客户端
+func (m *MemoryRegistry) BlobHTTPClient() *http.Client {
+	return m.client
+}
+
+// memoryBlobServer 是内存仓库 memory:// 地址的 RoundTripper，按路径中的 digest 返回 blob 内容
+type memoryBlobServer struct {
+	m *MemoryRegistry
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (s memoryBlobServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var data []byte
+	ok := req.URL.Scheme == "memory" && req.URL.Host == memoryBlobHost(s.m.AccountID, s.m.Region)
+	if ok {
+		if i := strings.LastIndex(req.URL.Path, "/blobs/"); i >= 0 {
+			s.m.mu.Lock()
+			data, ok = s.m.blobs[req.URL.Path[i+len("/blobs/"):]]
+			s.m.mu.Unlock()
+		} else {
+			ok = false
+		}
+	}
+	resp := &http.Response{
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Request:    req,
+	}
+	if !ok {
+		resp.StatusCode = http.StatusNotFound
+		resp.Status = "404 Not Found"
+		resp.Body = io.NopCloser(strings.NewReader(""))
+		return resp, nil
+	}
+	resp.StatusCode = http.StatusOK
+	resp.Status = "200 OK"
+	resp.ContentLength = int64(len(data))
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+func hasTag(img *ecr.ImageDetail, tag string) bool {
+	for _, t := range img.ImageTags {
+		if aws.StringValue(t) == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,380 @@
+// aws-ecr-cleaner/internal/ecr/ocilayout.go
+package ecr
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// OCI image layout 的固定文件与注解
+const (
+	ociLayoutFile    = "oci-layout"
+	ociIndexFile     = "index.json"
+	ociLayoutVersion = "1.0.0"
+
+	AnnotationRefName    = "org.opencontainers.image.ref.name" // OCI 标准引用名，归档时写入镜像 tag
+	AnnotationRepository = "aws-ecr-cleaner.repository"        // 镜像所在的 ECR 仓库
+	AnnotationArchivedAt = "aws-ecr-cleaner.archived-at"       // 归档时间（RFC 3339）
+)
+
+// sha256Digest 匹配 layout 中允许的 blob digest，防止 digest 拼出越界路径
+var sha256Digest = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// OCIIndex 是 layout 根目录下的 index.json，每个归档镜像的每个 tag 各占一条，未打标签的镜像占一条不含引用名的记录
+type OCIIndex struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []Descriptor `json:"manifests"`
+}
+
+// Find 按仓库与 tag 或 digest 查找 index 中的记录，ref 以 sha256: 开头时按 digest 匹配
+func (idx *OCIIndex) Find(repositoryName, ref string) (Descriptor, bool) {
+	var found Descriptor
+	ok := false
+	for _, d := range idx.Manifests {
+		if d.Annotations[AnnotationRepository] != repositoryName {
+			continue
+		}
+		if d.Digest != ref && d.Annotations[AnnotationRefName] != ref {
+			continue
+		}
+		// 同一镜像可能被多次归档，取最近一次
+		if !ok || d.Annotations[AnnotationArchivedAt] > found.Annotations[AnnotationArchivedAt] {
+			found, ok = d, true
+		}
+	}
+	return found, ok
+}
+
+// OCILayout 是本地的 OCI image layout 目录：blobs/sha256/<hex> 按内容寻址保存 manifest、config 与 layer，
+// 不同镜像共享的 blob 只保存一份
+type OCILayout struct {
+	Root string
+
+	mu sync.Mutex // 保护 index.json 的读改写
+}
+
+// OpenOCILayout 打开（不存在时创建）root 处的 OCI image layout
+func OpenOCILayout(root string) (*OCILayout, error) {
+	if err := os.MkdirAll(filepath.Join(root, "blobs", "sha256"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create OCI layout '%s': %w", root, err)
+	}
+	l := &OCILayout{Root: root}
+	layoutPath := filepath.Join(root, ociLayoutFile)
+	if _, err := os.Stat(layoutPath); os.IsNotExist(err) {
+		data := []byte(`{"imageLayoutVersion":"` + ociLayoutVersion + `"}`)
+		if err := os.WriteFile(layoutPath, data, 0644); err != nil {
+			return nil, fmt.Errorf("failed to write '%s': %w", layoutPath, err)
+		}
+	}
+	return l, nil
+}
+
+// blobPath 返回 blob 在 layout 中的路径
+func (l *OCILayout) blobPath(digest string) (string, error) {
+	if !sha256Digest.MatchString(digest) {
+		return "", fmt.Errorf("unsupported digest '%s'", digest)
+	}
+	return filepath.Join(l.Root, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:")), nil
+}
+
+// HasBlob 判断 layout 中是否已有该 blob
+func (l *OCILayout) HasBlob(digest string) bool {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// WriteBlob 将 r 的内容写入 layout，边写边计算 sha256，与 digest 不一致时丢弃，返回写入的字节数
+func (l *OCILayout) WriteBlob(digest string, r io.Reader) (int64, error) {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("failed to write blob %s: %w", digest, err)
+	}
+	if got := "sha256:" + hex.EncodeToString(h.Sum(nil)); got != digest {
+		return n, fmt.Errorf("digest mismatch for blob %s: got %s", digest, got)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// ReadBlob 读取 layout 中的 blob
+func (l *OCILayout) ReadBlob(digest string) ([]byte, error) {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(path)
+}
+
+// OpenBlob 打开 layout 中的 blob 供流式读取
+func (l *OCILayout) OpenBlob(digest string) (*os.File, error) {
+	path, err := l.blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// VerifyBlob 重新读取磁盘上的 blob，校验大小与 sha256 均与描述符一致
+func (l *OCILayout) VerifyBlob(d Descriptor) error {
+	f, err := l.OpenBlob(d.Digest)
+	if err != nil {
+		return fmt.Errorf("blob %s missing from archive: %w", d.Digest, err)
+	}
+	defer f.Close()
+	return verifyDigest(f, d)
+}
+
+// verifyDigest 校验 r 的内容与描述符的大小和 digest 一致
+func verifyDigest(r io.Reader, d Descriptor) error {
+	h := sha256.New()
+	n, err := io.Copy(h, r)
+	if err != nil {
+		return fmt.Errorf("failed to read blob %s: %w", d.Digest, err)
+	}
+	if n != d.Size {
+		return fmt.Errorf("size mismatch for blob %s: expected %d bytes, got %d", d.Digest, d.Size, n)
+	}
+	if got := "sha256:" + hex.EncodeToString(h.Sum(nil)); got != d.Digest {
+		return fmt.Errorf("digest mismatch for blob %s: got %s", d.Digest, got)
+	}
+	return nil
+}
+
+// ReadIndex 读取 index.json，不存在时返回空 index
+func (l *OCILayout) ReadIndex() (*OCIIndex, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.readIndex()
+}
+
+func (l *OCILayout) readIndex() (*OCIIndex, error) {
+	idx := &OCIIndex{SchemaVersion: 2, MediaType: MediaTypeOCIIndex}
+	data, err := os.ReadFile(filepath.Join(l.Root, ociIndexFile))
+	if os.IsNotExist(err) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("failed to parse '%s': %w", filepath.Join(l.Root, ociIndexFile), err)
+	}
+	return idx, nil
+}
+
+// AddToIndex 将描述符追加到 index.json；仓库、tag 与 digest 均相同的旧记录被替换
+// 先写入临时文件再重命名，避免中断时留下损坏的 index
+func (l *OCILayout) AddToIndex(descs []Descriptor) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	idx, err := l.readIndex()
+	if err != nil {
+		return err
+	}
+	for _, d := range descs {
+		replaced := false
+		for i, existing := range idx.Manifests {
+			if existing.Digest == d.Digest &&
+				existing.Annotations[AnnotationRepository] == d.Annotations[AnnotationRepository] &&
+				existing.Annotations[AnnotationRefName] == d.Annotations[AnnotationRefName] {
+				idx.Manifests[i] = d
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			idx.Manifests = append(idx.Manifests, d)
+		}
+	}
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(l.Root, ociIndexFile)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// PackOCILayout 将 layout 目录打包为 tar 文件（tar 内以 layout 根目录为根，符合 OCI layout tarball 约定）
+func PackOCILayout(root, tarPath string) error {
+	if err := os.MkdirAll(filepath.Dir(tarPath), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(tarPath)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(f)
+	walkErr := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		// 跳过未完成的临时文件
+		if strings.HasPrefix(info.Name(), ".tmp-") || strings.HasSuffix(info.Name(), ".tmp") {
+			return nil
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err := tw.Close(); walkErr == nil {
+		walkErr = err
+	}
+	if err := f.Close(); walkErr == nil {
+		walkErr = err
+	}
+	if walkErr != nil {
+		os.Remove(tarPath)
+		return fmt.Errorf("failed to pack OCI layout '%s' into '%s': %w", root, tarPath, walkErr)
+	}
+	return nil
+}
+
+// VerifyOCITarball 读取 tar 文件，校验每个 blob 的 sha256 与文件名一致，且 index.json 引用的 manifest 均在 tar 中
+func VerifyOCITarball(tarPath string) (*OCIIndex, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	blobs := make(map[string]int64)
+	var idx *OCIIndex
+	hasLayout := false
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", tarPath, err)
+		}
+		switch {
+		case hdr.Name == ociLayoutFile:
+			hasLayout = true
+		case hdr.Name == ociIndexFile:
+			idx = &OCIIndex{}
+			if err := json.NewDecoder(tr).Decode(idx); err != nil {
+				return nil, fmt.Errorf("failed to parse index.json in '%s': %w", tarPath, err)
+			}
+		case strings.HasPrefix(hdr.Name, "blobs/sha256/") && hdr.Typeflag == tar.TypeReg:
+			digest := "sha256:" + strings.TrimPrefix(hdr.Name, "blobs/sha256/")
+			if err := verifyDigest(tr, Descriptor{Digest: digest, Size: hdr.Size}); err != nil {
+				return nil, fmt.Errorf("'%s': %w", tarPath, err)
+			}
+			blobs[digest] = hdr.Size
+		}
+	}
+	if !hasLayout || idx == nil {
+		return nil, fmt.Errorf("'%s' is not an OCI image layout (missing %s or %s)", tarPath, ociLayoutFile, ociIndexFile)
+	}
+	for _, d := range idx.Manifests {
+		size, ok := blobs[d.Digest]
+		if !ok {
+			return nil, fmt.Errorf("'%s': manifest %s referenced by index.json is missing", tarPath, d.Digest)
+		}
+		if size != d.Size {
+			return nil, fmt.Errorf("'%s': size mismatch for manifest %s", tarPath, d.Digest)
+		}
+	}
+	return idx, nil
+}
+
+// ExtractOCITarball 将 tar 格式的归档解包到 dir，返回其中的 layout；只接受 layout 约定内的路径
+func ExtractOCITarball(tarPath, dir string) (*OCILayout, error) {
+	f, err := os.Open(tarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read '%s': %w", tarPath, err)
+		}
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if name != ociLayoutFile && name != ociIndexFile && !sha256Digest.MatchString("sha256:"+strings.TrimPrefix(name, "blobs/sha256/")) {
+			return nil, fmt.Errorf("'%s': unexpected entry '%s'", tarPath, hdr.Name)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		out, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(out, tr)
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract '%s' from '%s': %w", hdr.Name, tarPath, err)
+		}
+	}
+	return OpenOCILayout(dir)
+}
@@ -0,0 +1,162 @@
+// aws-ecr-cleaner/internal/ecr/quarantine.go
+package ecr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// quarantineDateLayout 是隔离 tag 中删除日期的格式
+const quarantineDateLayout = "20060102"
+
+// maxImageTagLength 是 ECR 镜像 tag 的最大长度
+const maxImageTagLength = 128
+
+// QuarantineTag 返回镜像在隔离仓库中的 tag：<删除日期>--<源仓库>--<源 tag>
+// 源仓库名中的 / 编码为 __（ECR 仓库名不允许连续的分隔符，因此不会混淆）；未打标签的镜像以 untagged-<digest 前 12 位> 代替 tag。
+// 超过 ECR tag 长度上限时截断并追加哈希，查找时以同样方式编码后比较
+func QuarantineTag(repositoryName, tag, digest string, date time.Time) string {
+	if tag == "" {
+		tag = "untagged-" + strings.TrimPrefix(digest, "sha256:")[:12]
+	}
+	full := date.UTC().Format(quarantineDateLayout) + "--" + quarantineRepoPrefix(repositoryName) + tag
+	if len(full) <= maxImageTagLength {
+		return full
+	}
+	sum := sha256.Sum256([]byte(repositoryName + ":" + tag))
+	return full[:maxImageTagLength-13] + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// quarantineRepoPrefix 返回源仓库在隔离 tag 中（删除日期之后）的前缀
+func quarantineRepoPrefix(repositoryName string) string {
+	return strings.ReplaceAll(repositoryName, "/", "__") + "--"
+}
+
+// ParseQuarantineDate 解析隔离 tag 中的删除日期，不是隔离 tag 时返回 false
+func ParseQuarantineDate(tag string) (time.Time, bool) {
+	if len(tag) < len(quarantineDateLayout)+2 || tag[len(quarantineDateLayout):len(quarantineDateLayout)+2] != "--" {
+		return time.Time{}, false
+	}
+	date, err := time.Parse(quarantineDateLayout, tag[:len(quarantineDateLayout)])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// MatchQuarantineTag 判断隔离 tag 是否对应源仓库中的 ref（tag 或 digest，按 digest 查找时由调用方比较镜像 digest）
+func MatchQuarantineTag(quarantineTag, repositoryName, ref string) bool {
+	date, ok := ParseQuarantineDate(quarantineTag)
+	if !ok {
+		return false
+	}
+	if strings.HasPrefix(ref, "sha256:") {
+		return strings.HasPrefix(quarantineTag[len(quarantineDateLayout)+2:], quarantineRepoPrefix(repositoryName))
+	}
+	return quarantineTag == QuarantineTag(repositoryName, ref, "", date)
+}
+
+// CopyImage 在同一 registry 内将镜像从 source 仓库复制到 target 仓库：target 中缺失的 config 与 layer 从 source 下载后上传
+// （index 时先复制全部子 manifest），再以原始 manifest 内容按每个 tag PutImage，最后从 target 重新获取 manifest 校验 digest
+// tags 为空时只按 digest 推送
+func CopyImage(svc Registry, source, target, digest string, tags []string) (*RestoreResult, error) {
+	result := &RestoreResult{Digest: digest}
+	if err := copyManifest(svc, source, target, digest, tags, result); err != nil {
+		return result, err
+	}
+	if len(tags) == 0 {
+		tags = []string{""}
+	}
+	for _, tag := range tags {
+		if err := verifyRestored(svc, target, digest, tag); err != nil {
+			return result, fmt.Errorf("copy verification failed: %w", err)
+		}
+	}
+	return result, nil
+}
+
+func copyManifest(svc Registry, source, target, digest string, tags []string, result *RestoreResult) error {
+	m, err := getManifest(svc, source, digest)
+	if err != nil {
+		return err
+	}
+	if m.IsIndex() {
+		for _, child := range m.Manifests {
+			if err := copyManifest(svc, source, target, child.Digest, nil, result); err != nil {
+				return fmt.Errorf("child manifest %s: %w", child.Digest, err)
+			}
+		}
+	} else if err := uploadMissingBlobs(svc, target, distributableBlobs(m), registryBlobs(svc, source), result); err != nil {
+		return err
+	}
+
+	if len(tags) == 0 {
+		tags = []string{""}
+	}
+	existed := true
+	for _, tag := range tags {
+		e, err := putManifest(svc, target, m, tag)
+		if err != nil {
+			return err
+		}
+		existed = existed && e
+	}
+	if existed && digest == result.Digest {
+		result.ManifestExisted = true
+	}
+	return nil
+}
+
+// QuarantineImage 将候选镜像复制到隔离仓库，每个源 tag 对应一个隔离 tag（未打标签时一个），返回写入的隔离 tag
+// 调用方只应在返回 nil 错误后从源仓库删除镜像
+func QuarantineImage(svc Registry, c Candidate, quarantineRepo string, now time.Time) ([]string, error) {
+	var tags []string
+	for _, tag := range c.ImageTags {
+		tags = append(tags, QuarantineTag(c.RepositoryName, tag, c.ImageDigest, now))
+	}
+	if len(tags) == 0 {
+		tags = append(tags, QuarantineTag(c.RepositoryName, "", c.ImageDigest, now))
+	}
+	if _, err := CopyImage(svc, c.RepositoryName, quarantineRepo, c.ImageDigest, tags); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
+
+// ExpiredQuarantineImages 返回隔离仓库中已超过保留期的镜像与保留的镜像：
+// 带隔离 tag 的镜像按最近的删除日期计算；未打标签的镜像（index 的子 manifest）按推送时间计算，是否被保留的 index 引用由调用方判断；
+// 带有无法解析的 tag 的镜像不是由清理程序写入的，一律保留
+func ExpiredQuarantineImages(images []*ecr.ImageDetail, repositoryUri string, retention time.Duration, now time.Time) ([]Candidate, []Retained) {
+	var expired []Candidate
+	var kept []Retained
+	for _, image := range images {
+		tags := aws.StringValueSlice(image.ImageTags)
+		since := aws.TimeValue(image.ImagePushedAt)
+		reason := ""
+		for i, tag := range tags {
+			date, ok := ParseQuarantineDate(tag)
+			if !ok {
+				reason = fmt.Sprintf("tag %s is not a quarantine tag", tag)
+				break
+			}
+			if i == 0 || date.After(since) {
+				since = date
+			}
+		}
+		if reason == "" && now.Before(since.Add(retention)) {
+			reason = "quarantined until " + since.Add(retention).Format("2006-01-02")
+		}
+		if reason != "" {
+			kept = append(kept, Retained{RepositoryName: aws.StringValue(image.RepositoryName), ImageDigest: aws.StringValue(image.ImageDigest), ImageTags: tags, Reason: reason})
+			continue
+		}
+		expired = append(expired, candidateFromImage(image, repositoryUri))
+	}
+	return expired, kept
+}
@@ -0,0 +1,134 @@
+package ecr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func TestQuarantineTag(t *testing.T) {
+	date := time.Date(2026, 10, 17, 23, 30, 0, 0, time.FixedZone("UTC-5", -5*3600))
+	long := strings.Repeat("x", 120)
+
+	tests := []struct {
+		name   string
+		repo   string
+		tag    string
+		digest string
+		want   string
+	}{
+		{name: "tagged", repo: "api", tag: "v1", want: "20261018--api--v1"},
+		{name: "slashes in repository name", repo: "saas/api", tag: "v1", want: "20261018--saas__api--v1"},
+		{name: "untagged", repo: "saas/api", digest: dg("ab"), want: "20261018--saas__api--untagged-abababababab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := QuarantineTag(tt.repo, tt.tag, tt.digest, date); got != tt.want {
+				t.Errorf("QuarantineTag = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("long tags are truncated with a hash", func(t *testing.T) {
+		a := QuarantineTag("saas/api", long+"-a", "", date)
+		b := QuarantineTag("saas/api", long+"-b", "", date)
+		if len(a) != maxImageTagLength || len(b) != maxImageTagLength {
+			t.Errorf("lengths = %d, %d, want %d", len(a), len(b), maxImageTagLength)
+		}
+		if a == b {
+			t.Errorf("distinct tags share quarantine tag %q", a)
+		}
+		if got, ok := ParseQuarantineDate(a); !ok || got.Format(quarantineDateLayout) != "20261018" {
+			t.Errorf("ParseQuarantineDate(%q) = %v, %v", a, got, ok)
+		}
+	})
+}
+
+func TestMatchQuarantineTag(t *testing.T) {
+	date := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	long := strings.Repeat("x", 130)
+
+	tests := []struct {
+		name          string
+		quarantineTag string
+		repo          string
+		ref           string
+		want          bool
+	}{
+		{name: "same tag", quarantineTag: QuarantineTag("saas/api", "v1", "", date), repo: "saas/api", ref: "v1", want: true},
+		{name: "different tag", quarantineTag: QuarantineTag("saas/api", "v1", "", date), repo: "saas/api", ref: "v2"},
+		{name: "tag from another repository", quarantineTag: QuarantineTag("saas/api", "v1", "", date), repo: "saas/web", ref: "v1"},
+		{name: "tag with a repository prefix", quarantineTag: QuarantineTag("saas/api-v2", "v1", "", date), repo: "saas/api", ref: "v1"},
+		{name: "truncated tag", quarantineTag: QuarantineTag("saas/api", long, "", date), repo: "saas/api", ref: long, want: true},
+		{name: "digest matches any image of the repository", quarantineTag: QuarantineTag("saas/api", "", dg("a"), date), repo: "saas/api", ref: dg("b"), want: true},
+		{name: "digest from another repository", quarantineTag: QuarantineTag("saas/api", "", dg("a"), date), repo: "saas/web", ref: dg("a")},
+		{name: "not a quarantine tag", quarantineTag: "saas__api--v1", repo: "saas/api", ref: "v1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchQuarantineTag(tt.quarantineTag, tt.repo, tt.ref); got != tt.want {
+				t.Errorf("MatchQuarantineTag(%q, %q, %q) = %v, want %v", tt.quarantineTag, tt.repo, tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiredQuarantineImages(t *testing.T) {
+	daysAgo := func(n int) time.Time { return testNow.Add(-time.Duration(n) * day) }
+	images := []*ecr.ImageDetail{
+		image(dg("a"), 40*day, QuarantineTag("saas/api", "v1", "", daysAgo(40))),                                                  // 已过保留期
+		image(dg("b"), 40*day, QuarantineTag("saas/api", "v2", "", daysAgo(40)), QuarantineTag("saas/web", "v2", "", daysAgo(5))), // 最近一次删除日期在保留期内
+		image(dg("c"), 40*day),           // 未打标签，按推送时间
+		image(dg("d"), 5*day),            // 未打标签，推送不久
+		image(dg("e"), 40*day, "manual"), // 不是清理程序写入的
+	}
+
+	expired, kept := ExpiredQuarantineImages(images, testRepoUri, 30*day, testNow)
+	if got, want := candidateDigests(expired), sorted(dg("a"), dg("c")); !reflect.DeepEqual(got, want) {
+		t.Errorf("expired = %v, want %v", got, want)
+	}
+	reasons := make(map[string]string)
+	for _, r := range kept {
+		reasons[r.ImageDigest] = r.Reason
+	}
+	want := map[string]string{
+		dg("b"): "quarantined until 2026-11-11",
+		dg("d"): "quarantined until 2026-11-11",
+		dg("e"): "tag manual is not a quarantine tag",
+	}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("kept = %v, want %v", reasons, want)
+	}
+}
+
+func TestQuarantineImage(t *testing.T) {
+	fixture, indexDigest, childDigest := multiArchFixture()
+	fixture.Repositories = append(fixture.Repositories, FixtureRepository{RepositoryName: "quarantine"})
+	svc := NewMemoryRegistry(fixture, "us-east-1")
+
+	tags, err := QuarantineImage(svc, candidate(indexDigest, day, "v1"), "quarantine", testNow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"20261017--saas__api--v1"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("quarantine tags = %v, want %v", tags, want)
+	}
+	out, err := svc.BatchGetImage(&ecr.BatchGetImageInput{
+		RepositoryName: aws.String("quarantine"),
+		ImageIds:       []*ecr.ImageIdentifier{{ImageTag: aws.String(tags[0])}, {ImageDigest: aws.String(childDigest)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Images) != 2 || aws.StringValue(out.Images[0].ImageId.ImageDigest) != indexDigest {
+		t.Errorf("quarantine repository is missing the index or its child: images %v, failures %v", out.Images, out.Failures)
+	}
+
+	if _, err := QuarantineImage(svc, candidate(indexDigest, day, "v1"), "missing", testNow); err == nil {
+		t.Error("copy into a missing repository succeeded")
+	}
+}
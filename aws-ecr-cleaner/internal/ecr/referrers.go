@@ -0,0 +1,176 @@
+// aws-ecr-cleaner/internal/ecr/referrers.go
+package ecr
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// cosignTagPattern 匹配 cosign 以 tag 形式存放的签名、证明与 SBOM：sha256-<hex>.sig / .att / .sbom
+var cosignTagPattern = regexp.MustCompile(`^(sha256)-([0-9a-f]{64})\.(sig|att|sbom)$`)
+
+// imageConfigMediaTypes 是普通容器镜像的 config media type，其余 artifactMediaType 视为可能的 OCI 制品
+var imageConfigMediaTypes = map[string]bool{
+	"application/vnd.docker.container.image.v1+json": true,
+	"application/vnd.oci.image.config.v1+json":       true,
+}
+
+// Referrer 描述依附于某个 subject 镜像的制品（签名、证明、SBOM 等）
+type Referrer struct {
+	Digest  string
+	Tags    []string
+	Subject string // subject 镜像的 digest
+	Kind    string // sig / att / sbom，或 OCI 制品的 artifactType
+}
+
+// ArtifactDigests 返回可能是 OCI 制品的镜像 digest（artifactMediaType 不是普通镜像 config），用于按需获取 manifest
+func ArtifactDigests(images []*ecr.ImageDetail) []string {
+	var digests []string
+	for _, image := range images {
+		mt := aws.StringValue(image.ArtifactMediaType)
+		if mt != "" && !imageConfigMediaTypes[mt] {
+			digests = append(digests, aws.StringValue(image.ImageDigest))
+		}
+	}
+	return digests
+}
+
+// FindReferrers 识别仓库内的制品及其 subject：cosign 的 tag 约定与 OCI manifest 的 subject 字段
+func FindReferrers(images []*ecr.ImageDetail, manifests map[string]*Manifest) []Referrer {
+	var referrers []Referrer
+	for _, image := range images {
+		digest := aws.StringValue(image.ImageDigest)
+		var tags []string
+		for _, t := range image.ImageTags {
+			tags = append(tags, aws.StringValue(t))
+		}
+
+		ref := Referrer{Digest: digest, Tags: tags}
+		if m, ok := manifests[digest]; ok && m.Subject != nil {
+			ref.Subject = m.Subject.Digest
+			ref.Kind = m.ArtifactType
+			if ref.Kind == "" && m.Config != nil {
+				ref.Kind = m.Config.MediaType
+			}
+		} else {
+			for _, tag := range tags {
+				if match := cosignTagPattern.FindStringSubmatch(tag); match != nil {
+					ref.Subject = match[1] + ":" + match[2]
+					ref.Kind = match[3]
+					break
+				}
+			}
+		}
+		if ref.Subject != "" {
+			referrers = append(referrers, ref)
+		}
+	}
+	return referrers
+}
+
+// ApplyReferrers 让制品与其 subject 同生共死
+// subject 保留时制品从候选中移除；subject 被删除时制品加入候选；subject 已不存在的制品作为孤儿报告并加入候选
+// 制品本身也可能是其它制品的 subject（如签名的证明），因此反复传播直到结果稳定
+func ApplyReferrers(images []*ecr.ImageDetail, candidates []Candidate, referrers []Referrer, repositoryUri, mode string) ([]Candidate, []Retained, []Referrer) {
+	present := make(map[string]*ecr.ImageDetail, len(images))
+	for _, image := range images {
+		present[aws.StringValue(image.ImageDigest)] = image
+	}
+	byDigest := make(map[string]Candidate, len(candidates))
+	for _, c := range candidates {
+		byDigest[c.ImageDigest] = c
+	}
+	removes := func(digest string) bool {
+		c, ok := byDigest[digest]
+		return ok && c.RemovesManifest(mode)
+	}
+
+	retainedReason := make(map[string]string)
+	var orphans []Referrer
+	for _, ref := range referrers {
+		if _, ok := present[ref.Subject]; !ok {
+			orphans = append(orphans, ref)
+		}
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, ref := range referrers {
+			_, subjectPresent := present[ref.Subject]
+			wantRemove := !subjectPresent || removes(ref.Subject)
+			if wantRemove {
+				if removes(ref.Digest) {
+					continue
+				}
+				byDigest[ref.Digest] = candidateFromImage(present[ref.Digest], repositoryUri)
+				delete(retainedReason, ref.Digest)
+			} else {
+				// subject 保留时制品的 tag 也不能移除，否则 cosign 无法再按 tag 找到签名
+				if _, listed := byDigest[ref.Digest]; !listed {
+					continue
+				}
+				delete(byDigest, ref.Digest)
+				retainedReason[ref.Digest] = "referrer (" + ref.Kind + ") of retained subject " + ref.Subject
+			}
+			changed = true
+		}
+	}
+
+	// 保持原候选顺序，新增的制品候选按 digest 排序追加在后
+	var result []Candidate
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if nc, ok := byDigest[c.ImageDigest]; ok {
+			result = append(result, nc)
+			seen[c.ImageDigest] = true
+		}
+	}
+	var added []string
+	for digest := range byDigest {
+		if !seen[digest] {
+			added = append(added, digest)
+		}
+	}
+	sort.Strings(added)
+	for _, digest := range added {
+		result = append(result, byDigest[digest])
+	}
+
+	var retained []Retained
+	for _, c := range candidates {
+		if reason, ok := retainedReason[c.ImageDigest]; ok {
+			retained = append(retained, Retained{
+				RepositoryName: c.RepositoryName,
+				ImageDigest:    c.ImageDigest,
+				ImageTags:      c.ImageTags,
+				Reason:         reason,
+			})
+		}
+	}
+	return result, retained, orphans
+}
+
+// candidateFromImage 为跟随 subject 删除的制品构造候选，全部 tag 均视为过期
+func candidateFromImage(image *ecr.ImageDetail, repositoryUri string) Candidate {
+	var tags []string
+	for _, t := range image.ImageTags {
+		tags = append(tags, aws.StringValue(t))
+	}
+	c := Candidate{
+		RepositoryName: aws.StringValue(image.RepositoryName),
+		RepositoryUri:  repositoryUri,
+		ImageDigest:    aws.StringValue(image.ImageDigest),
+		ImageTags:      tags,
+		StaleTags:      tags,
+		IsIndex:        IsIndexMediaType(aws.StringValue(image.ImageManifestMediaType)),
+	}
+	if image.ImagePushedAt != nil {
+		c.PushTime = *image.ImagePushedAt
+	}
+	c.PullTime = aws.TimeValue(image.LastRecordedPullTime)
+	c.Size = aws.Int64Value(image.ImageSizeInBytes)
+	return c
+}
@@ -0,0 +1,100 @@
+package ecr
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// cosignTag 返回 subject 的 cosign 签名等制品 tag；cosign 约定要求 digest 为十六进制，用例中的 digest 因此取数字
+func cosignTag(subject, kind string) string {
+	return strings.Replace(subject, ":", "-", 1) + "." + kind
+}
+
+func TestFindReferrers(t *testing.T) {
+	images := []*ecr.ImageDetail{
+		image(dg("5"), day, "v1"),
+		image(dg("6"), day, cosignTag(dg("5"), "sig")),
+		image(dg("7"), day),
+	}
+	manifests := map[string]*Manifest{
+		dg("7"): {ArtifactType: "application/spdx+json", Subject: &Descriptor{Digest: dg("6")}},
+	}
+	want := []Referrer{
+		{Digest: dg("6"), Tags: []string{cosignTag(dg("5"), "sig")}, Subject: dg("5"), Kind: "sig"},
+		{Digest: dg("7"), Subject: dg("6"), Kind: "application/spdx+json"},
+	}
+	if got := FindReferrers(images, manifests); !reflect.DeepEqual(got, want) {
+		t.Errorf("referrers = %+v, want %+v", got, want)
+	}
+}
+
+func TestApplyReferrers(t *testing.T) {
+	// 5 ← 6（签名）← 7（签名的证明）；8 的 subject 9 已不存在
+	images := []*ecr.ImageDetail{
+		image(dg("5"), day, "v1"),
+		image(dg("6"), day, cosignTag(dg("5"), "sig")),
+		image(dg("7"), day),
+		image(dg("8"), day, cosignTag(dg("9"), "att")),
+	}
+	referrers := []Referrer{
+		{Digest: dg("6"), Tags: []string{cosignTag(dg("5"), "sig")}, Subject: dg("5"), Kind: "sig"},
+		{Digest: dg("7"), Subject: dg("6"), Kind: "att"},
+		{Digest: dg("8"), Tags: []string{cosignTag(dg("9"), "att")}, Subject: dg("9"), Kind: "att"},
+	}
+
+	tests := []struct {
+		name         string
+		candidates   []Candidate
+		mode         string
+		wantCands    []string
+		wantRetained []string
+	}{
+		{
+			name:         "referrers of a retained subject are retained",
+			candidates:   []Candidate{candidate(dg("6"), day, cosignTag(dg("5"), "sig")), candidate(dg("7"), day)},
+			mode:         DeleteModeDigest,
+			wantCands:    []string{dg("8")},
+			wantRetained: sorted(dg("6"), dg("7")),
+		},
+		{
+			name:         "referrers follow a deleted subject transitively",
+			candidates:   []Candidate{candidate(dg("5"), day, "v1")},
+			mode:         DeleteModeDigest,
+			wantCands:    sorted(dg("5"), dg("6"), dg("7"), dg("8")),
+			wantRetained: []string{},
+		},
+		{
+			name: "untagging a subject keeps its referrers",
+			candidates: []Candidate{
+				{RepositoryName: testRepo, ImageDigest: dg("5"), ImageTags: []string{"v1", "release-1"}, StaleTags: []string{"v1"}},
+				candidate(dg("6"), day, cosignTag(dg("5"), "sig")),
+			},
+			mode:         DeleteModeUntag,
+			wantCands:    sorted(dg("5"), dg("8")),
+			wantRetained: []string{dg("6")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cands, retained, orphans := ApplyReferrers(images, tt.candidates, referrers, testRepoUri, tt.mode)
+			if got := candidateDigests(cands); !reflect.DeepEqual(got, tt.wantCands) {
+				t.Errorf("candidates = %v, want %v", got, tt.wantCands)
+			}
+			if got := retainedDigests(retained); !reflect.DeepEqual(got, tt.wantRetained) {
+				t.Errorf("retained = %v, want %v", got, tt.wantRetained)
+			}
+			var orphanDigests []string
+			for _, o := range orphans {
+				orphanDigests = append(orphanDigests, o.Digest)
+			}
+			sort.Strings(orphanDigests)
+			if want := []string{dg("8")}; !reflect.DeepEqual(orphanDigests, want) {
+				t.Errorf("orphans = %v, want %v", orphanDigests, want)
+			}
+		})
+	}
+}
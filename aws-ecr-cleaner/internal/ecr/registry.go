@@ -0,0 +1,36 @@
+// aws-ecr-cleaner/internal/ecr/registry.go
+package ecr
+
+import (
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// Registry 是清理流程依赖的最小 ECR 接口
+// 方法签名与 AWS SDK 保持一致，*ecr.ECR 可直接满足该接口，MemoryRegistry 则用于本地与 CI 中脱离 AWS 运行
+type Registry interface {
+	DescribeRepositoriesPages(input *ecr.DescribeRepositoriesInput, fn func(*ecr.DescribeRepositoriesOutput, bool) bool) error
+	DescribeImagesPages(input *ecr.DescribeImagesInput, fn func(*ecr.DescribeImagesOutput, bool) bool) error
+	BatchGetImage(input *ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error)
+	BatchDeleteImage(input *ecr.BatchDeleteImageInput) (*ecr.BatchDeleteImageOutput, error)
+	DeleteRepository(input *ecr.DeleteRepositoryInput) (*ecr.DeleteRepositoryOutput, error)
+	StartLifecyclePolicyPreview(input *ecr.StartLifecyclePolicyPreviewInput) (*ecr.StartLifecyclePolicyPreviewOutput, error)
+	GetLifecyclePolicyPreview(input *ecr.GetLifecyclePolicyPreviewInput) (*ecr.GetLifecyclePolicyPreviewOutput, error)
+	PutLifecyclePolicy(input *ecr.PutLifecyclePolicyInput) (*ecr.PutLifecyclePolicyOutput, error)
+	GetLifecyclePolicy(input *ecr.GetLifecyclePolicyInput) (*ecr.GetLifecyclePolicyOutput, error)
+	ListTagsForResource(input *ecr.ListTagsForResourceInput) (*ecr.ListTagsForResourceOutput, error)
+	GetRepositoryPolicy(input *ecr.GetRepositoryPolicyInput) (*ecr.GetRepositoryPolicyOutput, error)
+	GetDownloadUrlForLayer(input *ecr.GetDownloadUrlForLayerInput) (*ecr.GetDownloadUrlForLayerOutput, error)
+	CreateRepository(input *ecr.CreateRepositoryInput) (*ecr.CreateRepositoryOutput, error)
+	SetRepositoryPolicy(input *ecr.SetRepositoryPolicyInput) (*ecr.SetRepositoryPolicyOutput, error)
+	BatchCheckLayerAvailability(input *ecr.BatchCheckLayerAvailabilityInput) (*ecr.BatchCheckLayerAvailabilityOutput, error)
+	InitiateLayerUpload(input *ecr.InitiateLayerUploadInput) (*ecr.InitiateLayerUploadOutput, error)
+	UploadLayerPart(input *ecr.UploadLayerPartInput) (*ecr.UploadLayerPartOutput, error)
+	CompleteLayerUpload(input *ecr.CompleteLayerUploadInput) (*ecr.CompleteLayerUploadOutput, error)
+	PutImage(input *ecr.PutImageInput) (*ecr.PutImageOutput, error)
+}
+
+// 编译期校验 SDK 客户端与内存实现均满足 Registry
+var (
+	_ Registry = (*ecr.ECR)(nil)
+	_ Registry = (*MemoryRegistry)(nil)
+)
@@ -0,0 +1,259 @@
+// aws-ecr-cleaner/internal/ecr/restore.go
+package ecr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// defaultLayerPartSize 是 InitiateLayerUpload 未返回 PartSize 时使用的分片大小
+const defaultLayerPartSize = 10 << 20
+
+// maxLayerCheckDigests 是 BatchCheckLayerAvailability 单次请求允许的最大 digest 数量
+const maxLayerCheckDigests = 100
+
+// RestoreResult 记录一次恢复（或复制）上传的内容
+type RestoreResult struct {
+	Digest          string
+	UploadedBlobs   int   // 本次上传的 config 与 layer 数量
+	UploadedBytes   int64 // 本次上传的字节数
+	ExistingBlobs   int   // 仓库中已存在、无需上传的 blob 数量
+	ManifestExisted bool  // manifest 已在仓库中（只补打 tag 或无需操作）
+}
+
+// blobSource 打开待上传的 blob：归档 layout 或同一 registry 中的另一个仓库
+type blobSource func(b Descriptor) (io.ReadCloser, error)
+
+// layoutBlobs 从归档 layout 读取 blob，读取前按描述符校验
+func layoutBlobs(layout *OCILayout) blobSource {
+	return func(b Descriptor) (io.ReadCloser, error) {
+		if err := layout.VerifyBlob(b); err != nil {
+			return nil, err
+		}
+		return layout.OpenBlob(b.Digest)
+	}
+}
+
+// registryBlobs 通过 GetDownloadUrlForLayer 从仓库下载 blob
+func registryBlobs(svc Registry, repositoryName string) blobSource {
+	return func(b Descriptor) (io.ReadCloser, error) {
+		return DownloadLayer(svc, repositoryName, b.Digest)
+	}
+}
+
+// RestoreImage 将 layout 中 desc 指向的镜像重新推送到仓库：上传仓库中缺失的 config 与 layer（index 时先恢复全部子 manifest），
+// 再以归档的原始 manifest 内容 PutImage，最后重新获取 manifest 校验 digest 与原镜像一致；tag 为空时只按 digest 推送
+func RestoreImage(svc Registry, layout *OCILayout, repositoryName string, desc Descriptor, tag string) (*RestoreResult, error) {
+	result := &RestoreResult{Digest: desc.Digest}
+	if err := restoreManifest(svc, layout, repositoryName, desc, tag, result); err != nil {
+		return result, err
+	}
+	if err := verifyRestored(svc, repositoryName, desc.Digest, tag); err != nil {
+		return result, fmt.Errorf("restore verification failed: %w", err)
+	}
+	return result, nil
+}
+
+func restoreManifest(svc Registry, layout *OCILayout, repositoryName string, desc Descriptor, tag string, result *RestoreResult) error {
+	raw, err := layout.ReadBlob(desc.Digest)
+	if err != nil {
+		return fmt.Errorf("manifest %s missing from archive: %w", desc.Digest, err)
+	}
+	sum := sha256.Sum256(raw)
+	if got := "sha256:" + hex.EncodeToString(sum[:]); got != desc.Digest {
+		return fmt.Errorf("archived manifest %s is corrupt: got %s", desc.Digest, got)
+	}
+	m, err := ParseManifest(desc.Digest, string(raw), desc.MediaType)
+	if err != nil {
+		return err
+	}
+
+	if m.IsIndex() {
+		for _, child := range m.Manifests {
+			if err := restoreManifest(svc, layout, repositoryName, child, "", result); err != nil {
+				return fmt.Errorf("child manifest %s: %w", child.Digest, err)
+			}
+		}
+	} else if err := uploadMissingBlobs(svc, repositoryName, distributableBlobs(m), layoutBlobs(layout), result); err != nil {
+		return err
+	}
+
+	existed, err := putManifest(svc, repositoryName, m, tag)
+	if err != nil {
+		return err
+	}
+	if existed && desc.Digest == result.Digest {
+		result.ManifestExisted = true
+	}
+	return nil
+}
+
+// distributableBlobs 返回镜像 manifest 引用的 config 与 layer；外部（non-distributable）layer 不在 ECR 中保存，不参与上传
+func distributableBlobs(m *Manifest) []Descriptor {
+	var blobs []Descriptor
+	if m.Config != nil {
+		blobs = append(blobs, *m.Config)
+	}
+	for _, l := range m.Layers {
+		if strings.Contains(l.MediaType, "nondistributable") || strings.Contains(l.MediaType, "foreign") {
+			continue
+		}
+		blobs = append(blobs, l)
+	}
+	return blobs
+}
+
+// putManifest 以 manifest 的原始内容 PutImage，tag 为空时只按 digest 推送；manifest 与 tag 已存在时返回 existed 为 true
+func putManifest(svc Registry, repositoryName string, m *Manifest, tag string) (bool, error) {
+	input := &ecr.PutImageInput{
+		RepositoryName:         aws.String(repositoryName),
+		ImageManifest:          aws.String(m.Raw),
+		ImageManifestMediaType: aws.String(m.MediaType),
+		ImageDigest:            aws.String(m.Digest),
+	}
+	if tag != "" {
+		input.ImageTag = aws.String(tag)
+	}
+	out, err := svc.PutImage(input)
+	if isErrorCode(err, ecr.ErrCodeImageAlreadyExistsException) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if got := aws.StringValue(out.Image.ImageId.ImageDigest); got != m.Digest {
+		return false, fmt.Errorf("PutImage returned digest %s, expected %s", got, m.Digest)
+	}
+	return false, nil
+}
+
+// uploadMissingBlobs 检查 blob 在仓库中是否可用，只从 open 读取并上传缺失的部分
+func uploadMissingBlobs(svc Registry, repositoryName string, blobs []Descriptor, open blobSource, result *RestoreResult) error {
+	available := make(map[string]bool)
+	for start := 0; start < len(blobs); start += maxLayerCheckDigests {
+		end := start + maxLayerCheckDigests
+		if end > len(blobs) {
+			end = len(blobs)
+		}
+		var digests []*string
+		for _, b := range blobs[start:end] {
+			digests = append(digests, aws.String(b.Digest))
+		}
+		out, err := svc.BatchCheckLayerAvailability(&ecr.BatchCheckLayerAvailabilityInput{
+			RepositoryName: aws.String(repositoryName),
+			LayerDigests:   digests,
+		})
+		if err != nil {
+			return err
+		}
+		for _, l := range out.Layers {
+			if aws.StringValue(l.LayerAvailability) == ecr.LayerAvailabilityAvailable {
+				available[aws.StringValue(l.LayerDigest)] = true
+			}
+		}
+	}
+
+	for _, b := range blobs {
+		if available[b.Digest] {
+			result.ExistingBlobs++
+			continue
+		}
+		if err := uploadBlob(svc, repositoryName, b, open); err != nil {
+			return err
+		}
+		available[b.Digest] = true
+		result.UploadedBlobs++
+		result.UploadedBytes += b.Size
+	}
+	return nil
+}
+
+// uploadBlob 通过 InitiateLayerUpload / UploadLayerPart / CompleteLayerUpload 分片上传单个 blob，ECR 在完成上传时校验 digest
+func uploadBlob(svc Registry, repositoryName string, b Descriptor, open blobSource) error {
+	f, err := open(b)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	initOut, err := svc.InitiateLayerUpload(&ecr.InitiateLayerUploadInput{RepositoryName: aws.String(repositoryName)})
+	if err != nil {
+		return err
+	}
+	partSize := aws.Int64Value(initOut.PartSize)
+	if partSize <= 0 {
+		partSize = defaultLayerPartSize
+	}
+	buf := make([]byte, partSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			_, uerr := svc.UploadLayerPart(&ecr.UploadLayerPartInput{
+				RepositoryName: aws.String(repositoryName),
+				UploadId:       initOut.UploadId,
+				PartFirstByte:  aws.Int64(offset),
+				PartLastByte:   aws.Int64(offset + int64(n) - 1),
+				LayerPartBlob:  buf[:n],
+			})
+			if uerr != nil {
+				return fmt.Errorf("failed to upload blob %s: %w", b.Digest, uerr)
+			}
+			offset += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	out, err := svc.CompleteLayerUpload(&ecr.CompleteLayerUploadInput{
+		RepositoryName: aws.String(repositoryName),
+		UploadId:       initOut.UploadId,
+		LayerDigests:   []*string{aws.String(b.Digest)},
+	})
+	// 并发推送等情况下 blob 可能已由其它上传写入
+	if isErrorCode(err, ecr.ErrCodeLayerAlreadyExistsException) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to complete upload of blob %s: %w", b.Digest, err)
+	}
+	if got := aws.StringValue(out.LayerDigest); got != b.Digest {
+		return fmt.Errorf("uploaded blob digest %s does not match %s", got, b.Digest)
+	}
+	return nil
+}
+
+// verifyRestored 从仓库重新获取 manifest，校验其内容的 digest 与原镜像一致，指定 tag 时校验 tag 指向该 digest
+func verifyRestored(svc Registry, repositoryName, digest, tag string) error {
+	if _, err := getManifest(svc, repositoryName, digest); err != nil {
+		return err
+	}
+	if tag == "" {
+		return nil
+	}
+	out, err := svc.BatchGetImage(&ecr.BatchGetImageInput{
+		RepositoryName:     aws.String(repositoryName),
+		ImageIds:           []*ecr.ImageIdentifier{{ImageTag: aws.String(tag)}},
+		AcceptedMediaTypes: acceptedManifestTypes,
+	})
+	if err != nil {
+		return err
+	}
+	if len(out.Images) == 0 {
+		return fmt.Errorf("tag %s not found after restore", tag)
+	}
+	if got := aws.StringValue(out.Images[0].ImageId.ImageDigest); got != digest {
+		return fmt.Errorf("tag %s points to %s, expected %s", tag, got, digest)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package ecr
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// emptyRegistry 返回只有一个空仓库、不含任何 blob 的内存仓库，恢复时全部内容都需重新上传
+func emptyRegistry() *MemoryRegistry {
+	return NewMemoryRegistry(Fixture{AccountID: "123456789012", Repositories: []FixtureRepository{{RepositoryName: testRepo}}}, "us-east-1")
+}
+
+// assertRestored 校验仓库中 tag 指向 digest，且 manifest 内容与源一致
+func assertRestored(t *testing.T, svc Registry, tag, digest string, want json.RawMessage) {
+	t.Helper()
+	out, err := svc.BatchGetImage(&ecr.BatchGetImageInput{
+		RepositoryName: aws.String(testRepo),
+		ImageIds:       []*ecr.ImageIdentifier{{ImageTag: aws.String(tag)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(out.Images) != 1 {
+		t.Fatalf("tag %s not restored: %v", tag, out.Failures)
+	}
+	if got := aws.StringValue(out.Images[0].ImageId.ImageDigest); got != digest {
+		t.Errorf("tag %s points to %s, want %s", tag, got, digest)
+	}
+	if got := aws.StringValue(out.Images[0].ImageManifest); got != string(want) {
+		t.Errorf("restored manifest differs:\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRestoreImage(t *testing.T) {
+	fixture, indexDigest, _ := multiArchFixture()
+	source := NewMemoryRegistry(fixture, "us-east-1")
+	layout, err := OpenOCILayout(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ArchiveImage(source, layout, candidate(indexDigest, day, "v1"), testNow); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := layout.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, ok := idx.Find(testRepo, "v1")
+	if !ok {
+		t.Fatalf("v1 not found in archive index: %+v", idx.Manifests)
+	}
+
+	target := emptyRegistry()
+	result, err := RestoreImage(target, layout, testRepo, desc, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UploadedBlobs != len(fixture.Blobs) || result.ExistingBlobs != 0 || result.ManifestExisted {
+		t.Errorf("restore result = %+v, want %d uploaded blobs into an empty repository", result, len(fixture.Blobs))
+	}
+	assertRestored(t, target, "v1", indexDigest, fixture.Repositories[0].Manifests[indexDigest])
+
+	// 再次恢复时内容已存在，只需确认 manifest
+	again, err := RestoreImage(target, layout, testRepo, desc, "v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.UploadedBlobs != 0 || !again.ManifestExisted {
+		t.Errorf("second restore = %+v, want nothing uploaded", again)
+	}
+}
+
+func TestRestoreImageFromTarball(t *testing.T) {
+	fixture, indexDigest, _ := multiArchFixture()
+	source := NewMemoryRegistry(fixture, "us-east-1")
+	dir := t.TempDir()
+	layout, err := OpenOCILayout(filepath.Join(dir, "layout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ArchiveImage(source, layout, candidate(indexDigest, day, "v1"), testNow); err != nil {
+		t.Fatal(err)
+	}
+
+	tarPath := filepath.Join(dir, "archive.tar")
+	if err := PackOCILayout(layout.Root, tarPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyOCITarball(tarPath); err != nil {
+		t.Fatalf("packed archive does not verify: %v", err)
+	}
+	extracted, err := ExtractOCITarball(tarPath, filepath.Join(dir, "extracted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := extracted.ReadIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc, ok := idx.Find(testRepo, "v1")
+	if !ok {
+		t.Fatalf("v1 not found in extracted archive index: %+v", idx.Manifests)
+	}
+
+	target := emptyRegistry()
+	if _, err := RestoreImage(target, extracted, testRepo, desc, "v1"); err != nil {
+		t.Fatal(err)
+	}
+	assertRestored(t, target, "v1", indexDigest, fixture.Repositories[0].Manifests[indexDigest])
+}
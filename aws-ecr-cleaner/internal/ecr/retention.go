@@ -0,0 +1,221 @@
+// aws-ecr-cleaner/internal/ecr/retention.go
+package ecr
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"aws-ecr-cleaner/internal/util"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// timeLayout 是扫描输出与保留原因中使用的时间格式
+const timeLayout = "2006-01-02T15:04:05Z"
+
+// FormatPullTime 格式化拉取时间，从未记录拉取时返回 never
+func FormatPullTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(timeLayout)
+}
+
+// LastActivity 返回镜像最近一次活动时间：拉取时间，从未记录拉取时为推送时间
+func (c Candidate) LastActivity() time.Time {
+	if c.PullTime.After(c.PushTime) {
+		return c.PullTime
+	}
+	return c.PushTime
+}
+
+// ApplyPullTimeRules 根据 LastRecordedPullTime 从候选中移除仍在被使用的镜像
+// protectPulledWithin > 0 时，最近 protectPulledWithin 内被拉取过的镜像一律保留；
+// idleAfter > 0 时，只删除最近活动（拉取时间，从未拉取时为推送时间）早于 idleAfter 的镜像，
+// 这样 Kubernetes 之外的系统仍在拉取的旧镜像也会被保留
+func ApplyPullTimeRules(candidates []Candidate, protectPulledWithin, idleAfter time.Duration, now time.Time) ([]Candidate, []Retained) {
+	if protectPulledWithin <= 0 && idleAfter <= 0 {
+		return candidates, nil
+	}
+
+	var kept []Candidate
+	var retained []Retained
+	for _, c := range candidates {
+		var reason string
+		switch {
+		case protectPulledWithin > 0 && !c.PullTime.IsZero() && now.Sub(c.PullTime) < protectPulledWithin:
+			reason = fmt.Sprintf("pulled within last %s (last pull %s)", formatDays(protectPulledWithin), FormatPullTime(c.PullTime))
+		case idleAfter > 0 && now.Sub(c.LastActivity()) < idleAfter:
+			reason = fmt.Sprintf("not idle for %s yet (last activity %s)", formatDays(idleAfter), c.LastActivity().Format(timeLayout))
+		}
+		if reason == "" {
+			kept = append(kept, c)
+			continue
+		}
+		retained = append(retained, Retained{
+			RepositoryName: c.RepositoryName,
+			ImageDigest:    c.ImageDigest,
+			ImageTags:      c.ImageTags,
+			Reason:         reason,
+		})
+	}
+	return kept, retained
+}
+
+// ApplyMinAge 保留推送时间距今不足 minAge 的候选镜像，minAge <= 0 时不启用
+func ApplyMinAge(candidates []Candidate, minAge time.Duration, now time.Time) ([]Candidate, []Retained) {
+	if minAge <= 0 {
+		return candidates, nil
+	}
+	var kept []Candidate
+	var retained []Retained
+	for _, c := range candidates {
+		if now.Sub(c.PushTime) >= minAge {
+			kept = append(kept, c)
+			continue
+		}
+		retained = append(retained, Retained{
+			RepositoryName: c.RepositoryName,
+			ImageDigest:    c.ImageDigest,
+			ImageTags:      c.ImageTags,
+			Reason:         fmt.Sprintf("younger than minimum age %s (pushed %s)", formatDays(minAge), c.PushTime.Format(timeLayout)),
+		})
+	}
+	return kept, retained
+}
+
+// ApplyMaxAge 将推送时间距今超过 maxAge 的带 tag 镜像加入候选，即使 HOLD_TAG_REGEX、PROTECT_LATEST 或拉取时间规则保留了它们；
+// protectInUse 时正在被 Kubernetes 使用的镜像仍然保留。加入的候选移除全部 tag（untag 模式下同样删除整个镜像）
+// 返回加入后的候选与新加入的候选，maxAge <= 0 时不启用
+func ApplyMaxAge(images []*ecr.ImageDetail, candidates []Candidate, maxAge time.Duration, inUse map[string]bool, repositoryUri string, protectInUse bool, now time.Time) ([]Candidate, []Candidate) {
+	if maxAge <= 0 {
+		return candidates, nil
+	}
+	selected := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		selected[c.ImageDigest] = true
+	}
+	trimmedRepoUri := util.TrimRegistry(repositoryUri)
+	var expired []Candidate
+	for _, image := range images {
+		if len(image.ImageTags) == 0 || selected[aws.StringValue(image.ImageDigest)] || now.Sub(aws.TimeValue(image.ImagePushedAt)) < maxAge {
+			continue
+		}
+		used := false
+		for _, tag := range aws.StringValueSlice(image.ImageTags) {
+			if protectInUse && inUse[fmt.Sprintf("%s:%s", trimmedRepoUri, tag)] {
+				used = true
+				break
+			}
+		}
+		if used {
+			continue
+		}
+		expired = append(expired, candidateFromImage(image, repositoryUri))
+	}
+	return append(candidates, expired...), expired
+}
+
+// MaxAgeReason 返回镜像因超过最大年龄成为候选的原因
+func MaxAgeReason(c Candidate, maxAge time.Duration) string {
+	return fmt.Sprintf("older than maximum age %s (pushed %s)", formatDays(maxAge), c.PushTime.Format(timeLayout))
+}
+
+// ApplyKeepLatestUntagged 保留推送时间最新的 n 个未打标签镜像，n <= 0 时不启用
+// index 的子 manifest 与签名等制品跟随其 index 或 subject（graph 可以为 nil），不占名额
+func ApplyKeepLatestUntagged(images []*ecr.ImageDetail, candidates []Candidate, n int, graph *ManifestGraph, referrers []Referrer) ([]Candidate, []Retained) {
+	if n <= 0 {
+		return candidates, nil
+	}
+	dependent := make(map[string]bool)
+	if graph != nil {
+		for _, children := range graph.Children {
+			for _, child := range children {
+				dependent[child.Digest] = true
+			}
+		}
+	}
+	for _, ref := range referrers {
+		dependent[ref.Digest] = true
+	}
+	var untagged []*ecr.ImageDetail
+	for _, image := range images {
+		if len(image.ImageTags) == 0 && !dependent[aws.StringValue(image.ImageDigest)] {
+			untagged = append(untagged, image)
+		}
+	}
+	sort.SliceStable(untagged, func(i, j int) bool {
+		return aws.TimeValue(untagged[i].ImagePushedAt).After(aws.TimeValue(untagged[j].ImagePushedAt))
+	})
+	newest := make(map[string]int, n)
+	for i, image := range untagged {
+		if i == n {
+			break
+		}
+		newest[aws.StringValue(image.ImageDigest)] = i + 1
+	}
+
+	var kept []Candidate
+	var retained []Retained
+	for _, c := range candidates {
+		rank, ok := newest[c.ImageDigest]
+		if !ok {
+			kept = append(kept, c)
+			continue
+		}
+		retained = append(retained, Retained{
+			RepositoryName: c.RepositoryName,
+			ImageDigest:    c.ImageDigest,
+			ImageTags:      c.ImageTags,
+			Reason:         fmt.Sprintf("newest untagged image %d of %d (KEEP_LATEST_UNTAGGED)", rank, n),
+		})
+	}
+	return kept, retained
+}
+
+// ApplyHoldTagRegex 用追加的保留正则（例如仓库 tag 中的 hold 规则）再次过滤候选，与 FilterImagesForDeletion 的语义一致：
+// 合并后的 tag 命中时保留整个镜像；否则单独命中的 tag 不再视为过期 tag，untag 模式下不会被移除
+func ApplyHoldTagRegex(candidates []Candidate, holdTagRegex, source string) ([]Candidate, []Retained) {
+	if holdTagRegex == "" {
+		return candidates, nil
+	}
+	var kept []Candidate
+	var retained []Retained
+	for _, c := range candidates {
+		if len(c.ImageTags) == 0 {
+			kept = append(kept, c)
+			continue
+		}
+		if util.HoldTagMatch(fmt.Sprintf("%s", c.ImageTags), holdTagRegex) {
+			retained = append(retained, Retained{
+				RepositoryName: c.RepositoryName,
+				ImageDigest:    c.ImageDigest,
+				ImageTags:      c.ImageTags,
+				Reason:         "held by " + source,
+			})
+			continue
+		}
+		var staleTags []string
+		for _, tag := range c.StaleTags {
+			if !util.HoldTagMatch(tag, holdTagRegex) {
+				staleTags = append(staleTags, tag)
+			}
+		}
+		c.StaleTags = staleTags
+		kept = append(kept, c)
+	}
+	return kept, retained
+}
+
+// formatDays 以天为单位描述时长，不是整天时按整小时描述，其余使用 time.Duration 的格式
+func formatDays(d time.Duration) string {
+	if d >= 24*time.Hour && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	}
+	if d >= time.Hour && d%time.Hour == 0 {
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	}
+	return d.String()
+}
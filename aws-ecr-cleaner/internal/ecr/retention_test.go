@@ -0,0 +1,123 @@
+package ecr
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"aws-ecr-cleaner/internal/util"
+
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+func TestApplyMinAge(t *testing.T) {
+	tests := []struct {
+		name         string
+		candidates   []Candidate
+		minAge       time.Duration
+		wantCands    []string
+		wantRetained []string
+	}{
+		{
+			name:       "disabled",
+			candidates: []Candidate{candidate(dg("a"), time.Hour)},
+			wantCands:  []string{dg("a")},
+		},
+		{
+			name:         "young images are retained",
+			candidates:   []Candidate{candidate(dg("a"), time.Hour), candidate(dg("b"), 2*day), candidate(dg("c"), 24*time.Hour)},
+			minAge:       24 * time.Hour,
+			wantCands:    sorted(dg("b"), dg("c")),
+			wantRetained: []string{dg("a")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cands, retained := ApplyMinAge(tt.candidates, tt.minAge, testNow)
+			if got := candidateDigests(cands); !reflect.DeepEqual(got, tt.wantCands) {
+				t.Errorf("candidates = %v, want %v", got, tt.wantCands)
+			}
+			want := tt.wantRetained
+			if want == nil {
+				want = []string{}
+			}
+			if got := retainedDigests(retained); !reflect.DeepEqual(got, want) {
+				t.Errorf("retained = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyMaxAge(t *testing.T) {
+	images := []*ecr.ImageDetail{
+		image(dg("a"), 200*day, "release-1"), // 超过最大年龄，即使命中保留 tag 也加入
+		image(dg("b"), 200*day),              // 未打标签，由其它规则处理
+		image(dg("c"), 200*day, "prod"),      // 正在使用
+		image(dg("d"), 10*day, "v2"),         // 未超过最大年龄
+		image(dg("e"), 200*day, "v1"),        // 已是候选，不重复加入
+	}
+	inUse := map[string]bool{util.TrimRegistry(testRepoUri) + ":prod": true}
+	existing := []Candidate{candidate(dg("e"), 200*day, "v1")}
+
+	tests := []struct {
+		name         string
+		maxAge       time.Duration
+		protectInUse bool
+		wantCands    []string
+		wantExpired  []string
+	}{
+		{name: "disabled", wantCands: []string{dg("e")}, wantExpired: []string{}},
+		{name: "in-use images are kept", maxAge: 100 * day, protectInUse: true, wantCands: sorted(dg("a"), dg("e")), wantExpired: []string{dg("a")}},
+		{name: "in-use images expire without protection", maxAge: 100 * day, wantCands: sorted(dg("a"), dg("c"), dg("e")), wantExpired: sorted(dg("a"), dg("c"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cands, expired := ApplyMaxAge(images, append([]Candidate(nil), existing...), tt.maxAge, inUse, testRepoUri, tt.protectInUse, testNow)
+			if got := candidateDigests(cands); !reflect.DeepEqual(got, tt.wantCands) {
+				t.Errorf("candidates = %v, want %v", got, tt.wantCands)
+			}
+			if got := candidateDigests(expired); !reflect.DeepEqual(got, tt.wantExpired) {
+				t.Errorf("expired = %v, want %v", got, tt.wantExpired)
+			}
+			for _, c := range expired {
+				if !c.RemovesManifest(DeleteModeUntag) {
+					t.Errorf("expired image %s keeps tags %v in untag mode", c.ImageDigest, c.ImageTags)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyKeepLatestUntagged(t *testing.T) {
+	images := []*ecr.ImageDetail{
+		image(dg("a"), 1*day),        // 最新的未打标签镜像，但是 index 的子 manifest
+		image(dg("b"), 2*day),        // 最新的独立未打标签镜像
+		image(dg("c"), 3*day),        // 签名制品
+		image(dg("d"), 4*day),        // 第二新的独立未打标签镜像
+		image(dg("e"), 5*day, "old"), // 带 tag，不参与计数
+	}
+	graph := &ManifestGraph{Children: map[string][]Descriptor{dg("i"): {{Digest: dg("a")}}}}
+	referrers := []Referrer{{Digest: dg("c"), Subject: dg("e"), Kind: "sig"}}
+	all := []Candidate{candidate(dg("a"), day), candidate(dg("b"), 2*day), candidate(dg("c"), 3*day), candidate(dg("d"), 4*day), candidate(dg("e"), 5*day, "old")}
+
+	tests := []struct {
+		name         string
+		n            int
+		wantRetained []string
+	}{
+		{name: "disabled", wantRetained: []string{}},
+		{name: "children and referrers do not take a slot", n: 1, wantRetained: []string{dg("b")}},
+		{name: "keep two", n: 2, wantRetained: sorted(dg("b"), dg("d"))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cands, retained := ApplyKeepLatestUntagged(images, all, tt.n, graph, referrers)
+			if got := retainedDigests(retained); !reflect.DeepEqual(got, tt.wantRetained) {
+				t.Errorf("retained = %v, want %v", got, tt.wantRetained)
+			}
+			if len(cands)+len(retained) != len(all) {
+				t.Errorf("%d candidates + %d retained, want %d in total", len(cands), len(retained), len(all))
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+// aws-ecr-cleaner/internal/ecr/semver.go
+package ecr
+
+import (
+	"fmt"
+	"sort"
+
+	"aws-ecr-cleaner/internal/util"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// SemverRules 是按语义化版本保留镜像的规则，KeepMinors <= 0 时不启用
+// 版本号前缀不同（如 api-v1.2.3 与 web-v1.2.3）的 tag 属于不同的版本流，各自独立计算
+type SemverRules struct {
+	KeepMinors      int // 每个版本流保留最新的 N 条发布线（MAJOR.MINOR，至少有一个正式版本）
+	KeepPatches     int // 每条保留的发布线保留最新的 N 个正式版本
+	KeepPrereleases int // 每个版本流保留高于最新正式版本的 N 个预发布版本，低于或等于最新正式版本的预发布版本不保留
+}
+
+// semverTag 是一个解析为版本号的 tag
+type semverTag struct {
+	digest string
+	tag    string
+	v      util.Semver
+}
+
+// keepBySemver 按语义化版本为带 tag 的镜像（命中 holdTagRegex 的除外）计算保留集合，返回保留的 digest 及原因
+// 不能解析为版本号的 tag 与未保留的版本不在返回结果中，由其它规则决定
+func keepBySemver(images []*ecr.ImageDetail, holdTagRegex string, rules SemverRules) map[string]string {
+	if rules.KeepMinors <= 0 {
+		return nil
+	}
+	var prefixes []string
+	streams := make(map[string][]semverTag)
+	for _, image := range images {
+		tags := aws.StringValueSlice(image.ImageTags)
+		if len(tags) == 0 || util.HoldTagMatch(fmt.Sprintf("%s", tags), holdTagRegex) {
+			continue
+		}
+		for _, tag := range tags {
+			v, ok := util.ParseSemver(tag)
+			if !ok {
+				continue
+			}
+			if _, seen := streams[v.Prefix]; !seen {
+				prefixes = append(prefixes, v.Prefix)
+			}
+			streams[v.Prefix] = append(streams[v.Prefix], semverTag{digest: aws.StringValue(image.ImageDigest), tag: tag, v: v})
+		}
+	}
+
+	kept := make(map[string]string)
+	keep := func(t semverTag, reason string) {
+		if _, ok := kept[t.digest]; !ok {
+			kept[t.digest] = fmt.Sprintf("semver %s: %s", t.tag, reason)
+		}
+	}
+	for _, prefix := range prefixes {
+		stream := streams[prefix]
+		sort.SliceStable(stream, func(i, j int) bool {
+			return util.CompareSemver(stream[i].v, stream[j].v) > 0
+		})
+
+		var latest *semverTag
+		lines, patches := 0, 0
+		var line, version string
+		for i, t := range stream {
+			if t.v.Prerelease != "" {
+				continue
+			}
+			if latest == nil {
+				latest = &stream[i]
+			}
+			if t.v.Line() != line {
+				line, version = t.v.Line(), ""
+				lines, patches = lines+1, 0
+			}
+			if lines > rules.KeepMinors {
+				break
+			}
+			if t.v.String() != version {
+				version = t.v.String()
+				patches++
+			}
+			if patches <= rules.KeepPatches {
+				keep(t, fmt.Sprintf("release %d of %d in line %s%s, line %d of %d (SEMVER_KEEP_MINORS / SEMVER_KEEP_PATCHES)",
+					patches, rules.KeepPatches, prefix, line, lines, rules.KeepMinors))
+			}
+		}
+
+		prereleases := 0
+		version = ""
+		latestDesc := "none"
+		if latest != nil {
+			latestDesc = latest.tag
+		}
+		for _, t := range stream {
+			if t.v.Prerelease == "" {
+				continue
+			}
+			if latest != nil && util.CompareSemver(t.v, latest.v) <= 0 {
+				break
+			}
+			if t.v.String() != version {
+				version = t.v.String()
+				prereleases++
+			}
+			if prereleases > rules.KeepPrereleases {
+				break
+			}
+			keep(t, fmt.Sprintf("pre-release %d of %d newer than latest release %s (SEMVER_KEEP_PRERELEASES)", prereleases, rules.KeepPrereleases, latestDesc))
+		}
+	}
+	return kept
+}
@@ -0,0 +1,95 @@
+// aws-ecr-cleaner/internal/ecr/taggroups.go
+package ecr
+
+import (
+	"fmt"
+	"sort"
+
+	"aws-ecr-cleaner/internal/util"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// groupMember 是分组中的一个镜像，order 为其命中该组的 tag 中最大的排序值
+type groupMember struct {
+	image *ecr.ImageDetail
+	order string
+}
+
+// keepByTagGroups 按 TAG_GROUP_RULES 将带 tag 的镜像（命中 holdTagRegex 的除外）分组，返回每组排序最靠前的 Keep 个镜像的 digest 及保留原因
+// 每个 tag 归入第一条命中的规则；镜像的多个 tag 落入不同分组时，在任一分组中被保留即保留
+func keepByTagGroups(images []*ecr.ImageDetail, holdTagRegex string, rules []util.TagGroupRule) map[string]string {
+	if len(rules) == 0 {
+		return nil
+	}
+	type groupID struct {
+		rule int
+		key  string
+	}
+	var order []groupID
+	groups := make(map[groupID]map[string]*groupMember)
+	for _, image := range images {
+		tags := aws.StringValueSlice(image.ImageTags)
+		if len(tags) == 0 || util.HoldTagMatch(fmt.Sprintf("%s", tags), holdTagRegex) {
+			continue
+		}
+		digest := aws.StringValue(image.ImageDigest)
+		for _, tag := range tags {
+			for i, rule := range rules {
+				key, value, ok := rule.Match(tag)
+				if !ok {
+					continue
+				}
+				id := groupID{rule: i, key: key}
+				if groups[id] == nil {
+					groups[id] = make(map[string]*groupMember)
+					order = append(order, id)
+				}
+				m, seen := groups[id][digest]
+				if !seen {
+					groups[id][digest] = &groupMember{image: image, order: value}
+				} else if util.CompareNumeric(value, m.order) > 0 {
+					m.order = value
+				}
+				break
+			}
+		}
+	}
+
+	kept := make(map[string]string)
+	for _, id := range order {
+		rule := rules[id.rule]
+		var members []*groupMember
+		for _, m := range groups[id] {
+			members = append(members, m)
+		}
+		sort.Slice(members, func(i, j int) bool {
+			if rule.NumericOrder() {
+				if c := util.CompareNumeric(members[i].order, members[j].order); c != 0 {
+					return c > 0
+				}
+			}
+			pi, pj := aws.TimeValue(members[i].image.ImagePushedAt), aws.TimeValue(members[j].image.ImagePushedAt)
+			if !pi.Equal(pj) {
+				return pi.After(pj)
+			}
+			return aws.StringValue(members[i].image.ImageDigest) < aws.StringValue(members[j].image.ImageDigest)
+		})
+		for rank, m := range members {
+			if rank == rule.Keep {
+				break
+			}
+			digest := aws.StringValue(m.image.ImageDigest)
+			if _, ok := kept[digest]; ok {
+				continue
+			}
+			by := "push time"
+			if rule.NumericOrder() {
+				by = "order " + m.order
+			}
+			kept[digest] = fmt.Sprintf("rank %d of %d in tag group %q by %s (TAG_GROUP_RULES %s)", rank+1, rule.Keep, id.key, by, rule.Expr)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,254 @@
+// aws-ecr-cleaner/internal/ecr/throttled.go
+package ecr
+
+import (
+	"net/http"
+
+	"aws-ecr-cleaner/internal/throttle"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ecr"
+)
+
+// ThrottledRegistry 为 Registry 的每次调用加上共享限流与退避重试
+// 分页接口在失败后从最后一个成功页的 NextToken 继续，已交付的页不会重复回调
+type ThrottledRegistry struct {
+	inner   Registry
+	limiter *throttle.Limiter
+}
+
+var _ Registry = (*ThrottledRegistry)(nil)
+
+// NewThrottledRegistry 包装 Registry
+func NewThrottledRegistry(inner Registry, limiter *throttle.Limiter) *ThrottledRegistry {
+	return &ThrottledRegistry{inner: inner, limiter: limiter}
+}
+
+// BlobHTTPClient 实现 BlobDownloader，返回被包装 Registry 的 blob 下载客户端，未提供时返回 nil
+func (t *ThrottledRegistry) BlobHTTPClient() *http.Client {
+	if d, ok := t.inner.(BlobDownloader); ok {
+		return d.BlobHTTPClient()
+	}
+	return nil
+}
+
+// DescribeRepositoriesPages 实现 Registry
+func (t *ThrottledRegistry) DescribeRepositoriesPages(input *ecr.DescribeRepositoriesInput, fn func(*ecr.DescribeRepositoriesOutput, bool) bool) error {
+	in := *input
+	done := false
+	return t.limiter.Do("DescribeRepositories", func() error {
+		if done {
+			return nil
+		}
+		return t.inner.DescribeRepositoriesPages(&in, func(page *ecr.DescribeRepositoriesOutput, lastPage bool) bool {
+			in.NextToken = page.NextToken
+			cont := fn(page, lastPage)
+			done = lastPage || !cont
+			return cont
+		})
+	})
+}
+
+// DescribeImagesPages 实现 Registry
+func (t *ThrottledRegistry) DescribeImagesPages(input *ecr.DescribeImagesInput, fn func(*ecr.DescribeImagesOutput, bool) bool) error {
+	in := *input
+	done := false
+	return t.limiter.Do("DescribeImages "+aws.StringValue(input.RepositoryName), func() error {
+		if done {
+			return nil
+		}
+		return t.inner.DescribeImagesPages(&in, func(page *ecr.DescribeImagesOutput, lastPage bool) bool {
+			in.NextToken = page.NextToken
+			cont := fn(page, lastPage)
+			done = lastPage || !cont
+			return cont
+		})
+	})
+}
+
+// BatchGetImage 实现 Registry
+func (t *ThrottledRegistry) BatchGetImage(input *ecr.BatchGetImageInput) (*ecr.BatchGetImageOutput, error) {
+	var out *ecr.BatchGetImageOutput
+	err := t.limiter.Do("BatchGetImage "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.BatchGetImage(input)
+		return err
+	})
+	return out, err
+}
+
+// BatchDeleteImage 实现 Registry
+func (t *ThrottledRegistry) BatchDeleteImage(input *ecr.BatchDeleteImageInput) (*ecr.BatchDeleteImageOutput, error) {
+	var out *ecr.BatchDeleteImageOutput
+	err := t.limiter.Do("BatchDeleteImage "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.BatchDeleteImage(input)
+		return err
+	})
+	return out, err
+}
+
+// DeleteRepository 实现 Registry
+func (t *ThrottledRegistry) DeleteRepository(input *ecr.DeleteRepositoryInput) (*ecr.DeleteRepositoryOutput, error) {
+	var out *ecr.DeleteRepositoryOutput
+	err := t.limiter.Do("DeleteRepository "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.DeleteRepository(input)
+		return err
+	})
+	return out, err
+}
+
+// StartLifecyclePolicyPreview 实现 Registry
+func (t *ThrottledRegistry) StartLifecyclePolicyPreview(input *ecr.StartLifecyclePolicyPreviewInput) (*ecr.StartLifecyclePolicyPreviewOutput, error) {
+	var out *ecr.StartLifecyclePolicyPreviewOutput
+	err := t.limiter.Do("StartLifecyclePolicyPreview "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.StartLifecyclePolicyPreview(input)
+		return err
+	})
+	return out, err
+}
+
+// GetLifecyclePolicyPreview 实现 Registry
+func (t *ThrottledRegistry) GetLifecyclePolicyPreview(input *ecr.GetLifecyclePolicyPreviewInput) (*ecr.GetLifecyclePolicyPreviewOutput, error) {
+	var out *ecr.GetLifecyclePolicyPreviewOutput
+	err := t.limiter.Do("GetLifecyclePolicyPreview "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.GetLifecyclePolicyPreview(input)
+		return err
+	})
+	return out, err
+}
+
+// PutLifecyclePolicy 实现 Registry
+func (t *ThrottledRegistry) PutLifecyclePolicy(input *ecr.PutLifecyclePolicyInput) (*ecr.PutLifecyclePolicyOutput, error) {
+	var out *ecr.PutLifecyclePolicyOutput
+	err := t.limiter.Do("PutLifecyclePolicy "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.PutLifecyclePolicy(input)
+		return err
+	})
+	return out, err
+}
+
+// GetLifecyclePolicy 实现 Registry
+func (t *ThrottledRegistry) GetLifecyclePolicy(input *ecr.GetLifecyclePolicyInput) (*ecr.GetLifecyclePolicyOutput, error) {
+	var out *ecr.GetLifecyclePolicyOutput
+	err := t.limiter.Do("GetLifecyclePolicy "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.GetLifecyclePolicy(input)
+		return err
+	})
+	return out, err
+}
+
+// ListTagsForResource 实现 Registry
+func (t *ThrottledRegistry) ListTagsForResource(input *ecr.ListTagsForResourceInput) (*ecr.ListTagsForResourceOutput, error) {
+	var out *ecr.ListTagsForResourceOutput
+	err := t.limiter.Do("ListTagsForResource "+aws.StringValue(input.ResourceArn), func() error {
+		var err error
+		out, err = t.inner.ListTagsForResource(input)
+		return err
+	})
+	return out, err
+}
+
+// GetRepositoryPolicy 实现 Registry
+func (t *ThrottledRegistry) GetRepositoryPolicy(input *ecr.GetRepositoryPolicyInput) (*ecr.GetRepositoryPolicyOutput, error) {
+	var out *ecr.GetRepositoryPolicyOutput
+	err := t.limiter.Do("GetRepositoryPolicy "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.GetRepositoryPolicy(input)
+		return err
+	})
+	return out, err
+}
+
+// GetDownloadUrlForLayer 实现 Registry
+func (t *ThrottledRegistry) GetDownloadUrlForLayer(input *ecr.GetDownloadUrlForLayerInput) (*ecr.GetDownloadUrlForLayerOutput, error) {
+	var out *ecr.GetDownloadUrlForLayerOutput
+	err := t.limiter.Do("GetDownloadUrlForLayer "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.GetDownloadUrlForLayer(input)
+		return err
+	})
+	return out, err
+}
+
+// CreateRepository 实现 Registry
+func (t *ThrottledRegistry) CreateRepository(input *ecr.CreateRepositoryInput) (*ecr.CreateRepositoryOutput, error) {
+	var out *ecr.CreateRepositoryOutput
+	err := t.limiter.Do("CreateRepository "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.CreateRepository(input)
+		return err
+	})
+	return out, err
+}
+
+// SetRepositoryPolicy 实现 Registry
+func (t *ThrottledRegistry) SetRepositoryPolicy(input *ecr.SetRepositoryPolicyInput) (*ecr.SetRepositoryPolicyOutput, error) {
+	var out *ecr.SetRepositoryPolicyOutput
+	err := t.limiter.Do("SetRepositoryPolicy "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.SetRepositoryPolicy(input)
+		return err
+	})
+	return out, err
+}
+
+// BatchCheckLayerAvailability 实现 Registry
+func (t *ThrottledRegistry) BatchCheckLayerAvailability(input *ecr.BatchCheckLayerAvailabilityInput) (*ecr.BatchCheckLayerAvailabilityOutput, error) {
+	var out *ecr.BatchCheckLayerAvailabilityOutput
+	err := t.limiter.Do("BatchCheckLayerAvailability "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.BatchCheckLayerAvailability(input)
+		return err
+	})
+	return out, err
+}
+
+// InitiateLayerUpload 实现 Registry
+func (t *ThrottledRegistry) InitiateLayerUpload(input *ecr.InitiateLayerUploadInput) (*ecr.InitiateLayerUploadOutput, error) {
+	var out *ecr.InitiateLayerUploadOutput
+	err := t.limiter.Do("InitiateLayerUpload "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.InitiateLayerUpload(input)
+		return err
+	})
+	return out, err
+}
+
+// UploadLayerPart 实现 Registry
+func (t *ThrottledRegistry) UploadLayerPart(input *ecr.UploadLayerPartInput) (*ecr.UploadLayerPartOutput, error) {
+	var out *ecr.UploadLayerPartOutput
+	err := t.limiter.Do("UploadLayerPart "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.UploadLayerPart(input)
+		return err
+	})
+	return out, err
+}
+
+// CompleteLayerUpload 实现 Registry
+func (t *ThrottledRegistry) CompleteLayerUpload(input *ecr.CompleteLayerUploadInput) (*ecr.CompleteLayerUploadOutput, error) {
+	var out *ecr.CompleteLayerUploadOutput
+	err := t.limiter.Do("CompleteLayerUpload "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.CompleteLayerUpload(input)
+		return err
+	})
+	return out, err
+}
+
+// PutImage 实现 Registry
+func (t *ThrottledRegistry) PutImage(input *ecr.PutImageInput) (*ecr.PutImageOutput, error) {
+	var out *ecr.PutImageOutput
+	err := t.limiter.Do("PutImage "+aws.StringValue(input.RepositoryName), func() error {
+		var err error
+		out, err = t.inner.PutImage(input)
+		return err
+	})
+	return out, err
+}
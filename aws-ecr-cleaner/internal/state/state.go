@@ -0,0 +1,142 @@
+// aws-ecr-cleaner/internal/state/state.go
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store 保存需要跨运行保留的状态，以 JSON 文件持久化
+// 记录仓库首次被发现为空的时间（空仓库删除的最短空置时间判断）与镜像首次被标记为候选的时间（删除宽限期判断）
+// 多个区域与仓库并发访问同一个 Store，所有方法都是并发安全的
+type Store struct {
+	path string
+
+	mu   sync.Mutex
+	data storeData
+}
+
+type storeData struct {
+	EmptySince map[string]time.Time            `json:"emptySince"` // 仓库键 → 首次发现为空的时间
+	Marks      map[string]map[string]time.Time `json:"marks"`      // 仓库键 → 镜像 digest → 首次被标记为删除候选的时间
+}
+
+// RepoKey 返回仓库在状态文件中的键，不同账户与区域的同名仓库互不影响
+func RepoKey(accountID, region, repoName string) string {
+	return accountID + "/" + region + "/" + repoName
+}
+
+// Load 从 path 加载状态文件，文件不存在时返回空状态
+func Load(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read state file '%s': %w", path, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.data); err != nil {
+			return nil, fmt.Errorf("failed to parse state file '%s': %w", path, err)
+		}
+	}
+	if s.data.EmptySince == nil {
+		s.data.EmptySince = make(map[string]time.Time)
+	}
+	if s.data.Marks == nil {
+		s.data.Marks = make(map[string]map[string]time.Time)
+	}
+	return s, nil
+}
+
+// MarkEmpty 记录仓库为空，返回首次发现为空的时间（此前未记录时为 now）
+func (s *Store) MarkEmpty(key string, now time.Time) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	since, ok := s.data.EmptySince[key]
+	if !ok {
+		since = now
+		s.data.EmptySince[key] = now
+	}
+	return since
+}
+
+// ClearEmpty 清除仓库的空置记录（仓库不再为空或已删除）
+func (s *Store) ClearEmpty(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.EmptySince, key)
+}
+
+// SyncMarks 以本次扫描的候选同步仓库的删除标记：新候选以 now 记为首次标记时间，已标记的保留原时间，
+// 不再是候选的镜像取消标记。返回各候选的首次标记时间与被取消标记的 digest
+func (s *Store) SyncMarks(key string, digests []string, now time.Time) (map[string]time.Time, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.data.Marks[key]
+	marks := make(map[string]time.Time, len(digests))
+	for _, d := range digests {
+		since, ok := old[d]
+		if !ok {
+			since = now
+		}
+		marks[d] = since
+	}
+	var unmarked []string
+	for d := range old {
+		if _, ok := marks[d]; !ok {
+			unmarked = append(unmarked, d)
+		}
+	}
+	sort.Strings(unmarked)
+	if len(marks) == 0 {
+		delete(s.data.Marks, key)
+	} else {
+		s.data.Marks[key] = marks
+	}
+	result := make(map[string]time.Time, len(marks))
+	for d, since := range marks {
+		result[d] = since
+	}
+	return result, unmarked
+}
+
+// ClearMarks 清除仓库的全部删除标记（仓库为空、不再参与清理或未启用宽限期），返回被取消标记的 digest
+func (s *Store) ClearMarks(key string) []string {
+	_, unmarked := s.SyncMarks(key, nil, time.Time{})
+	return unmarked
+}
+
+// Unmark 清除单个镜像的删除标记（镜像已删除）
+func (s *Store) Unmark(key, digest string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data.Marks[key], digest)
+	if len(s.data.Marks[key]) == 0 {
+		delete(s.data.Marks, key)
+	}
+}
+
+// Save 将状态写回文件：先写入临时文件再重命名，避免中断时留下损坏的状态文件
+func (s *Store) Save() error {
+	s.mu.Lock()
+	data, err := json.MarshalIndent(s.data, "", "  ")
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file '%s': %w", tmp, err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace state file '%s': %w", s.path, err)
+	}
+	return nil
+}
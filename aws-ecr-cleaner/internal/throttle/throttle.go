@@ -0,0 +1,141 @@
+// aws-ecr-cleaner/internal/throttle/throttle.go
+package throttle
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Options 限流与重试参数
+type Options struct {
+	RatePerSecond float64       // 稳态请求速率上限（次/秒）
+	Burst         int           // 令牌桶容量
+	MaxRetries    int           // 单次调用遇到可重试错误后的最大重试次数
+	BaseDelay     time.Duration // 指数退避的初始等待
+	MaxDelay      time.Duration // 指数退避的最大等待
+	Debug         bool
+}
+
+// Limiter 是所有 ECR/STS 调用共享的自适应限流器
+// 令牌桶控制请求速率；遇到限流错误时速率减半，之后每次成功缓慢回升（AIMD），并按指数退避加抖动重试
+type Limiter struct {
+	opts Options
+
+	mu       sync.Mutex
+	rate     float64
+	minRate  float64
+	tokens   float64
+	lastFill time.Time
+}
+
+// New 创建限流器
+func New(opts Options) *Limiter {
+	if opts.RatePerSecond <= 0 {
+		opts.RatePerSecond = 10
+	}
+	if opts.Burst < 1 {
+		opts.Burst = 1
+	}
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = 200 * time.Millisecond
+	}
+	if opts.MaxDelay < opts.BaseDelay {
+		opts.MaxDelay = opts.BaseDelay
+	}
+	return &Limiter{
+		opts:     opts,
+		rate:     opts.RatePerSecond,
+		minRate:  math.Min(1, opts.RatePerSecond),
+		tokens:   float64(opts.Burst),
+		lastFill: time.Now(),
+	}
+}
+
+// wait 阻塞直到取得一个令牌
+func (l *Limiter) wait() {
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens = math.Min(float64(l.opts.Burst), l.tokens+now.Sub(l.lastFill).Seconds()*l.rate)
+		l.lastFill = now
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return
+		}
+		delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+		time.Sleep(delay)
+	}
+}
+
+// onThrottle 遇到限流时将速率减半
+func (l *Limiter) onThrottle() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate = math.Max(l.minRate, l.rate/2)
+	if l.opts.Debug {
+		log.Printf("[DEBUG] Throttled, reducing request rate to %.2f/s", l.rate)
+	}
+}
+
+// onSuccess 调用成功后缓慢恢复速率，直到配置的上限
+func (l *Limiter) onSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate < l.opts.RatePerSecond {
+		l.rate = math.Min(l.opts.RatePerSecond, l.rate+l.opts.RatePerSecond/20)
+	}
+}
+
+// backoff 计算第 attempt 次重试前的等待时间（full jitter）
+func (l *Limiter) backoff(attempt int) time.Duration {
+	d := l.opts.BaseDelay << uint(attempt)
+	if d <= 0 || d > l.opts.MaxDelay {
+		d = l.opts.MaxDelay
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// isRetryable 只重试 AWS 返回的可重试错误（5xx、网络错误等），本地错误直接返回
+func isRetryable(err error) bool {
+	if _, ok := err.(awserr.Error); !ok {
+		return false
+	}
+	return request.IsErrorRetryable(err)
+}
+
+// Do 在限流器控制下执行 fn，遇到限流或可重试错误时退避重试，超出重试次数后返回最后一次错误
+func (l *Limiter) Do(op string, fn func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		l.wait()
+		err = fn()
+		if err == nil {
+			l.onSuccess()
+			return nil
+		}
+		throttled := request.IsErrorThrottle(err)
+		if !throttled && !isRetryable(err) {
+			return err
+		}
+		if throttled {
+			l.onThrottle()
+		}
+		if attempt >= l.opts.MaxRetries {
+			return fmt.Errorf("%s: giving up after %d retries: %w", op, attempt, err)
+		}
+		delay := l.backoff(attempt)
+		if l.opts.Debug {
+			log.Printf("[DEBUG] %s failed (%v), retry %d/%d in %s", op, err, attempt+1, l.opts.MaxRetries, delay)
+		}
+		time.Sleep(delay)
+	}
+}
@@ -1,6 +1,7 @@
 package util
 
 import (
+	"fmt"
 	"log"
 	"regexp"
 	"strings"
@@ -52,6 +53,23 @@ func MultiRegexMatch(s, config string) bool {
 	}
 }
 
+// ValidateMultiRegex 校验 MultiRegexMatch 格式的配置字符串，返回第一个无法编译的正则部分的错误
+func ValidateMultiRegex(config string) error {
+	parts := []string{config}
+	if strings.Contains(config, "OR") {
+		parts = strings.Split(config, "OR")
+	} else if strings.Contains(config, "&&") {
+		parts = strings.Split(config, "&&")
+	}
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if _, err := regexp.Compile(part); err != nil {
+			return fmt.Errorf("invalid regex part '%s': %v", part, err)
+		}
+	}
+	return nil
+}
+
 // HoldTagMatch 判断合并后的标签是否匹配 holdTagRegex
 func HoldTagMatch(combinedTags, holdTagRegex string) bool {
 	return MultiRegexMatch(combinedTags, holdTagRegex)
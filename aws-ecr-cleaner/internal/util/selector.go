@@ -0,0 +1,202 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 选择器中单个条件的运算符
+const (
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorIn        = "in"
+	selectorNotIn     = "notin"
+	selectorExists    = "exists"
+	selectorNotExists = "!exists"
+)
+
+// selectorToken 匹配 tag 键与值：ECR 资源 tag 允许字母、数字及 _ . : / + - @
+var selectorToken = regexp.MustCompile(`^[\p{L}\p{N}_.:/+\-@]+$`)
+
+// selectorQuotedValue 匹配双引号内的值：ECR 资源 tag 的值还允许空格与 =
+var selectorQuotedValue = regexp.MustCompile(`^[\p{L}\p{N}\s_.:/=+\-@]*$`)
+
+// selectorSet 匹配集合条件，例如 team in (payments, web)
+var selectorSet = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// tagRequirement 是选择器中的单个条件
+type tagRequirement struct {
+	key    string
+	op     string
+	values []string
+}
+
+// TagSelector 按资源 tag 选择仓库，语法与 Kubernetes label selector 相同，逗号分隔的条件之间为 AND：
+//
+//	team=payments                 等于（也可写作 ==）
+//	team!=payments                不等于（仓库没有该 tag 时也匹配）
+//	team in (payments, web)       属于集合
+//	lifecycle notin (ephemeral)   不属于集合（仓库没有该 tag 时也匹配）
+//	owner                         存在该 tag
+//	!owner                        不存在该 tag
+//
+// 包含空格或 = 的值需要用双引号括起，例如 description="nightly build" 或 team in ("a=b", web)。
+type TagSelector struct {
+	expr         string
+	requirements []tagRequirement
+}
+
+// ParseTagSelector 解析 tag 选择器，空字符串返回 nil（不限制）
+func ParseTagSelector(expr string) (*TagSelector, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	s := &TagSelector{expr: expr}
+	for _, part := range splitSelector(expr) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty requirement in tag selector '%s'", expr)
+		}
+		req, err := parseRequirement(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag selector '%s': %v", expr, err)
+		}
+		s.requirements = append(s.requirements, req)
+	}
+	return s, nil
+}
+
+// splitSelector 按不在括号与双引号内的逗号切分条件
+func splitSelector(expr string) []string {
+	var parts []string
+	depth, start, quoted := 0, 0, false
+	for i, r := range expr {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case r == ',':
+			if depth == 0 {
+				parts = append(parts, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, expr[start:])
+}
+
+func parseRequirement(part string) (tagRequirement, error) {
+	if m := selectorSet.FindStringSubmatch(part); m != nil {
+		req := tagRequirement{key: m[1], op: m[2]}
+		for _, raw := range splitSelector(m[3]) {
+			if strings.TrimSpace(raw) == "" {
+				return req, fmt.Errorf("empty value in '%s'", part)
+			}
+			v, err := parseValue(raw, part)
+			if err != nil {
+				return req, err
+			}
+			req.values = append(req.values, v)
+		}
+		return req, checkKey(req.key, part)
+	}
+
+	// 键中不允许出现 =，第一个 = 即为运算符的位置，其后的内容（可能带引号）整体作为值
+	i := strings.Index(part, "=")
+	var req tagRequirement
+	switch {
+	case i < 0 && strings.HasPrefix(part, "!"):
+		req = tagRequirement{key: strings.TrimSpace(part[1:]), op: selectorNotExists}
+	case i < 0:
+		req = tagRequirement{key: part, op: selectorExists}
+	case i > 0 && part[i-1] == '!':
+		req = tagRequirement{key: strings.TrimSpace(part[:i-1]), op: selectorNotEquals}
+	default:
+		req = tagRequirement{key: strings.TrimSpace(part[:i]), op: selectorEquals}
+		if strings.HasPrefix(part[i+1:], "=") {
+			i++
+		}
+	}
+	if i >= 0 {
+		// 值允许为空，用于匹配值为空的 tag
+		v, err := parseValue(part[i+1:], part)
+		if err != nil {
+			return req, err
+		}
+		req.values = []string{v}
+	}
+	return req, checkKey(req.key, part)
+}
+
+// parseValue 解析条件中的单个值，去掉两侧空白与双引号；未加引号的值不能包含空格或 =
+func parseValue(raw, part string) (string, error) {
+	v := strings.TrimSpace(raw)
+	if strings.HasPrefix(v, `"`) {
+		if len(v) < 2 || !strings.HasSuffix(v, `"`) || !selectorQuotedValue.MatchString(v[1:len(v)-1]) {
+			return "", fmt.Errorf("invalid value '%s' in '%s'", v, part)
+		}
+		return v[1 : len(v)-1], nil
+	}
+	if v != "" && !selectorToken.MatchString(v) {
+		return "", fmt.Errorf("invalid value '%s' in '%s'", v, part)
+	}
+	return v, nil
+}
+
+func checkKey(key, part string) error {
+	if !selectorToken.MatchString(key) {
+		return fmt.Errorf("invalid key '%s' in '%s'", key, part)
+	}
+	return nil
+}
+
+// Matches 判断资源 tag 是否满足全部条件；nil 选择器匹配任意仓库
+func (s *TagSelector) Matches(tags map[string]string) bool {
+	if s == nil {
+		return true
+	}
+	for _, req := range s.requirements {
+		v, ok := tags[req.key]
+		var matched bool
+		switch req.op {
+		case selectorEquals:
+			matched = ok && v == req.values[0]
+		case selectorNotEquals:
+			matched = !ok || v != req.values[0]
+		case selectorIn:
+			matched = ok && containsString(req.values, v)
+		case selectorNotIn:
+			matched = !ok || !containsString(req.values, v)
+		case selectorExists:
+			matched = ok
+		case selectorNotExists:
+			matched = !ok
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// String 返回选择器的原始表达式
+func (s *TagSelector) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.expr
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTagSelectorMatches(t *testing.T) {
+	payments := map[string]string{"team": "payments", "owner": "alice", "lifecycle": "ephemeral", "note": ""}
+	web := map[string]string{"team": "web", "description": "nightly build", "filter": "a=b"}
+	none := map[string]string{}
+
+	tests := []struct {
+		expr string
+		tags map[string]string
+		want bool
+	}{
+		{expr: "team=payments", tags: payments, want: true},
+		{expr: "team==payments", tags: payments, want: true},
+		{expr: "team = payments", tags: payments, want: true},
+		{expr: "team=payments", tags: web, want: false},
+		{expr: "team=payments", tags: none, want: false},
+		{expr: "note=", tags: payments, want: true},
+		{expr: "note=", tags: web, want: false},
+		{expr: "team!=payments", tags: payments, want: false},
+		{expr: "team!=payments", tags: web, want: true},
+		{expr: "team!=payments", tags: none, want: true},
+		{expr: "team in (payments, web)", tags: payments, want: true},
+		{expr: "team in (payments, web)", tags: web, want: true},
+		{expr: "team in (ops)", tags: payments, want: false},
+		{expr: "team in (payments)", tags: none, want: false},
+		{expr: "lifecycle notin (ephemeral)", tags: payments, want: false},
+		{expr: "lifecycle notin (ephemeral)", tags: web, want: true},
+		{expr: "lifecycle notin (ephemeral)", tags: none, want: true},
+		{expr: "owner", tags: payments, want: true},
+		{expr: "owner", tags: web, want: false},
+		{expr: "!owner", tags: payments, want: false},
+		{expr: "!owner", tags: web, want: true},
+		{expr: "team=payments,owner", tags: payments, want: true},
+		{expr: "team=payments,!owner", tags: payments, want: false},
+		{expr: "team in (payments, web),lifecycle notin (ephemeral)", tags: web, want: true},
+		{expr: `description="nightly build"`, tags: web, want: true},
+		{expr: `description!="nightly build"`, tags: web, want: false},
+		{expr: `filter="a=b"`, tags: web, want: true},
+		{expr: `filter in ("a=b", "c d")`, tags: web, want: true},
+		{expr: `description notin ("nightly build"),team=web`, tags: web, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := ParseTagSelector(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Matches(tt.tags); got != tt.want {
+				t.Errorf("Matches(%v) = %v, want %v", tt.tags, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTagSelectorNil(t *testing.T) {
+	for _, expr := range []string{"", "  "} {
+		s, err := ParseTagSelector(expr)
+		if err != nil || s != nil {
+			t.Fatalf("ParseTagSelector(%q) = %v, %v, want nil selector", expr, s, err)
+		}
+		if !s.Matches(map[string]string{"team": "payments"}) || s.String() != "" {
+			t.Errorf("nil selector must match every repository and print as empty")
+		}
+	}
+}
+
+func TestParseTagSelectorErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: "team=payments,", wantErr: "empty requirement"},
+		{expr: ",owner", wantErr: "empty requirement"},
+		{expr: "=payments", wantErr: "invalid key ''"},
+		{expr: "!", wantErr: "invalid key ''"},
+		{expr: "te am", wantErr: "invalid key 'te am'"},
+		{expr: "!team=payments", wantErr: "invalid key '!team'"},
+		{expr: "team=pay ments", wantErr: "invalid value 'pay ments'"},
+		{expr: "team=a=b", wantErr: "invalid value 'a=b'"},
+		{expr: `team="payments`, wantErr: `invalid value '"payments'`},
+		{expr: `team="a"b"`, wantErr: `invalid value '"a"b"'`},
+		{expr: "team in (payments,)", wantErr: "empty value"},
+		{expr: "team in ()", wantErr: "empty value"},
+		{expr: "team in (pay ments)", wantErr: "invalid value 'pay ments'"},
+		{expr: "team in (payments", wantErr: "invalid key 'team in (payments'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseTagSelector(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+// semverTag 匹配带版本号的 tag：可选的前缀（以 - 或 _ 结尾）、可选的 v、MAJOR.MINOR[.PATCH]、可选的 -预发布标识与 +构建元数据
+// 数字部分不允许前导零，因此 2024.01.15 这类日期 tag 不会被识别为版本号
+var semverTag = regexp.MustCompile(`^(?:(.*[-_]))?v?(0|[1-9]\d*)\.(0|[1-9]\d*)(?:\.(0|[1-9]\d*))?(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?$`)
+
+// Semver 是从 tag 解析出的语义化版本；缺少 PATCH 时（如 2.90）视为 0
+type Semver struct {
+	Prefix     string // 版本号之前的前缀（如 api-），不同前缀的版本各自独立
+	Major      string
+	Minor      string
+	Patch      string
+	Prerelease string // 预发布标识（如 rc.1），正式版本为空
+}
+
+// ParseSemver 解析 tag 中的版本号，不是版本号时返回 false
+func ParseSemver(tag string) (Semver, bool) {
+	m := semverTag.FindStringSubmatch(tag)
+	if m == nil {
+		return Semver{}, false
+	}
+	v := Semver{Prefix: m[1], Major: m[2], Minor: m[3], Patch: m[4], Prerelease: m[5]}
+	if v.Patch == "" {
+		v.Patch = "0"
+	}
+	return v, true
+}
+
+// Line 返回版本所属的发布线（MAJOR.MINOR）
+func (v Semver) Line() string {
+	return v.Major + "." + v.Minor
+}
+
+// String 返回不含前缀与构建元数据的版本号
+func (v Semver) String() string {
+	s := v.Major + "." + v.Minor + "." + v.Patch
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// CompareSemver 按语义化版本的优先级比较两个版本（忽略前缀）：依次比较 MAJOR、MINOR、PATCH，
+// 相同时正式版本高于预发布版本，预发布标识逐段比较（数字段按数值，数字段低于字母段，段数少的较低）
+func CompareSemver(a, b Semver) int {
+	for _, pair := range [][2]string{{a.Major, b.Major}, {a.Minor, b.Minor}, {a.Patch, b.Patch}} {
+		if c := CompareNumeric(pair[0], pair[1]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case a.Prerelease == b.Prerelease:
+		return 0
+	case a.Prerelease == "":
+		return 1
+	case b.Prerelease == "":
+		return -1
+	}
+	ap, bp := strings.Split(a.Prerelease, "."), strings.Split(b.Prerelease, ".")
+	for i := 0; i < len(ap) && i < len(bp); i++ {
+		_, an := trimNumber(ap[i])
+		_, bn := trimNumber(bp[i])
+		var c int
+		switch {
+		case an && bn:
+			c = CompareNumeric(ap[i], bp[i])
+		case an != bn:
+			c = boolCompare(bn, an)
+		default:
+			c = strings.Compare(ap[i], bp[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return boolCompare(len(ap) > len(bp), len(bp) > len(ap))
+}
@@ -0,0 +1,98 @@
+package util
+
+import "testing"
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		tag  string
+		want Semver
+		ok   bool
+	}{
+		{tag: "1.2.3", want: Semver{Major: "1", Minor: "2", Patch: "3"}, ok: true},
+		{tag: "v1.2.3", want: Semver{Major: "1", Minor: "2", Patch: "3"}, ok: true},
+		{tag: "v2.90", want: Semver{Major: "2", Minor: "90", Patch: "0"}, ok: true},
+		{tag: "0.0.0", want: Semver{Major: "0", Minor: "0", Patch: "0"}, ok: true},
+		{tag: "1.0.0-rc.10", want: Semver{Major: "1", Minor: "0", Patch: "0", Prerelease: "rc.10"}, ok: true},
+		{tag: "v1.0.0-rc.1+build.5", want: Semver{Major: "1", Minor: "0", Patch: "0", Prerelease: "rc.1"}, ok: true},
+		{tag: "1.0.0+20250301", want: Semver{Major: "1", Minor: "0", Patch: "0"}, ok: true},
+		{tag: "api-v1.4.0", want: Semver{Prefix: "api-", Major: "1", Minor: "4", Patch: "0"}, ok: true},
+		{tag: "web_2.0.1-beta", want: Semver{Prefix: "web_", Major: "2", Minor: "0", Patch: "1", Prerelease: "beta"}, ok: true},
+		{tag: "latest"},
+		{tag: "main-42"},
+		{tag: "1"},
+		{tag: "v1"},
+		{tag: "1.2.3.4"},
+		{tag: "2024.01.15"},
+		{tag: "01.2.3"},
+		{tag: "1.2.3-"},
+		{tag: "1.2.3+"},
+		{tag: "1.2.3-rc..1"},
+		{tag: "V1.2.3"},
+		{tag: "api1.2.3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			got, ok := ParseSemver(tt.tag)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ParseSemver(%q) = %+v, %v, want %+v, %v", tt.tag, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSemverLineAndString(t *testing.T) {
+	v, ok := ParseSemver("api-v1.4-rc.2+sha.abc")
+	if !ok {
+		t.Fatal("tag not parsed")
+	}
+	if v.Line() != "1.4" || v.String() != "1.4.0-rc.2" {
+		t.Errorf("line = %q, string = %q, want 1.4 and 1.4.0-rc.2", v.Line(), v.String())
+	}
+}
+
+func TestCompareSemver(t *testing.T) {
+	// 按优先级从低到高排列，每个版本都低于其后的全部版本
+	ordered := []string{
+		"0.9.9",
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0-rc.2",
+		"1.0.0-rc.10",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+		"10.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := ParseSemver(ordered[i])
+			b, _ := ParseSemver(ordered[j])
+			want := boolCompare(i > j, j > i)
+			if got := CompareSemver(a, b); got != want {
+				t.Errorf("CompareSemver(%s, %s) = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	// 构建元数据、v 与前缀不影响优先级
+	equal := [][2]string{
+		{"1.0.0+build.1", "1.0.0+build.2"},
+		{"v1.0.0", "1.0.0"},
+		{"1.0", "1.0.0"},
+		{"api-1.0.0-rc.1", "web-v1.0.0-rc.1+sha.abc"},
+	}
+	for _, pair := range equal {
+		a, _ := ParseSemver(pair[0])
+		b, _ := ParseSemver(pair[1])
+		if got := CompareSemver(a, b); got != 0 {
+			t.Errorf("CompareSemver(%s, %s) = %d, want 0", pair[0], pair[1], got)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TagGroupRule 是一条按 tag 分组的保留规则：正则的捕获组给出分组键，每组保留排序最靠前的 Keep 个镜像
+//
+//	^(?P<group>.+)-(?P<order>\d+)$=5     <branch>-<build>：每个分支按构建号保留最新 5 个
+//	^([a-z-]+)-v\d+\.\d+\.\d+$=3         <service>-v<semver>：每个服务按推送时间保留最新 3 个
+//
+// 分组键取命名为 group 的捕获组，没有时取第 1 个捕获组；存在命名为 order 的捕获组时按其数值从大到小排序，否则按推送时间从新到旧排序
+type TagGroupRule struct {
+	Expr  string // 规则原文，格式为 <正则>=<保留数量>
+	Keep  int
+	regex *regexp.Regexp
+	group int // 分组键所在捕获组的序号
+	order int // 数值排序所在捕获组的序号，0 表示按推送时间排序
+}
+
+// ParseTagGroupRules 解析分号分隔的分组规则，每条规则为 <正则>=<保留数量>（以最后一个 = 切分），空字符串返回 nil
+func ParseTagGroupRules(expr string) ([]TagGroupRule, error) {
+	var rules []TagGroupRule
+	for _, part := range strings.Split(expr, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.LastIndex(part, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid tag group rule '%s': must be <regex>=<keep>", part)
+		}
+		keep, err := strconv.Atoi(strings.TrimSpace(part[i+1:]))
+		if err != nil || keep < 1 {
+			return nil, fmt.Errorf("invalid tag group rule '%s': keep count must be a positive integer", part)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(part[:i]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid tag group rule '%s': %v", part, err)
+		}
+		if re.NumSubexp() == 0 {
+			return nil, fmt.Errorf("invalid tag group rule '%s': regex needs a capture group for the group key", part)
+		}
+		rule := TagGroupRule{Expr: part, Keep: keep, regex: re, group: 1}
+		if g := re.SubexpIndex("group"); g > 0 {
+			rule.group = g
+		}
+		if o := re.SubexpIndex("order"); o > 0 {
+			if o == rule.group {
+				return nil, fmt.Errorf("invalid tag group rule '%s': group and order must be different capture groups", part)
+			}
+			rule.order = o
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Match 判断 tag 是否命中规则，返回分组键与排序值（按推送时间排序时为空）
+func (r TagGroupRule) Match(tag string) (key, order string, ok bool) {
+	m := r.regex.FindStringSubmatch(tag)
+	if m == nil {
+		return "", "", false
+	}
+	if r.order > 0 {
+		order = m[r.order]
+	}
+	return m[r.group], order, true
+}
+
+// NumericOrder 判断规则是否按数字捕获组排序
+func (r TagGroupRule) NumericOrder() bool {
+	return r.order > 0
+}
+
+// CompareNumeric 按十进制数值比较两个数字串，不受位数限制；不是数字的串小于任何数字
+func CompareNumeric(a, b string) int {
+	a, aok := trimNumber(a)
+	b, bok := trimNumber(b)
+	switch {
+	case !aok || !bok:
+		return boolCompare(aok, bok)
+	case len(a) != len(b):
+		return boolCompare(len(a) > len(b), len(b) > len(a))
+	}
+	return strings.Compare(a, b)
+}
+
+// trimNumber 去掉数字串的前导零，不是数字时返回 false
+func trimNumber(s string) (string, bool) {
+	if s == "" {
+		return "", false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return "", false
+		}
+	}
+	return strings.TrimLeft(s, "0"), true
+}
+
+func boolCompare(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	}
+	return -1
+}
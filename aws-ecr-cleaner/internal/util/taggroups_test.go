@@ -0,0 +1,135 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTagGroupRules(t *testing.T) {
+	type match struct {
+		tag, key, order string
+		ok              bool
+	}
+	tests := []struct {
+		name    string
+		expr    string
+		keep    []int
+		numeric []bool
+		matches [][]match // 每条规则对若干 tag 的匹配结果
+	}{
+		{name: "empty", expr: " ; "},
+		{
+			name:    "named group and order",
+			expr:    `^(?P<group>.+)-(?P<order>\d+)$=5`,
+			keep:    []int{5},
+			numeric: []bool{true},
+			matches: [][]match{{
+				{tag: "main-42", key: "main", order: "42", ok: true},
+				{tag: "feature-x-7", key: "feature-x", order: "7", ok: true},
+				{tag: "v1.2.3"},
+			}},
+		},
+		{
+			name:    "order before group",
+			expr:    `^(?P<order>\d+)-(?P<group>[a-z]+)$=1`,
+			keep:    []int{1},
+			numeric: []bool{true},
+			matches: [][]match{{{tag: "12-api", key: "api", order: "12", ok: true}}},
+		},
+		{
+			name:    "without names the first capture group is the key and push time orders",
+			expr:    `^([a-z-]+)-v(\d+)\.\d+\.\d+$=3`,
+			keep:    []int{3},
+			numeric: []bool{false},
+			matches: [][]match{{{tag: "billing-v1.2.3", key: "billing", ok: true}}},
+		},
+		{
+			name:    "order without group name keys on the first capture group",
+			expr:    `^(\w+)/(?P<order>\d+)$=2`,
+			keep:    []int{2},
+			numeric: []bool{true},
+			matches: [][]match{{{tag: "pr/17", key: "pr", order: "17", ok: true}}},
+		},
+		{
+			name:    "multiple rules split on the last equals sign",
+			expr:    ` ^(?P<group>.+)-(?P<order>\d+)$=5 ; ^(env=[a-z]+)-.*$ = 2 `,
+			keep:    []int{5, 2},
+			numeric: []bool{true, false},
+			matches: [][]match{
+				{{tag: "main-3", key: "main", order: "3", ok: true}},
+				{{tag: "env=prod-abc", key: "env=prod", ok: true}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseTagGroupRules(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rules) != len(tt.keep) {
+				t.Fatalf("parsed %d rules, want %d", len(rules), len(tt.keep))
+			}
+			for i, r := range rules {
+				if r.Keep != tt.keep[i] || r.NumericOrder() != tt.numeric[i] {
+					t.Errorf("rule %d: keep = %d, numeric = %v, want %d, %v", i, r.Keep, r.NumericOrder(), tt.keep[i], tt.numeric[i])
+				}
+				for _, m := range tt.matches[i] {
+					key, order, ok := r.Match(m.tag)
+					if key != m.key || order != m.order || ok != m.ok {
+						t.Errorf("rule %d Match(%q) = %q, %q, %v, want %q, %q, %v", i, m.tag, key, order, ok, m.key, m.order, m.ok)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseTagGroupRulesErrors(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr string
+	}{
+		{expr: `^(.+)-\d+$`, wantErr: "must be <regex>=<keep>"},
+		{expr: `=3`, wantErr: "must be <regex>=<keep>"},
+		{expr: `^(.+)-\d+$=`, wantErr: "keep count must be a positive integer"},
+		{expr: `^(.+)-\d+$=0`, wantErr: "keep count must be a positive integer"},
+		{expr: `^(.+)-\d+$=-1`, wantErr: "keep count must be a positive integer"},
+		{expr: `^(.+)-\d+$=two`, wantErr: "keep count must be a positive integer"},
+		{expr: `^(.+-\d+$=3`, wantErr: "missing closing )"},
+		{expr: `^main-\d+$=3`, wantErr: "needs a capture group"},
+		{expr: `^(?P<order>\d+)$=3`, wantErr: "group and order must be different"},
+		{expr: `^(?P<group>.+)-(\d+)$=2;^main$=1`, wantErr: "'^main$=1'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseTagGroupRules(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestCompareNumeric 校验构建号按数值而不是按字典序比较：字典序下 "9" 排在 "10" 之后
+func TestCompareNumeric(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "10", b: "9", want: 1}, // 字典序结果相反
+		{a: "9", b: "10", want: -1},
+		{a: "100", b: "99", want: 1},
+		{a: "007", b: "7", want: 0},
+		{a: "0", b: "000", want: 0},
+		{a: "12345678901234567890123", b: "12345678901234567890122", want: 1},
+		{a: "1", b: "", want: 1},
+		{a: "x", b: "0", want: -1},
+		{a: "x", b: "y", want: 0},
+	}
+	for _, tt := range tests {
+		if got := CompareNumeric(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareNumeric(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}